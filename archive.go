@@ -0,0 +1,493 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// archiveExtensions are the file name suffixes of the archive kinds, longest
+// first so ".tar.gz" is found before ".gz" could be
+var archiveExtensions = []string{".tar.gz", ".tar.xz", ".tar.zst", ".tgz", ".txz", ".tzst", ".tar", ".zip"}
+
+// splitArchiveExt splits name into its stem and archive extension, which is
+// empty when name is not named like an archive
+func splitArchiveExt(name string) (stem, ext string) {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)], name[len(name)-len(ext):]
+		}
+	}
+	return name, ""
+}
+
+// freeName returns path, or when something already exists there the first
+// free name with a numeric suffix before its archive extension: "src-1.tar.gz"
+func freeName(fsys FS, path string) string {
+	if _, err := fsys.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return path
+	}
+	stem, ext := splitArchiveExt(path)
+	for i := 1; ; i++ {
+		candidate := stem + "-" + strconv.Itoa(i) + ext
+		if _, err := fsys.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+			return candidate
+		}
+	}
+}
+
+// byteProgress reports the share of an operation's bytes that are done
+type byteProgress struct {
+	op    FileOperation
+	total int64
+	done  int64
+}
+
+func (p *byteProgress) add(n int) {
+	p.done += int64(n)
+	if p.total > 0 {
+		p.op.state.setProgress(min(float64(p.done)/float64(p.total)*100, 100))
+	}
+}
+
+// progressReader counts what is read from r towards progress and stops once
+// the operation is canceled
+type progressReader struct {
+	r        io.Reader
+	progress *byteProgress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.progress.op.canceled(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	r.progress.add(n)
+	return n, err
+}
+
+// archiveWriter adds entries to an archive being created
+type archiveWriter interface {
+	// add writes an entry; target is a symlink's target and data a regular file's contents
+	add(name string, info fs.FileInfo, target string, data io.Reader) error
+	Close() error
+}
+
+// newArchiveWriter starts an archive of kind on w
+func newArchiveWriter(w io.Writer, kind string) (archiveWriter, error) {
+	var compressor io.WriteCloser
+	var err error
+	switch kind {
+	case "zip":
+		return zipArchiveWriter{zip.NewWriter(w)}, nil
+	case "tar":
+	case "tar.gz":
+		compressor = gzip.NewWriter(w)
+	case "tar.xz":
+		compressor, err = xz.NewWriter(w)
+	case "tar.zst":
+		compressor, err = zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("cannot create %s archives", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if compressor != nil {
+		w = compressor
+	}
+	return &tarArchiveWriter{tw: tar.NewWriter(w), compressor: compressor}, nil
+}
+
+type tarArchiveWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser // nil for a plain tar
+}
+
+func (w *tarArchiveWriter) add(name string, info fs.FileInfo, target string, data io.Reader) error {
+	hdr, err := tar.FileInfoHeader(info, target)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if data != nil {
+		_, err = io.Copy(w.tw, data)
+	}
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	err := w.tw.Close()
+	if w.compressor != nil {
+		err = errors.Join(err, w.compressor.Close())
+	}
+	return err
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (w zipArchiveWriter) add(name string, info fs.FileInfo, target string, data io.Reader) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else {
+		hdr.Method = zip.Deflate
+	}
+	entry, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		// Zip stores a symlink's target as its contents
+		_, err = io.WriteString(entry, target)
+	case data != nil:
+		_, err = io.Copy(entry, data)
+	}
+	return err
+}
+
+func (w zipArchiveWriter) Close() error { return w.zw.Close() }
+
+// CreateArchive packs the operation's sources into the archive op.Dest, in the
+// format its name selects. Each source is stored under its own name, with
+// modes, timestamps and symlinks kept; pipes, sockets and devices are skipped.
+// A failed or canceled archive is removed.
+func CreateArchive(op FileOperation) (err error) {
+	fsys := op.fsys()
+	kind := archiveKind(op.Dest, "")
+	if kind == "" {
+		return fmt.Errorf("unknown archive format for %s; use .zip, .tar, .tar.gz, .tar.xz or .tar.zst", filepath.Base(op.Dest))
+	}
+
+	// Size the sources first so progress can be reported in bytes
+	progress := &byteProgress{op: op}
+	for _, source := range op.sources() {
+		Walk(fsys, source, func(path string, info fs.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				progress.total += info.Size()
+			}
+			return nil
+		})
+	}
+
+	file, err := op.destFsys().Create(op.Dest, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			op.destFsys().Remove(op.Dest)
+		}
+	}()
+
+	w, err := newArchiveWriter(file, kind)
+	if err != nil {
+		return err
+	}
+	for _, source := range op.sources() {
+		parent := filepath.Dir(source)
+		err = Walk(fsys, source, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == op.Dest {
+				// The archive is being written inside one of its sources
+				return nil
+			}
+			if err := op.canceled(); err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(parent, path)
+			if err != nil {
+				return err
+			}
+			return addArchiveEntry(fsys, w, filepath.ToSlash(rel), path, info, progress)
+		})
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// addArchiveEntry writes the file at path on fsys to w as name
+func addArchiveEntry(fsys FS, w archiveWriter, name, path string, info fs.FileInfo, progress *byteProgress) error {
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		return w.add(name, info, "", nil)
+	case mode&fs.ModeSymlink != 0:
+		target, err := fsys.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return w.add(name, info, target, nil)
+	case mode.IsRegular():
+		file, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return w.add(name, info, "", &progressReader{r: file, progress: progress})
+	}
+	return nil
+}
+
+// archiveItem is an entry read from an archive for extraction
+type archiveItem struct {
+	name    string // slash-separated, as stored
+	mode    fs.FileMode
+	modTime time.Time
+	target  string    // symlink target
+	link    string    // for a tar hard link, the name of the entry it shares data with
+	data    io.Reader // contents of a regular file
+}
+
+// readArchive calls fn with each entry of the archive at path in turn. Progress
+// counts the uncompressed bytes of a zip and the archive bytes of a tar.
+func readArchive(fsys FS, path, kind string, progress *byteProgress, fn func(item archiveItem) error) error {
+	if kind == "zip" {
+		r, closer, err := openZip(fsys, path)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		for _, f := range r.File {
+			progress.total += int64(f.UncompressedSize64)
+		}
+		for _, f := range r.File {
+			if err := readZipEntry(f, progress, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil {
+		progress.total = info.Size()
+	}
+	tr, release, err := newTarReader(&progressReader{r: file, progress: progress}, kind)
+	if err != nil {
+		return &fs.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer release()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		item := archiveItem{name: hdr.Name, mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime, data: tr}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			item.target = hdr.Linkname
+		case tar.TypeLink:
+			item.link = hdr.Linkname
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+}
+
+func readZipEntry(f *zip.File, progress *byteProgress, fn func(item archiveItem) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	item := archiveItem{name: f.Name, mode: f.Mode(), modTime: f.Modified, data: &progressReader{r: rc, progress: progress}}
+	if item.mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, maxArchiveLinkTarget))
+		if err != nil {
+			return err
+		}
+		item.target = string(target)
+	}
+	return fn(item)
+}
+
+// ExtractArchive unpacks the archive op.Source into the new directory op.Dest,
+// keeping modes and timestamps. Entries that would land outside op.Dest, by
+// their names or through symlinks, fail the extraction. A failed or canceled
+// extraction is removed.
+func ExtractArchive(op FileOperation) (err error) {
+	fsys := op.fsys()
+	info, err := fsys.Stat(op.Source)
+	if err != nil {
+		return err
+	}
+	kind := archiveKind(op.Source, mimeTypes.DetectFS(fsys, op.Source, info))
+	if kind == "" {
+		return fmt.Errorf("%s is not a supported archive", filepath.Base(op.Source))
+	}
+
+	dst := op.destFsys()
+	if err := dst.Mkdir(op.Dest, 0755); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.RemoveAll(op.Dest)
+		}
+	}()
+
+	// Directories stay writable until their contents are in place
+	var dirs []archiveItem
+	progress := &byteProgress{op: op}
+	err = readArchive(fsys, op.Source, kind, progress, func(item archiveItem) error {
+		if err := op.canceled(); err != nil {
+			return err
+		}
+		if item.mode.IsDir() {
+			dirs = append(dirs, item)
+		}
+		return extractEntry(dst, op.Dest, item)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest first, so setting a parent's time is not undone by its children
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := filepath.Join(op.Dest, filepath.FromSlash(path.Clean(dirs[i].name)))
+		if err := dst.Chmod(dir, dirs[i].mode.Perm()); err != nil {
+			return err
+		}
+		if err := dst.Chtimes(dir, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractEntry writes item below dest
+func extractEntry(fsys FS, dest string, item archiveItem) error {
+	name := path.Clean(strings.TrimSuffix(item.name, "/"))
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("refusing to extract %q: it points outside the destination", item.name)
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+
+	mode := item.mode
+	// Each link is checked on its own, but a chain of them can still lead out,
+	// so nothing is written through a link this extraction made
+	through := path.Dir(name)
+	if mode.IsDir() {
+		through = name
+	}
+	if throughSymlink(fsys, dest, through) {
+		return fmt.Errorf("refusing to extract %q: it goes through a link, which may point outside the destination", item.name)
+	}
+	if mode.IsDir() {
+		return fsys.MkdirAll(target, 0700)
+	}
+	if err := fsys.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// A later entry of the same name replaces an earlier one, as with tar
+	if info, err := fsys.Lstat(target); err == nil && !info.IsDir() {
+		if err := fsys.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		// A link out of the destination would let later entries be written through it
+		resolved := path.Join(path.Dir(name), item.target)
+		if path.IsAbs(item.target) || !filepath.IsLocal(filepath.FromSlash(resolved)) {
+			return fmt.Errorf("refusing to extract %q: its link target %q points outside the destination", item.name, item.target)
+		}
+		return fsys.Symlink(item.target, target)
+
+	case item.link != "":
+		source := path.Clean(item.link)
+		if !filepath.IsLocal(filepath.FromSlash(source)) || throughSymlink(fsys, dest, source) {
+			return fmt.Errorf("refusing to extract %q: it links to %q outside the destination", item.name, item.link)
+		}
+		// FS has no hard links, so the data is copied
+		if err := CopyFile(fsys, filepath.Join(dest, filepath.FromSlash(source)), target); err != nil {
+			return err
+		}
+
+	case mode.IsRegular():
+		file, err := fsys.Create(target, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, item.data); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+
+	default:
+		// Pipes and devices are not recreated
+		return nil
+	}
+
+	if err := fsys.Chmod(target, mode.Perm()); err != nil {
+		return err
+	}
+	return fsys.Chtimes(target, item.modTime, item.modTime)
+}
+
+// throughSymlink reports whether any element of name below dest is a symlink.
+// The destination is new, so elements that do not exist yet end the walk.
+func throughSymlink(fsys FS, dest, name string) bool {
+	current := dest
+	for _, element := range strings.Split(name, "/") {
+		current = filepath.Join(current, element)
+		info, err := fsys.Lstat(current)
+		if err != nil {
+			return false
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// archiveProject creates a small tree to pack below dir and returns its root
+func archiveProject(t *testing.T, dir string) string {
+	t.Helper()
+	root := filepath.Join(dir, "project")
+	for _, d := range []string{"project/bin", "project/docs"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "bin/run"), []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs/notes.md"), []byte("# Notes\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs/notes.md", filepath.Join(root, "README")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bin/run", "docs/notes.md", "bin", "docs"} {
+		if err := os.Chtimes(filepath.Join(root, name), archiveTime, archiveTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Read-only directories only get their mode once their contents are extracted
+	if err := os.Chmod(filepath.Join(root, "docs"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(root, "docs"), 0755) })
+	return root
+}
+
+func archiveOperation(opType OperationType, source, dest string) FileOperation {
+	op := NewFileOperation(opType, source, dest, &FileItem{path: source, name: filepath.Base(source)})
+	op.fs = NewMountFS(OSFS{})
+	return op
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tar.xz", ".tar.zst"} {
+		t.Run(ext, func(t *testing.T) {
+			dir := t.TempDir()
+			root := archiveProject(t, dir)
+			archive := filepath.Join(dir, "project"+ext)
+
+			op := archiveOperation(OpCompress, root, archive)
+			if err := ExecuteFileOperation(op); err != nil {
+				t.Fatal(err)
+			}
+			if snapshot := op.state.Snapshot(); snapshot.Stage != StageCompleted || snapshot.Progress != 100 {
+				t.Errorf("unexpected final state %v at %v%%", snapshot.Stage, snapshot.Progress)
+			}
+
+			out := filepath.Join(dir, "out")
+			if err := ExecuteFileOperation(archiveOperation(OpExtract, archive, out)); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chmod(filepath.Join(out, "project/docs"), 0755) })
+
+			if data, err := os.ReadFile(filepath.Join(out, "project/docs/notes.md")); err != nil || string(data) != "# Notes\n" {
+				t.Errorf("got %q, %v after extracting", data, err)
+			}
+			for name, want := range map[string]fs.FileMode{"bin/run": 0750, "docs/notes.md": 0640, "docs": fs.ModeDir | 0555} {
+				info, err := os.Stat(filepath.Join(out, "project", name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode() != want {
+					t.Errorf("%s: got mode %v, want %v", name, info.Mode(), want)
+				}
+				// Zip keeps timestamps to the second
+				if !info.ModTime().Equal(archiveTime) {
+					t.Errorf("%s: got mtime %v, want %v", name, info.ModTime(), archiveTime)
+				}
+			}
+			if target, err := os.Readlink(filepath.Join(out, "project/README")); err != nil || target != "docs/notes.md" {
+				t.Errorf("got link %q, %v", target, err)
+			}
+		})
+	}
+}
+
+func TestCompressSeveralItems(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "both.zip")
+
+	op := archiveOperation(OpCompress, filepath.Join(dir, "a.txt"), archive)
+	op.Sources = []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := op.fs.ReadDir(archive)
+	if err != nil || len(entries) != 2 || entries[0].Name() != "a.txt" || entries[1].Name() != "b.txt" {
+		t.Errorf("got entries %v, %v", entries, err)
+	}
+}
+
+func TestCompressUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ExecuteFileOperation(archiveOperation(OpCompress, filepath.Join(dir, "a.txt"), filepath.Join(dir, "a.rar")))
+	if err == nil || !strings.Contains(err.Error(), "unknown archive format") {
+		t.Errorf("expected an unknown format error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.rar")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no archive to be left behind, got %v", err)
+	}
+}
+
+func TestExtractRefusesPathTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []*tar.Header
+	}{
+		{"parent directory", []*tar.Header{{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644}}},
+		{"absolute path", []*tar.Header{{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg, Mode: 0644}}},
+		{"symlink out", []*tar.Header{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../..", Mode: 0777},
+			{Name: "escape/evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+		{"absolute symlink", []*tar.Header{{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/etc", Mode: 0777}}},
+		{"hard link out", []*tar.Header{{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd", Mode: 0644}}},
+		{"symlink chain out", []*tar.Header{
+			{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+			{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "b/..", Mode: 0777},
+			{Name: "a/c/escaped.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+		{"directory through a symlink chain", []*tar.Header{
+			{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+			{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "b/..", Mode: 0777},
+			{Name: "a/c/", Typeflag: tar.TypeDir, Mode: 0700},
+		}},
+		{"hard link through a symlink chain", []*tar.Header{
+			{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+			{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "b/..", Mode: 0777},
+			{Name: "leak", Typeflag: tar.TypeLink, Linkname: "a/c/secret", Mode: 0644},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, hdr := range tt.entries {
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			archive := filepath.Join(dir, "evil.tar")
+			if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			out := filepath.Join(dir, "nested", "out")
+			if err := os.Mkdir(filepath.Dir(out), 0755); err != nil {
+				t.Fatal(err)
+			}
+			err := ExecuteFileOperation(archiveOperation(OpExtract, archive, out))
+			if err == nil || !strings.Contains(err.Error(), "outside the destination") {
+				t.Errorf("expected extraction to be refused, got %v", err)
+			}
+			if _, err := os.Lstat(out); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected the partial extraction to be removed, got %v", err)
+			}
+			for _, name := range []string{"evil.txt", "nested/escaped.txt"} {
+				if _, err := os.Lstat(filepath.Join(dir, name)); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("expected nothing to be written outside the destination, got %v", err)
+				}
+			}
+			if info, err := os.Stat(filepath.Dir(out)); err != nil || info.Mode().Perm() != 0755 {
+				t.Errorf("expected the directory above the destination to be left alone, got %v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("ok/../../evil.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "evil.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ExecuteFileOperation(archiveOperation(OpExtract, archive, filepath.Join(dir, "out")))
+	if err == nil || !strings.Contains(err.Error(), "outside the destination") {
+		t.Errorf("expected extraction to be refused, got %v", err)
+	}
+}
+
+func TestExtractIntoArchiveIsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "project.zip")
+	writeTestArchive(t, archive, "zip")
+
+	err := ExecuteFileOperation(archiveOperation(OpExtract, archive, filepath.Join(archive, "src", "again")))
+	if !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS, got %v", err)
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.MkdirAll("/w/src", 0755)
+	fsys.MkdirAll("/w/src-1", 0755)
+	WriteFile(fsys, "/w/src.tar.gz", nil, 0644)
+
+	tests := map[string]string{
+		"/w/new.zip":    "/w/new.zip",
+		"/w/src.tar.gz": "/w/src-1.tar.gz",
+		"/w/src":        "/w/src-2",
+	}
+	for path, want := range tests {
+		if got := freeName(fsys, path); got != want {
+			t.Errorf("freeName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestSplitArchiveExt(t *testing.T) {
+	tests := map[string][2]string{
+		"src.tar.gz":   {"src", ".tar.gz"},
+		"SRC.TGZ":      {"SRC", ".TGZ"},
+		"v1.2.tar.zst": {"v1.2", ".tar.zst"},
+		"notes.txt":    {"notes.txt", ""},
+		".zip":         {".zip", ""},
+	}
+	for name, want := range tests {
+		if stem, ext := splitArchiveExt(name); stem != want[0] || ext != want[1] {
+			t.Errorf("splitArchiveExt(%q) = %q, %q, want %q, %q", name, stem, ext, want[0], want[1])
+		}
+	}
+}
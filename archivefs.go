@@ -0,0 +1,742 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// maxArchiveLinkTarget bounds how much of a zip symlink entry is read as its target
+const maxArchiveLinkTarget = 4096
+
+// ArchiveFS is a read-only FS over the entries of a zip or tar archive, rooted
+// at "/". The index is read when the archive is opened; contents are read from
+// the archive each time an entry is opened. Writes fail with EROFS.
+type ArchiveFS struct {
+	base     FS                       // filesystem holding the archive
+	path     string                   // archive file on base, prefixed to paths in errors
+	kind     string                   // as returned by archiveKind
+	entries  map[string]*archiveEntry // keyed by clean absolute path in the archive
+	children map[string][]string      // sorted entry names below each directory
+}
+
+// archiveEntry is a file, directory or symlink of an archive. Directories the
+// archive only implies, by holding entries below them, are synthesized.
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	target  string // symlink target as stored in the archive
+	index   int    // position of the entry whose data this entry reads; -1 for none
+}
+
+func (e *archiveEntry) Name() string       { return e.name }
+func (e *archiveEntry) Size() int64        { return e.size }
+func (e *archiveEntry) Mode() fs.FileMode  { return e.mode }
+func (e *archiveEntry) ModTime() time.Time { return e.modTime }
+func (e *archiveEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *archiveEntry) Sys() any           { return nil }
+
+// OpenArchive reads the index of the archive at path on base. kind is one of
+// the kinds archiveKind returns.
+func OpenArchive(base FS, path, kind string) (*ArchiveFS, error) {
+	info, err := base.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &ArchiveFS{
+		base:     base,
+		path:     path,
+		kind:     kind,
+		entries:  make(map[string]*archiveEntry),
+		children: make(map[string][]string),
+	}
+	a.entries["/"] = &archiveEntry{name: filepath.Base(path), mode: fs.ModeDir | 0755, modTime: info.ModTime(), index: -1}
+
+	if kind == "zip" {
+		err = a.indexZip()
+	} else {
+		err = a.indexTar()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for p := range a.entries {
+		if p != "/" {
+			dir := filepath.Dir(p)
+			a.children[dir] = append(a.children[dir], filepath.Base(p))
+		}
+	}
+	for _, names := range a.children {
+		sort.Strings(names)
+	}
+	return a, nil
+}
+
+func (a *ArchiveFS) indexZip() error {
+	r, closer, err := openZip(a.base, a.path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for i, f := range r.File {
+		entry := &archiveEntry{mode: f.Mode(), size: int64(f.UncompressedSize64), modTime: f.Modified, index: i}
+		if entry.mode&fs.ModeSymlink != 0 {
+			// Zip stores a symlink's target as its contents
+			if rc, err := f.Open(); err == nil {
+				target, _ := io.ReadAll(io.LimitReader(rc, maxArchiveLinkTarget))
+				rc.Close()
+				entry.target = string(target)
+			}
+		}
+		a.add(f.Name, entry)
+	}
+	return nil
+}
+
+func (a *ArchiveFS) indexTar() error {
+	tr, closer, err := openTar(a.base, a.path, a.kind)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := &archiveEntry{mode: hdr.FileInfo().Mode(), size: hdr.Size, modTime: hdr.ModTime, index: i}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			entry.target = hdr.Linkname
+		case tar.TypeLink:
+			// A hard link shares the data of an earlier entry
+			entry.index = -1
+			if source, ok := a.entries[a.clean(hdr.Linkname)]; ok && source.mode.IsRegular() {
+				entry.index, entry.size = source.index, source.size
+			}
+		case tar.TypeXGlobalHeader:
+			continue
+		}
+		a.add(hdr.Name, entry)
+	}
+}
+
+// add records entry under name, synthesizing the directories leading to it.
+// A later entry for the same name replaces an earlier one, as on extraction.
+func (a *ArchiveFS) add(name string, entry *archiveEntry) {
+	path := a.clean(name)
+	if path == "/" {
+		return
+	}
+	entry.name = filepath.Base(path)
+	if !entry.mode.IsDir() && entry.index < 0 && entry.mode&fs.ModeSymlink == 0 {
+		entry.size = 0
+	}
+	a.entries[path] = entry
+
+	root := a.entries["/"]
+	for dir := filepath.Dir(path); dir != "/"; dir = filepath.Dir(dir) {
+		if parent, ok := a.entries[dir]; ok && parent.mode.IsDir() {
+			break
+		}
+		a.entries[dir] = &archiveEntry{name: filepath.Base(dir), mode: fs.ModeDir | 0755, modTime: root.modTime, index: -1}
+	}
+}
+
+// clean turns an entry name into an absolute path confined to the archive
+func (a *ArchiveFS) clean(name string) string {
+	return filepath.Clean("/" + name)
+}
+
+func (a *ArchiveFS) error(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: a.path + a.clean(name), Err: err}
+}
+
+// lookup returns the entry name refers to, following symlinks in its
+// directories, and in its last element too when follow is set
+func (a *ArchiveFS) lookup(op, name string, follow bool) (*archiveEntry, error) {
+	path, err := a.resolve(name, follow)
+	if err != nil {
+		return nil, a.error(op, name, err)
+	}
+	return a.entries[path], nil
+}
+
+// resolve returns the path of the entry name refers to
+func (a *ArchiveFS) resolve(name string, follow bool) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(a.clean(name), "/"), "/")
+	if parts[0] == "" {
+		return "/", nil
+	}
+
+	current, hops := "/", 0
+	for i := 0; i < len(parts); i++ {
+		next := filepath.Join(current, parts[i])
+		last := i == len(parts)-1
+		entry, ok := a.entries[next]
+		if !ok {
+			return "", fs.ErrNotExist
+		}
+		if entry.mode&fs.ModeSymlink != 0 && (!last || follow) {
+			if hops++; hops > maxSymlinkHops {
+				return "", syscall.ELOOP
+			}
+			// Links resolve within the archive, never out of it
+			target := entry.target
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(current, target)
+			}
+			parts = append(strings.Split(strings.TrimPrefix(a.clean(target), "/"), "/"), parts[i+1:]...)
+			if parts[0] == "" {
+				parts = parts[1:]
+			}
+			current, i = "/", -1
+			continue
+		}
+		if !last && !entry.mode.IsDir() {
+			return "", syscall.ENOTDIR
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func (a *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	return a.lookup("stat", name, true)
+}
+
+func (a *ArchiveFS) Lstat(name string) (fs.FileInfo, error) {
+	return a.lookup("lstat", name, false)
+}
+
+func (a *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, err := a.resolve(name, true)
+	if err != nil {
+		return nil, a.error("readdirent", name, err)
+	}
+	if !a.entries[dir].mode.IsDir() {
+		return nil, a.error("readdirent", name, syscall.ENOTDIR)
+	}
+
+	var entries []fs.DirEntry
+	for _, child := range a.children[dir] {
+		entries = append(entries, fs.FileInfoToDirEntry(a.entries[filepath.Join(dir, child)]))
+	}
+	return entries, nil
+}
+
+func (a *ArchiveFS) Readlink(name string) (string, error) {
+	entry, err := a.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if entry.mode&fs.ModeSymlink == 0 {
+		return "", a.error("readlink", name, syscall.EINVAL)
+	}
+	return entry.target, nil
+}
+
+func (a *ArchiveFS) Open(name string) (File, error) {
+	entry, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &archiveFile{name: a.path + a.clean(name), entry: entry}
+	if entry.index < 0 {
+		// Directories and dangling hard links have no data
+		f.reader = strings.NewReader("")
+		return f, nil
+	}
+
+	if a.kind == "zip" {
+		r, closer, err := openZip(a.base, a.path)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := r.File[entry.index].Open()
+		if err != nil {
+			closer.Close()
+			return nil, a.error("open", name, err)
+		}
+		f.reader, f.closers = rc, []io.Closer{rc, closer}
+		return f, nil
+	}
+
+	tr, closer, err := openTar(a.base, a.path, a.kind)
+	if err != nil {
+		return nil, err
+	}
+	// Tar has no index; read through the stream up to the entry
+	for i := 0; i <= entry.index; i++ {
+		if _, err := tr.Next(); err != nil {
+			closer.Close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, a.error("open", name, err)
+		}
+	}
+	f.reader, f.closers = tr, []io.Closer{closer}
+	return f, nil
+}
+
+func (a *ArchiveFS) Create(name string, perm fs.FileMode) (File, error) {
+	return nil, a.error("open", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) Mkdir(name string, perm fs.FileMode) error {
+	return a.error("mkdir", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) MkdirAll(name string, perm fs.FileMode) error {
+	return a.error("mkdir", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) Rename(oldpath, newpath string) error {
+	return &fs.PathError{Op: "rename", Path: a.path + a.clean(oldpath), Err: syscall.EROFS}
+}
+
+func (a *ArchiveFS) Remove(name string) error {
+	return a.error("remove", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) RemoveAll(name string) error {
+	return a.error("unlinkat", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) Chmod(name string, mode fs.FileMode) error {
+	return a.error("chmod", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) Chtimes(name string, atime, mtime time.Time) error {
+	return a.error("chtimes", name, syscall.EROFS)
+}
+
+func (a *ArchiveFS) Symlink(oldname, newname string) error {
+	return a.error("symlink", newname, syscall.EROFS)
+}
+
+func (a *ArchiveFS) Access(name string, mode uint32) error {
+	entry, err := a.lookup("access", name, true)
+	if err != nil {
+		return err
+	}
+	switch {
+	case mode&AccessWrite != 0:
+		return a.error("access", name, syscall.EROFS)
+	case mode&AccessRead != 0 && entry.mode.Perm()&0400 == 0,
+		mode&AccessExecute != 0 && entry.mode.Perm()&0100 == 0:
+		return a.error("access", name, fs.ErrPermission)
+	}
+	return nil
+}
+
+// archiveFile is an entry of an ArchiveFS opened for reading
+type archiveFile struct {
+	name    string
+	entry   *archiveEntry
+	reader  io.Reader
+	closers []io.Closer // the entry's decompressor, then the archive file
+	closed  bool
+}
+
+func (f *archiveFile) Read(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	case f.entry.mode.IsDir():
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	return f.reader.Read(p)
+}
+
+func (f *archiveFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *archiveFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	var errs []error
+	for _, closer := range f.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.entry, nil
+}
+
+// openZip opens the zip archive at path on fsys. The closer releases the file.
+func openZip(fsys FS, path string) (*zip.Reader, io.Closer, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	// Zip needs random access; read files that do not offer it into memory
+	ra, ok := file.(io.ReaderAt)
+	size := info.Size()
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+	r, err := zip.NewReader(ra, size)
+	if err != nil {
+		file.Close()
+		return nil, nil, &fs.PathError{Op: "open", Path: path, Err: err}
+	}
+	return r, file, nil
+}
+
+// openTar opens the tar archive at path on fsys, decompressing it as kind
+// says. The closer releases the file.
+func openTar(fsys FS, path, kind string) (*tar.Reader, io.Closer, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr, release, err := newTarReader(file, kind)
+	if err != nil {
+		file.Close()
+		return nil, nil, &fs.PathError{Op: "open", Path: path, Err: err}
+	}
+	return tr, closerFunc(func() error {
+		release()
+		return file.Close()
+	}), nil
+}
+
+// newTarReader reads a tar stream from r, decompressing it as kind says.
+// release frees the decompressor.
+func newTarReader(r io.Reader, kind string) (tr *tar.Reader, release func(), err error) {
+	release = func() {}
+	switch kind {
+	case "tar.gz":
+		r, err = gzip.NewReader(r)
+	case "tar.xz":
+		r, err = xz.NewReader(r)
+	case "tar.zst":
+		var dec *zstd.Decoder
+		if dec, err = zstd.NewReader(r); err == nil {
+			r, release = dec, dec.Close
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return tar.NewReader(r), release, nil
+}
+
+// closerFunc adapts a function to io.Closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// MountFS serves a base FS and lets paths continue below archive files, so
+// "/tmp/src.tar.gz/src/main.go" names an entry of that archive. Paths are only
+// looked up in archives once the base FS fails with ENOTDIR, so ordinary paths
+// cost nothing extra. Archive indexes are cached until the archive changes.
+type MountFS struct {
+	base     FS
+	mu       sync.Mutex
+	archives map[string]*mountedArchive
+}
+
+// mountedArchive is a cached archive index with the state of the file it was read from
+type mountedArchive struct {
+	fs      *ArchiveFS
+	size    int64
+	modTime time.Time
+}
+
+// NewMountFS returns an FS that serves base and the archives on it
+func NewMountFS(base FS) *MountFS {
+	return &MountFS{base: base, archives: make(map[string]*mountedArchive)}
+}
+
+// mount finds the archive holding name after a base operation on name failed
+// with err. It returns a nil FS and err when name is not below an archive.
+func (m *MountFS) mount(name string, err error) (*ArchiveFS, string, error) {
+	if !errors.Is(err, syscall.ENOTDIR) {
+		return nil, "", err
+	}
+
+	name = filepath.Clean(name)
+	for path := name; path != "/" && path != "."; path = filepath.Dir(path) {
+		info, statErr := m.base.Stat(path)
+		if statErr != nil {
+			continue
+		}
+		// The deepest existing element decides: an archive or a plain file
+		if !info.Mode().IsRegular() {
+			return nil, "", err
+		}
+		archive, archiveErr := m.archive(path, info)
+		if archiveErr != nil {
+			return nil, "", archiveErr
+		}
+		if archive == nil {
+			return nil, "", err
+		}
+		return archive, "/" + strings.TrimPrefix(name[len(path):], "/"), nil
+	}
+	return nil, "", err
+}
+
+// inArchive reports whether name is an entry of an archive browsed through
+// fsys, which only has a virtual path that local programs cannot open
+func inArchive(fsys FS, name string) bool {
+	m, ok := fsys.(*MountFS)
+	if !ok {
+		return false
+	}
+	_, err := m.base.Lstat(name)
+	return errors.Is(err, syscall.ENOTDIR)
+}
+
+// archive returns the index of the archive at path, reading it unless the
+// cached one is current. A nil FS means path is not an archive.
+func (m *MountFS) archive(path string, info fs.FileInfo) (*ArchiveFS, error) {
+	m.mu.Lock()
+	cached, ok := m.archives[path]
+	m.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.fs, nil
+	}
+
+	kind := archiveKind(path, mimeTypes.DetectFS(m.base, path, info))
+	if kind == "" {
+		return nil, nil
+	}
+	archive, err := OpenArchive(m.base, path, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.archives[path] = &mountedArchive{fs: archive, size: info.Size(), modTime: info.ModTime()}
+	m.mu.Unlock()
+	return archive, nil
+}
+
+func (m *MountFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := m.base.Stat(name)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return info, err
+	}
+	return archive.Stat(inner)
+}
+
+func (m *MountFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := m.base.Lstat(name)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return info, err
+	}
+	return archive.Lstat(inner)
+}
+
+func (m *MountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := m.base.ReadDir(name)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return entries, err
+	}
+	return archive.ReadDir(inner)
+}
+
+func (m *MountFS) Readlink(name string) (string, error) {
+	target, err := m.base.Readlink(name)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return target, err
+	}
+	return archive.Readlink(inner)
+}
+
+func (m *MountFS) Open(name string) (File, error) {
+	file, err := m.base.Open(name)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return file, err
+	}
+	return archive.Open(inner)
+}
+
+func (m *MountFS) Create(name string, perm fs.FileMode) (File, error) {
+	file, err := m.base.Create(name, perm)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return file, err
+	}
+	return archive.Create(inner, perm)
+}
+
+func (m *MountFS) Mkdir(name string, perm fs.FileMode) error {
+	archive, inner, err := m.mount(name, m.base.Mkdir(name, perm))
+	if archive == nil {
+		return err
+	}
+	return archive.Mkdir(inner, perm)
+}
+
+func (m *MountFS) MkdirAll(name string, perm fs.FileMode) error {
+	archive, inner, err := m.mount(name, m.base.MkdirAll(name, perm))
+	if archive == nil {
+		return err
+	}
+	return archive.MkdirAll(inner, perm)
+}
+
+func (m *MountFS) Rename(oldpath, newpath string) error {
+	err := m.base.Rename(oldpath, newpath)
+	for _, name := range []string{oldpath, newpath} {
+		if archive, inner, _ := m.mount(name, err); archive != nil {
+			return archive.Rename(inner, inner)
+		}
+	}
+	return err
+}
+
+func (m *MountFS) Remove(name string) error {
+	archive, inner, err := m.mount(name, m.base.Remove(name))
+	if archive == nil {
+		return err
+	}
+	return archive.Remove(inner)
+}
+
+func (m *MountFS) RemoveAll(name string) error {
+	archive, inner, err := m.mount(name, m.base.RemoveAll(name))
+	if archive == nil {
+		return err
+	}
+	return archive.RemoveAll(inner)
+}
+
+func (m *MountFS) Chmod(name string, mode fs.FileMode) error {
+	archive, inner, err := m.mount(name, m.base.Chmod(name, mode))
+	if archive == nil {
+		return err
+	}
+	return archive.Chmod(inner, mode)
+}
+
+func (m *MountFS) Chtimes(name string, atime, mtime time.Time) error {
+	archive, inner, err := m.mount(name, m.base.Chtimes(name, atime, mtime))
+	if archive == nil {
+		return err
+	}
+	return archive.Chtimes(inner, atime, mtime)
+}
+
+func (m *MountFS) Symlink(oldname, newname string) error {
+	archive, inner, err := m.mount(newname, m.base.Symlink(oldname, newname))
+	if archive == nil {
+		return err
+	}
+	return archive.Symlink(oldname, inner)
+}
+
+func (m *MountFS) Access(name string, mode uint32) error {
+	archive, inner, err := m.mount(name, m.base.Access(name, mode))
+	if archive == nil {
+		return err
+	}
+	return archive.Access(inner, mode)
+}
+
+// Lchown changes owners on the base FS; archives are read-only
+func (m *MountFS) Lchown(name string, uid, gid int) error {
+	owner, ok := m.base.(OwnerFS)
+	if !ok {
+		return &fs.PathError{Op: "lchown", Path: name, Err: errors.ErrUnsupported}
+	}
+	archive, _, err := m.mount(name, owner.Lchown(name, uid, gid))
+	if archive != nil {
+		return &fs.PathError{Op: "lchown", Path: name, Err: syscall.EROFS}
+	}
+	return err
+}
+
+// Listxattr lists the attributes of a file on the base FS. Archive entries have none.
+func (m *MountFS) Listxattr(name string) ([]string, error) {
+	xattrs, ok := m.base.(XattrFS)
+	if !ok {
+		return nil, &fs.PathError{Op: "listxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	names, err := xattrs.Listxattr(name)
+	archive, inner, err := m.mount(name, err)
+	if archive == nil {
+		return names, err
+	}
+	_, err = archive.Stat(inner)
+	return nil, err
+}
+
+func (m *MountFS) Getxattr(name, attr string) ([]byte, error) {
+	xattrs, ok := m.base.(XattrFS)
+	if !ok {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	data, err := xattrs.Getxattr(name, attr)
+	archive, _, err := m.mount(name, err)
+	if archive != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	return data, err
+}
+
+func (m *MountFS) Setxattr(name, attr string, data []byte) error {
+	xattrs, ok := m.base.(XattrFS)
+	if !ok {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+	}
+	archive, _, err := m.mount(name, xattrs.Setxattr(name, attr, data))
+	if archive != nil {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: syscall.EROFS}
+	}
+	return err
+}
+
+var (
+	_ FS      = (*ArchiveFS)(nil)
+	_ FS      = (*MountFS)(nil)
+	_ OwnerFS = (*MountFS)(nil)
+	_ XattrFS = (*MountFS)(nil)
+)
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// archiveFixture is one entry of a test archive
+type archiveFixture struct {
+	name   string
+	mode   fs.FileMode
+	data   string
+	target string
+}
+
+var archiveFixtures = []archiveFixture{
+	{name: "src/", mode: fs.ModeDir | 0755},
+	{name: "src/main.go", mode: 0644, data: "package main\n"},
+	{name: "src/run.sh", mode: 0755, data: "#!/bin/sh\n"},
+	{name: "docs/guide/intro.md", mode: 0600, data: "# Intro\n"},
+	{name: "latest", mode: fs.ModeSymlink | 0777, target: "docs/guide"},
+}
+
+var archiveTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// writeTestArchive writes the fixtures to path as kind
+func writeTestArchive(t *testing.T, path, kind string) {
+	t.Helper()
+	var buf bytes.Buffer
+
+	if kind == "zip" {
+		zw := zip.NewWriter(&buf)
+		for _, f := range archiveFixtures {
+			hdr := &zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: archiveTime}
+			hdr.SetMode(f.mode)
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, f.data+f.target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		var w io.WriteCloser = nopWriteCloser{&buf}
+		switch kind {
+		case "tar.gz":
+			w = gzip.NewWriter(&buf)
+		case "tar.xz":
+			xw, err := xz.NewWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w = xw
+		}
+		tw := tar.NewWriter(w)
+		for _, f := range archiveFixtures {
+			hdr, err := tar.FileInfoHeader(&archiveEntry{name: f.name, mode: f.mode, size: int64(len(f.data)), modTime: archiveTime}, f.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hdr.Name = f.name
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(tw, f.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestMountFSBrowsesArchives(t *testing.T) {
+	for _, name := range []string{"project.zip", "project.tar", "project.tar.gz", "project.tar.xz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			writeTestArchive(t, path, archiveKind(name, ""))
+			fsys := NewMountFS(OSFS{})
+
+			entries, err := fsys.ReadDir(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if want := []string{"docs", "latest", "src"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("got entries %v, want %v", names, want)
+			}
+
+			info, err := fsys.Stat(filepath.Join(path, "src/run.sh"))
+			if err != nil || info.Size() != 10 || info.Mode() != 0755 || !info.ModTime().Equal(archiveTime) {
+				t.Errorf("unexpected entry %v, %v", info, err)
+			}
+			// docs was only implied by the entries below it
+			if info, err := fsys.Stat(filepath.Join(path, "docs")); err != nil || !info.IsDir() {
+				t.Errorf("expected a synthesized directory, got %v, %v", info, err)
+			}
+
+			if data, err := ReadFile(fsys, filepath.Join(path, "src/main.go")); err != nil || string(data) != "package main\n" {
+				t.Errorf("got %q, %v reading an entry", data, err)
+			}
+			if data, err := ReadFile(fsys, filepath.Join(path, "latest/intro.md")); err != nil || string(data) != "# Intro\n" {
+				t.Errorf("got %q, %v reading through a symlink entry", data, err)
+			}
+			if target, err := fsys.Readlink(filepath.Join(path, "latest")); err != nil || target != "docs/guide" {
+				t.Errorf("got link target %q, %v", target, err)
+			}
+			if _, err := fsys.Stat(filepath.Join(path, "src/missing")); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected ErrNotExist for a missing entry, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMountFSArchivesAreReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.zip")
+	writeTestArchive(t, path, "zip")
+	fsys := NewMountFS(OSFS{})
+	entry := filepath.Join(path, "src/main.go")
+
+	if _, err := fsys.Create(filepath.Join(path, "new"), 0644); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS creating in an archive, got %v", err)
+	}
+	if err := fsys.Remove(entry); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS removing an entry, got %v", err)
+	}
+	if err := fsys.Rename(entry, filepath.Join(filepath.Dir(path), "main.go")); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS moving an entry out, got %v", err)
+	}
+	if err := fsys.Access(entry, AccessWrite); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected EROFS checking write access, got %v", err)
+	}
+	if err := fsys.Access(entry, AccessRead); err != nil {
+		t.Errorf("expected read access: %v", err)
+	}
+
+	// A plain file is not mistaken for an archive
+	plain := filepath.Join(filepath.Dir(path), "notes.txt")
+	if err := os.WriteFile(plain, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(filepath.Join(plain, "x")); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("expected ENOTDIR below a plain file, got %v", err)
+	}
+}
+
+func TestMountFSRereadsChangedArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.tar")
+	writeTestArchive(t, path, "tar")
+	fsys := NewMountFS(OSFS{})
+	if _, err := fsys.Stat(filepath.Join(path, "src/main.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestArchive(t, path, "zip")
+	if err := os.Chtimes(path, archiveTime, archiveTime); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(filepath.Join(path, "src/main.go")); err == nil {
+		t.Error("expected a zip renamed to .tar to no longer list")
+	}
+}
+
+func TestExtractArchiveEntriesByCopy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "project.tar.gz")
+	writeTestArchive(t, path, "tar.gz")
+	if err := os.Mkdir(filepath.Join(dir, "out"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := NewMountFS(OSFS{})
+	op := memOperation(t, fsys, OpCopy, filepath.Join(path, "src"), filepath.Join(dir, "out/src"))
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out/src/main.go"))
+	if err != nil || string(data) != "package main\n" {
+		t.Errorf("got %q, %v after extracting", data, err)
+	}
+	if _, err := fsys.Stat(filepath.Join(path, "src/main.go")); err != nil {
+		t.Errorf("expected the archive to be left alone: %v", err)
+	}
+}
+
+func TestFileTreeExpandsArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "project.zip")
+	writeTestArchive(t, path, "zip")
+
+	tree := NewFileTree(dir)
+	tree.expandDepth = -1
+	items := tree.LoadDirectory(dir)().(loadedDirectoryMsg).items
+	if len(items) != 2 || !items[1].archive {
+		t.Fatalf("expected an unexpanded archive, got %+v", items)
+	}
+	tree.setItems(items)
+
+	tree.expanded[path] = true
+	tree.expanded[filepath.Join(path, "src")] = true
+	items = tree.LoadDirectory(dir)().(loadedDirectoryMsg).items
+	var paths []string
+	for _, item := range items[1:] {
+		paths = append(paths, item.path)
+		if item.path != path && !item.entry {
+			t.Errorf("expected %s to be marked as an archive entry", item.path)
+		}
+	}
+	want := []string{
+		path,
+		filepath.Join(path, "docs"),
+		filepath.Join(path, "src"),
+		filepath.Join(path, "src/main.go"),
+		filepath.Join(path, "src/run.sh"),
+		filepath.Join(path, "latest"),
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+}
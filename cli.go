@@ -0,0 +1,376 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Themes accepted by --theme
+const (
+	ThemeAuto    = "auto"    // LS_COLORS when set, else the built-in colors
+	ThemeBuiltin = "builtin" // always the built-in colors
+	ThemeMono    = "mono"    // no colors, only bold and reverse video
+)
+
+// choiceFlag is a string flag limited to a fixed set of values, which the
+// completion scripts offer
+type choiceFlag struct {
+	value   *string
+	choices []string
+}
+
+func (f choiceFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f choiceFlag) Set(s string) error {
+	if !slices.Contains(f.choices, s) {
+		return fmt.Errorf("must be one of %s", strings.Join(f.choices, ", "))
+	}
+	*f.value = s
+	return nil
+}
+
+// choiceVar defines a choice flag stored in p, which holds its default
+func choiceVar(flags *flag.FlagSet, p *string, name, usage string, choices []string) {
+	flags.Var(choiceFlag{p, choices}, name, usage)
+}
+
+// pathFlag is a string flag naming a file, which the completion scripts complete as a path
+type pathFlag struct {
+	value *string
+}
+
+func (f pathFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f pathFlag) Set(s string) error {
+	*f.value = s
+	return nil
+}
+
+// pathVar defines a path flag stored in p, which holds its default
+func pathVar(flags *flag.FlagSet, p *string, name, usage string) {
+	flags.Var(pathFlag{p}, name, usage)
+}
+
+// CLIOptions holds the command line of the TUI
+type CLIOptions struct {
+	Path        string // directory to start in, or a file to select; empty for the working directory
+	Hidden      bool
+	hiddenSet   bool // whether --hidden was given, so the config applies otherwise
+	Sort        string
+	Theme       string
+	Icons       string
+	NerdFont    bool
+	ConfigPath  string
+	Editor      string
+	Depth       int // levels shown on start; 1 lists only the start directory
+	LastDirFile string
+	Pick        bool
+	Multi       bool
+	Print0      bool
+	PickOutput  string
+	Version     bool
+}
+
+// newRootFlagSet defines the flags of the TUI, storing them in opts
+func newRootFlagSet(opts *CLIOptions, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("modaltree", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.BoolVar(&opts.Hidden, "hidden", false, "Show hidden files (--hidden=false hides them), overriding the config")
+	choiceVar(flags, &opts.Sort, "sort", "Sort order: name, size, modified or extension", sortNames())
+	choiceVar(flags, &opts.Theme, "theme", "Colors: auto (LS_COLORS when set), builtin or mono", []string{ThemeAuto, ThemeBuiltin, ThemeMono})
+	choiceVar(flags, &opts.Icons, "icons", "Icon set: auto, nerd, unicode or ascii", []string{IconsAuto, IconsNerd, IconsUnicode, IconsASCII})
+	flags.BoolVar(&opts.NerdFont, "nerd-font", false, "Enable Nerd Font Icons (same as --icons=nerd)")
+	pathVar(flags, &opts.ConfigPath, "config", "Read the config from this file instead of ~/"+filepath.Join(configDir, configFile))
+	flags.StringVar(&opts.Editor, "editor", "", "Editor command, overriding the config, $VISUAL and $EDITOR")
+	flags.IntVar(&opts.Depth, "depth", 1, "Expand directories on start to show this many levels")
+	pathVar(flags, &opts.LastDirFile, "lastdir-file", "File to write the current directory to on quit-and-cd (set by the shell wrapper)")
+	flags.BoolVar(&opts.Pick, "pick", false, "Picker mode: Enter on a file quits and prints its path")
+	flags.BoolVar(&opts.Multi, "multi", false, "With --pick, Enter prints every marked path (mark with space)")
+	flags.BoolVar(&opts.Print0, "print0", false, "With --pick, separate paths with NUL instead of newline")
+	pathVar(flags, &opts.PickOutput, "pick-output", "With --pick, write paths to this file instead of stdout")
+	flags.BoolVar(&opts.Version, "version", false, "Print version and build information")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: modaltree [flags] [path]\n")
+		fmt.Fprintf(stderr, "       modaltree <command> [args]\n\n")
+		fmt.Fprintf(stderr, "Browses path, or the working directory. When path is a file, its\n")
+		fmt.Fprintf(stderr, "directory is opened with the file selected. An sftp://[user@]host[:port]/path\n")
+		fmt.Fprintf(stderr, "browses a remote host, authenticating with ssh-agent or ~/.ssh keys.\n\nCommands:\n")
+		for _, cmd := range subcommands() {
+			fmt.Fprintf(stderr, "  %-11s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintf(stderr, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// ParseCLI parses the arguments of the TUI, without the program name. Errors
+// are reported on stderr; flag.ErrHelp is returned when help was requested.
+func ParseCLI(args []string, stderr io.Writer) (CLIOptions, error) {
+	opts := CLIOptions{LastDirFile: os.Getenv(lastDirEnv)}
+	flags := newRootFlagSet(&opts, stderr)
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "hidden" {
+			opts.hiddenSet = true
+		}
+	})
+
+	fail := func(msg string) (CLIOptions, error) {
+		fmt.Fprintln(stderr, msg)
+		return opts, fmt.Errorf("%s", msg)
+	}
+	if flags.NArg() > 1 {
+		return fail("expected at most one path; flags go before the path")
+	}
+	opts.Path = flags.Arg(0)
+	if opts.Depth < 1 {
+		return fail("--depth must be at least 1")
+	}
+	if !opts.Pick && (opts.Multi || opts.Print0 || opts.PickOutput != "") {
+		return fail("--multi, --print0 and --pick-output require --pick")
+	}
+	return opts, nil
+}
+
+// Apply applies the command line to a model built from the config
+func (o CLIOptions) Apply(m *Model) error {
+	if strings.HasPrefix(o.Path, sftpScheme) {
+		fsys, dir, selected, err := resolveRemoteStartPath(o.Path)
+		if err != nil {
+			return err
+		}
+		m.tree.fs = fsys
+		m.config.CurrentDir = dir
+		m.tree.root = dir
+		m.tree.selectPath = selected
+	} else if o.Path != "" {
+		dir, selected, err := resolveStartPath(o.Path)
+		if err != nil {
+			return err
+		}
+		m.config.CurrentDir = dir
+		m.tree.root = dir
+		m.tree.selectPath = selected
+	}
+	if o.hiddenSet {
+		m.config.ShowHidden = o.Hidden
+		m.tree.showHidden = o.Hidden
+	}
+	if o.Sort != "" {
+		m.config.Sort = o.Sort
+		m.tree.sortBy, _ = parseSortMode(o.Sort)
+	}
+	if o.Editor != "" {
+		m.config.Editor = o.Editor
+	}
+	m.tree.expandDepth = o.Depth - 1
+
+	switch o.Theme {
+	case ThemeAuto:
+		m.config.Display.PreferTheme = false
+	case ThemeBuiltin:
+		m.config.Display.PreferTheme = true
+	}
+
+	// Probe the terminal for icons before the TUI takes it over
+	if o.NerdFont {
+		m.config.Display.Icons = IconsNerd
+	}
+	if o.Icons != "" {
+		m.config.Display.Icons = o.Icons
+	}
+	m.config.Display.ResolveIcons()
+	m.config.loadIcons()
+
+	m.config.LastDirFile = o.LastDirFile
+	if o.Pick {
+		m.pick = &PickMode{Multi: o.Multi, Print0: o.Print0, Output: o.PickOutput}
+	}
+	return nil
+}
+
+// resolveStartPath returns the directory to open for path and, when path is
+// a file, the file to select in it
+func resolveStartPath(path string) (dir, selected string, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return abs, "", nil
+	}
+	return filepath.Dir(abs), abs, nil
+}
+
+// resolveRemoteStartPath connects to the host of an sftp:// URL and resolves
+// the path it names like resolveStartPath
+func resolveRemoteStartPath(raw string) (fsys *SFTPFS, dir, selected string, err error) {
+	fsys, dir, err = DialSFTP(raw, SFTPOptions{})
+	if err != nil {
+		return nil, "", "", err
+	}
+	info, err := fsys.Stat(dir)
+	if err != nil {
+		fsys.Close()
+		return nil, "", "", err
+	}
+	if info.IsDir() {
+		return fsys, dir, "", nil
+	}
+	return fsys, path.Dir(dir), dir, nil
+}
+
+// VersionInfo describes the build from the module and VCS information the Go toolchain embeds
+func VersionInfo() string {
+	version, goVersion := "(devel)", runtime.Version()
+	var revision, commitTime string
+	var modified bool
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			version = info.Main.Version
+		}
+		goVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.time":
+				commitTime = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "modaltree %s\n", version)
+	if revision != "" {
+		line := "commit " + revision[:min(len(revision), 12)]
+		if modified {
+			line += " (modified)"
+		}
+		if commitTime != "" {
+			line += " from " + commitTime
+		}
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "built with %s for %s/%s\n", goVersion, runtime.GOOS, runtime.GOARCH)
+	return b.String()
+}
+
+// argKind says what the positional arguments of a command are, for completion
+type argKind int
+
+const (
+	argNone argKind = iota
+	argFile
+	argDir
+	argChoice
+)
+
+// subcommand is run instead of the TUI when its name is the first argument
+type subcommand struct {
+	name    string
+	summary string
+	args    argKind
+	choices []string                      // positional values when args is argChoice
+	flags   func(io.Writer) *flag.FlagSet // defines the command's flags, for completion
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+// subcommands lists the commands in the order they are documented
+func subcommands() []subcommand {
+	return []subcommand{
+		{
+			name:    "completion",
+			summary: "Print a shell completion script",
+			args:    argChoice,
+			choices: completionShells,
+			flags:   func(w io.Writer) *flag.FlagSet { return newCompletionFlagSet(w) },
+			run:     runCompletion,
+		},
+		{
+			name:    "init",
+			summary: "Print a shell function that changes directory on quit-and-cd",
+			args:    argChoice,
+			choices: shellNames(),
+			flags:   func(w io.Writer) *flag.FlagSet { return newInitFlagSet(new(string), w) },
+			run:     runInit,
+		},
+		{
+			name:    "tree",
+			summary: "Print the directory tree without starting the TUI",
+			args:    argDir,
+			flags:   func(w io.Writer) *flag.FlagSet { return newTreeFlagSet(new(treeFlags), w) },
+			run:     runTreeCommand,
+		},
+		{
+			name:    "version",
+			summary: "Print version and build information",
+			flags:   func(w io.Writer) *flag.FlagSet { return newVersionFlagSet(w) },
+			run:     runVersion,
+		},
+	}
+}
+
+// findSubcommand returns the subcommand called name
+func findSubcommand(name string) (subcommand, bool) {
+	for _, cmd := range subcommands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return subcommand{}, false
+}
+
+func newVersionFlagSet(stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: modaltree version\n\nPrints version and build information.\n")
+	}
+	return flags
+}
+
+// runVersion implements "modaltree version" and returns the exit code
+func runVersion(args []string, stdout, stderr io.Writer) int {
+	flags := newVersionFlagSet(stderr)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	fmt.Fprint(stdout, VersionInfo())
+	return 0
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCLI(t *testing.T) {
+	opts, err := ParseCLI([]string{"--sort", "size", "--depth", "3", "--hidden=false", "some/dir"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Path != "some/dir" || opts.Sort != "size" || opts.Depth != 3 || opts.Hidden || !opts.hiddenSet {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	// Without --hidden the config decides
+	if opts, _ := ParseCLI(nil, io.Discard); opts.hiddenSet || opts.Depth != 1 {
+		t.Errorf("unexpected defaults %+v", opts)
+	}
+
+	if _, err := ParseCLI([]string{"-h"}, io.Discard); err != flag.ErrHelp {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+	for _, args := range [][]string{
+		{"a", "b"},
+		{"--sort", "bogus"},
+		{"--theme", "bogus"},
+		{"--depth", "0"},
+		{"--multi"},
+	} {
+		var stderr bytes.Buffer
+		if _, err := ParseCLI(args, &stderr); err == nil || stderr.Len() == 0 {
+			t.Errorf("%v: expected a reported error, got %v", args, err)
+		}
+	}
+}
+
+func TestApplyStartFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "b.txt")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := tabModel(t.TempDir())
+	if err := (CLIOptions{Path: file, Depth: 1}).Apply(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.config.CurrentDir != dir || m.tree.root != dir {
+		t.Fatalf("expected to open %s, got %s", dir, m.tree.root)
+	}
+
+	newModel, _ := m.Update(m.Init()())
+	m = newModel.(Model)
+	if item := m.tree.GetSelectedItem(); item == nil || item.path != file {
+		t.Errorf("expected %s to be selected, got %+v", file, item)
+	}
+
+	if err := (CLIOptions{Path: filepath.Join(dir, "missing")}).Apply(&m); err == nil {
+		t.Error("expected an error for a missing start path")
+	}
+}
+
+func TestApplyDepthCanBeCollapsed(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m := tabModel(dir)
+	if err := (CLIOptions{Depth: 3}).Apply(&m); err != nil {
+		t.Fatal(err)
+	}
+	newModel, _ := m.Update(m.Init()())
+	m = newModel.(Model)
+
+	// "..", a, a/b and a/b/c are listed; c is beyond the depth and stays closed
+	if len(m.tree.items) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(m.tree.items))
+	}
+	if m.tree.expanded[filepath.Join(dir, "a", "b", "c")] {
+		t.Error("expected the deepest directory to stay collapsed")
+	}
+
+	// The initial expansion is ordinary state, so collapsing a directory sticks
+	m.tree.cursor = 1
+	m.tree.Collapse()
+	m.tree.setItems(m.tree.LoadDirectory(dir)().(loadedDirectoryMsg).items)
+	if len(m.tree.items) != 2 {
+		t.Errorf("expected a to collapse, got %d items", len(m.tree.items))
+	}
+}
+
+func TestCompletionScriptsCoverFlags(t *testing.T) {
+	for _, shell := range completionShells {
+		script, err := CompletionScript(shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cmd := range completionCommands() {
+			if cmd.name != "" && !strings.Contains(script, cmd.name) {
+				t.Errorf("%s script is missing the %s command", shell, cmd.name)
+			}
+			for _, f := range cmd.flags {
+				option := "--" + f.Name
+				if shell == "fish" {
+					option = "-l " + f.Name
+				}
+				if !strings.Contains(script, option) {
+					t.Errorf("%s script is missing --%s", shell, f.Name)
+				}
+			}
+		}
+	}
+	if _, err := CompletionScript("tcsh"); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	script, _ := CompletionScript("bash")
+	probe := script + `
+t() { COMP_WORDS=("$@"); COMP_CWORD=$((${#COMP_WORDS[@]} - 1)); COMPREPLY=(); _modaltree; echo "${COMPREPLY[*]}"; }
+t modaltree --so
+t modaltree --sort = m
+t modaltree tr
+t modaltree tree --style ""
+t modaltree completion ""
+`
+	// Run where no file names can match the words being completed
+	cmd := exec.Command("bash", "-c", probe)
+	cmd.Dir = t.TempDir()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	want := "--sort\nmodified\ntree\nunicode rounded heavy double ascii none\nbash fish zsh\n"
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runVersion(nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "modaltree ") || !strings.Contains(stdout.String(), "built with go") {
+		t.Errorf("unexpected version output %q", stdout.String())
+	}
+	if code := runVersion([]string{"extra"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected usage error for an argument, got %d", code)
+	}
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
-
-	"golang.org/x/sys/unix"
 )
 
 // FileOperation represents a file operation (move, copy, delete)
@@ -18,6 +23,14 @@ type FileOperation struct {
 	Dest string
 	Selected *FileItem
 	state *OperationState
+	ctx context.Context // canceled when the user aborts the operation
+	fs FS // filesystem holding Source and Dest
+	destFs FS // filesystem holding Dest when it is another one, as when copying to a remote host
+	Sources []string // everything OpCompress packs; just Source when empty
+	preserve PreserveOptions // metadata copies keep
+	parallelism int // files recursive copies and deletes work on at once
+	conflicts *conflictResolver // decides destinations that already exist; nil fails on them
+	merge bool // Dest is an existing directory the source is merged into
 }
 
 // NewFileOperation creates a new file operation with initialized state
@@ -27,6 +40,10 @@ func NewFileOperation(opType OperationType, source, dest string, selected *FileI
 		Source: source,
 		Dest: dest,
 		Selected: selected,
+		ctx: context.Background(),
+		fs: OSFS{},
+		preserve: DefaultPreserveOptions(),
+		parallelism: DefaultParallelism,
 	}
 	op.state = &OperationState{
 		Operation: op,
@@ -45,17 +62,168 @@ type OperationState struct {
 	LastError  error
 	Stage      OperationStage
 	Progress   float64    // Add this field
+	Unpreserved []MetadataError // metadata copies could not keep
+	ItemsDone  int   // files and directories handled, out of ItemsTotal found so far
+	ItemsTotal int
+	BytesDone  int64 // file data copied, out of BytesTotal found so far
+	BytesTotal int64
+	Skipped    int       // items left alone because their destination existed
+	Conflict   *Conflict // destination waiting for the user to choose what happens
+	mu         sync.Mutex // guards the fields above while the operation runs in the background
+}
+
+// update changes the state from the goroutine running the operation
+func (s *OperationState) update(fn func(s *OperationState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+// setProgress records the completion percentage of the running stage
+func (s *OperationState) setProgress(progress float64) {
+	s.update(func(s *OperationState) { s.Progress = progress })
+}
+
+// Snapshot returns a copy of the state that is safe to read while the operation runs
+func (s *OperationState) Snapshot() *OperationState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &OperationState{
+		Operation:  s.Operation,
+		BackupPath: s.BackupPath,
+		StartTime:  s.StartTime,
+		RetryCount: s.RetryCount,
+		LastError:  s.LastError,
+		Stage:      s.Stage,
+		Progress:   s.Progress,
+		Unpreserved: append([]MetadataError(nil), s.Unpreserved...),
+		ItemsDone:  s.ItemsDone,
+		ItemsTotal: s.ItemsTotal,
+		BytesDone:  s.BytesDone,
+		BytesTotal: s.BytesTotal,
+		Skipped:    s.Skipped,
+		Conflict:   s.Conflict,
+	}
+}
+
+// addWork records items and bytes the operation has found to do
+func (s *OperationState) addWork(items int, bytes int64) {
+	s.update(func(s *OperationState) {
+		s.ItemsTotal += items
+		s.BytesTotal += bytes
+	})
+}
+
+// addDone records finished items and bytes. Progress follows the bytes, or
+// the items when there is no data to copy, as for deletes and empty files.
+func (s *OperationState) addDone(items int, bytes int64) {
+	s.update(func(s *OperationState) {
+		s.ItemsDone += items
+		s.BytesDone += bytes
+		if s.BytesTotal > 0 {
+			s.Progress = float64(s.BytesDone) / float64(s.BytesTotal) * 100
+		} else if s.ItemsTotal > 0 {
+			s.Progress = float64(s.ItemsDone) / float64(s.ItemsTotal) * 100
+		}
+	})
+}
+
+// canceled returns the context error once the user has aborted the operation
+func (op FileOperation) canceled() error {
+	return op.context().Err()
+}
+
+// context returns the context the operation runs in, a background one unless set
+func (op FileOperation) context() context.Context {
+	if op.ctx == nil {
+		return context.Background()
+	}
+	return op.ctx
+}
+
+// sources returns the paths the operation reads
+func (op FileOperation) sources() []string {
+	if len(op.Sources) == 0 {
+		return []string{op.Source}
+	}
+	return op.Sources
+}
+
+// workers returns how many files recursive work handles at once
+func (op FileOperation) workers() int {
+	if op.parallelism < 1 {
+		return DefaultParallelism
+	}
+	return op.parallelism
+}
+
+// fsys returns the filesystem of the operation, the OS one unless another was set
+func (op FileOperation) fsys() FS {
+	if op.fs == nil {
+		return OSFS{}
+	}
+	return op.fs
+}
+
+// destFsys returns the filesystem Dest is on
+func (op FileOperation) destFsys() FS {
+	if op.destFs == nil {
+		return op.fsys()
+	}
+	return op.destFs
+}
+
+// crossFS reports whether Source and Dest are on different filesystems
+func (op FileOperation) crossFS() bool {
+	return op.destFs != nil && op.destFs != op.fsys()
+}
+
+// acrossDevices reports whether op.Source cannot be renamed to op.Dest because
+// they are on different filesystems or devices
+func (op FileOperation) acrossDevices() bool {
+	if op.crossFS() {
+		return true
+	}
+	src, err := op.fsys().Lstat(op.Source)
+	if err != nil {
+		return false
+	}
+	dst, err := op.fsys().Stat(filepath.Dir(op.Dest))
+	if err != nil {
+		return false
+	}
+	srcStat, srcOK := src.Sys().(*syscall.Stat_t)
+	dstStat, dstOK := dst.Sys().(*syscall.Stat_t)
+	return srcOK && dstOK && srcStat.Dev != dstStat.Dev
+}
+
+// preserveMetadata carries the metadata of the source src, described by info,
+// over to its copy dst and records what could not be kept
+func (op FileOperation) preserveMetadata(src string, info os.FileInfo, dst string) {
+	failed := PreserveMetadata(op.fsys(), src, info, op.destFsys(), dst, op.preserve)
+	if len(failed) > 0 {
+		op.state.update(func(s *OperationState) { s.Unpreserved = append(s.Unpreserved, failed...) })
+	}
 }
 
 // Add this function
 func handleOperationError(op FileOperation, err error, backup string) {
-	op.state.Stage = StageFailed
-	op.state.LastError = err
+	op.state.update(func(s *OperationState) {
+		s.Stage = StageFailed
+		s.LastError = err
+	})
+	if restoreErr := op.conflicts.restoreSetAside(op); restoreErr != nil {
+		op.state.update(func(s *OperationState) {
+			s.LastError = fmt.Errorf("restoring overwritten destination failed: %v (original: %v)", restoreErr, err)
+		})
+	}
 	if backup != "" {
-		if restoreErr := restoreBackup(backup, op.Source); restoreErr != nil {
-			op.state.LastError = fmt.Errorf("restore failed: %v (original: %v)", restoreErr, err)
+		if restoreErr := restoreBackup(op.fsys(), backup, op.Source); restoreErr != nil {
+			op.state.update(func(s *OperationState) {
+				s.LastError = fmt.Errorf("restore failed: %v (original: %v)", restoreErr, err)
+			})
 		}
-		op.state.Stage = StageRestored
+		op.state.update(func(s *OperationState) { s.Stage = StageRestored })
 	}
 }
 
@@ -78,36 +246,43 @@ const (
 	OpCopy
 	OpDelete
 	OpRename
+	OpCompress // pack Sources into the archive Dest
+	OpExtract  // unpack the archive Source into the new directory Dest
 	MaxRetries = 3
 )
 
 // ValidatePermissions checks if we have required permissions for the operation
 func ValidatePermissions(op FileOperation) error {
-	// Check source permissions
-	_, err := os.Stat(op.Source)
-	if err != nil {
-		return fmt.Errorf("cannot access source: %w", err)
-	}
+	fsys := op.fsys()
+
+	for _, source := range op.sources() {
+		// Check source permissions
+		_, err := fsys.Stat(source)
+		if err != nil {
+			return fmt.Errorf("cannot access source: %w", err)
+		}
 
-	// For all operations, need read permission on source
-	if err := unix.Access(op.Source, unix.R_OK); err != nil {
-		return fmt.Errorf("no read permission on source: %w", err)
+		// For all operations, need read permission on source
+		if err := fsys.Access(source, AccessRead); err != nil {
+			return fmt.Errorf("no read permission on source: %w", err)
+		}
 	}
 
 	// For delete/move operations, need write permission on source parent
 	if op.Type == OpDelete || op.Type == OpMove || op.Type == OpRename {
 		sourceParent := filepath.Dir(op.Source)
-		if err := unix.Access(sourceParent, unix.W_OK); err != nil {
+		if err := fsys.Access(sourceParent, AccessWrite); err != nil {
 			return fmt.Errorf("no write permission on source directory: %w", err)
 		}
 	}
 
-	// For move/copy operations, check destination
-	if op.Type == OpMove || op.Type == OpCopy {
+	// For operations that create Dest, check destination
+	if op.Type == OpMove || op.Type == OpCopy || op.Type == OpCompress || op.Type == OpExtract {
+		fsys := op.destFsys()
 		destParent := filepath.Dir(op.Dest)
 		
 		// Check if destination parent exists
-		if _, err := os.Stat(destParent); err != nil {
+		if _, err := fsys.Stat(destParent); err != nil {
 			if os.IsNotExist(err) {
 				return fmt.Errorf("destination directory does not exist")
 			}
@@ -115,13 +290,16 @@ func ValidatePermissions(op FileOperation) error {
 		}
 
 		// Check write permission on destination
-		if err := unix.Access(destParent, unix.W_OK); err != nil {
+		if err := fsys.Access(destParent, AccessWrite); err != nil {
 			return fmt.Errorf("no write permission on destination directory: %w", err)
 		}
 
-		// Check for destination collision
-		if _, err := os.Stat(op.Dest); err == nil {
-			return fmt.Errorf("destination already exists")
+		// Check for destination collision; a move or copy with a conflict
+		// policy resolves it once validated
+		if _, err := fsys.Stat(op.Dest); err == nil {
+			if op.conflicts == nil || op.Type == OpCompress || op.Type == OpExtract {
+				return errDestinationExists
+			}
 		} else if !os.IsNotExist(err) {
 			return fmt.Errorf("cannot check destination: %w", err)
 		}
@@ -130,32 +308,66 @@ func ValidatePermissions(op FileOperation) error {
 	return nil
 }
 // createBackup creates a backup of the file/directory being operated on
-func createBackup(path string) (string, error) {
+func createBackup(fsys FS, path string) (string, error) {
 	backupPath := fmt.Sprintf("%s.bak.%d", path, time.Now().UnixNano())
-	if err := CopyFile(path, backupPath); err != nil {
+	if err := CopyFile(fsys, path, backupPath); err != nil {
 		return "", fmt.Errorf("failed to create backup: %w", err)
 	}
 	return backupPath, nil
 }
 
 // restoreBackup restores from backup and cleans up
-func restoreBackup(backupPath, originalPath string) error {
-	if err := os.RemoveAll(originalPath); err != nil {
+func restoreBackup(fsys FS, backupPath, originalPath string) error {
+	if err := fsys.RemoveAll(originalPath); err != nil {
 		return fmt.Errorf("failed to remove failed operation result: %w", err)
 	}
-	if err := os.Rename(backupPath, originalPath); err != nil {
+	if err := fsys.Rename(backupPath, originalPath); err != nil {
 		return fmt.Errorf("failed to restore from backup: %w", err)
 	}
 	return nil
 }
 
-// retryOperation attempts an operation with retries
-func retryOperation(op func() error) error {
+// errSourceKept is a move across devices whose copy is complete but whose
+// source could not all be removed. Another attempt would copy over the copy.
+var errSourceKept = errors.New("moved, but the source could not be removed")
+
+// permanentErrors are failures another attempt cannot fix
+var permanentErrors = []error{
+	fs.ErrNotExist, fs.ErrExist, fs.ErrPermission, errors.ErrUnsupported,
+	syscall.EXDEV, syscall.ENOTDIR, syscall.EISDIR, syscall.EROFS,
+	syscall.ENAMETOOLONG, syscall.ELOOP, syscall.EINVAL, errDestinationExists,
+	errSourceKept,
+}
+
+// isPermanent reports whether err is a failure retrying cannot fix, as opposed
+// to a transient one such as a busy file or a dropped connection
+func isPermanent(err error) bool {
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryOperation attempts an operation with retries, giving up early once ctx
+// is canceled or the operation fails in a way retrying cannot fix
+func retryOperation(ctx context.Context, op func() error) error {
 	var lastErr error
 	for i := 0; i < MaxRetries; i++ {
 		if err := op(); err != nil {
 			lastErr = err
-			time.Sleep(time.Second * time.Duration(i+1))
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isPermanent(err) {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second * time.Duration(i+1)):
+			}
 			continue
 		}
 		return nil
@@ -169,193 +381,455 @@ func ExecuteFileOperation(op FileOperation) error {
 		return fmt.Errorf("no file selected for operation")
 	}
 
+	if op.ctx == nil {
+		op.ctx = context.Background()
+	}
+
 	// Start progress tracking
-	op.state.Stage = StageInit
-	op.state.Progress = 0
+	op.state.update(func(s *OperationState) {
+		s.Stage = StageInit
+		s.Progress = 0
+	})
 
 	// Validate permissions before attempting operation
 	if err := ValidatePermissions(op); err != nil {
-		op.state.Stage = StageFailed
-		op.state.LastError = err
+		op.state.update(func(s *OperationState) {
+			s.Stage = StageFailed
+			s.LastError = err
+		})
 		return fmt.Errorf("permission check failed: %w", err)
 	}
-	op.state.Stage = StageValidated
-	op.state.Progress = 25
+	op.state.update(func(s *OperationState) {
+		s.Stage = StageValidated
+		s.Progress = 25
+	})
 
-	// Create backup for destructive operations
+	// An existing destination is resolved before anything changes, which may
+	// mean asking the user
+	if op.Type == OpMove || op.Type == OpCopy {
+		settled, skipped, err := op.settleDestination()
+		if err != nil {
+			op.state.update(func(s *OperationState) {
+				s.Stage = StageFailed
+				s.LastError = err
+			})
+			return err
+		}
+		if skipped {
+			op.state.update(func(s *OperationState) {
+				s.Stage = StageCompleted
+				s.Progress = 100
+			})
+			return nil
+		}
+		op = settled
+	}
+
+	// Create backup for destructive operations. A move across devices copies
+	// the source and keeps it until the copy is verified, so it needs none.
 	var backup string
 	var err error
-	if op.Type == OpMove || op.Type == OpDelete || op.Type == OpRename {
-		backup, err = createBackup(op.Source)
+	if op.Type == OpDelete || op.Type == OpRename || op.Type == OpMove && !op.acrossDevices() {
+		backup, err = createBackup(op.fsys(), op.Source)
 		if err != nil {
-			op.state.Stage = StageFailed
-			op.state.LastError = err
+			op.state.update(func(s *OperationState) {
+				s.Stage = StageFailed
+				s.LastError = err
+			})
 			return err
 		}
-		op.state.BackupPath = backup
-		op.state.Stage = StageBackedUp
-		op.state.Progress = 50
-		defer os.Remove(backup)
+		op.state.update(func(s *OperationState) {
+			s.BackupPath = backup
+			s.Stage = StageBackedUp
+			s.Progress = 50
+		})
+		defer op.fsys().RemoveAll(backup)
 	}
 
-	op.state.Stage = StageExecuting
-	op.state.Progress = 75
-
-	// Execute operation with retries and progress updates
-	err = retryOperation(func() error {
-		op.state.RetryCount++
-		return executeWithProgress(op)
+	op.state.update(func(s *OperationState) {
+		s.Stage = StageExecuting
+		s.Progress = 75
 	})
 
+	// Execute operation with retries and progress updates. Archives clean up
+	// after a failure, which is then reported rather than retried, and a merge
+	// would meet its own partial result as conflicts on another attempt.
+	if op.Type == OpCompress || op.Type == OpExtract || op.merge {
+		op.state.update(func(s *OperationState) { s.RetryCount++ })
+		err = executeWithProgress(op)
+	} else {
+		err = retryOperation(op.ctx, func() error {
+			op.state.update(func(s *OperationState) {
+				s.RetryCount++
+				// Each attempt walks the tree afresh
+				s.ItemsDone, s.ItemsTotal, s.BytesDone, s.BytesTotal = 0, 0, 0, 0
+			})
+			return executeWithProgress(op)
+		})
+	}
+
 	if err != nil {
+		if op.Type == OpCopy && !op.merge && errors.Is(err, context.Canceled) {
+			// The destination did not exist before the copy, or an overwrite set
+			// it aside to be put back, so the partial result is all this removes
+			op.destFsys().RemoveAll(op.Dest)
+		}
 		handleOperationError(op, err, backup)
 		return err
 	}
+	op.conflicts.discardSetAside(op.destFsys())
 
-	op.state.Stage = StageCompleted
-	op.state.Progress = 100
+	op.state.update(func(s *OperationState) {
+		s.Stage = StageCompleted
+		s.Progress = 100
+	})
 	return nil
 }
 
 func executeWithProgress(op FileOperation) error {
+	fsys := op.fsys()
 	switch op.Type {
 	case OpMove:
-		return os.Rename(op.Source, op.Dest)
+		if op.merge {
+			return mergeMove(op, op.Source, op.Dest)
+		}
+		return moveItem(op)
 	case OpCopy:
 		return CopyFileWithProgress(op)
 	case OpDelete:
 		if op.Selected.isDir {
-			return os.RemoveAll(op.Source)
+			return removeTree(op)
 		}
-		return os.Remove(op.Source)
+		return fsys.Remove(op.Source)
 	case OpRename:
-		return os.Rename(op.Source, op.Dest)
+		return fsys.Rename(op.Source, op.Dest)
+	case OpCompress:
+		return CreateArchive(op)
+	case OpExtract:
+		return ExtractArchive(op)
 	default:
 		return fmt.Errorf("unsupported file operation type: %v", op.Type)
 	}
 }
 
-// CopyFileWithProgress copies a file from source to destination with progress tracking
-func CopyFileWithProgress(op FileOperation) error {
-	sourceInfo, err := os.Stat(op.Source)
+// moveItem moves op.Source to op.Dest, which does not exist, by renaming it
+// or, across devices, by copying it
+func moveItem(op FileOperation) error {
+	var err error
+	if op.crossFS() {
+		err = &os.LinkError{Op: "rename", Old: op.Source, New: op.Dest, Err: syscall.EXDEV}
+	} else {
+		err = op.fsys().Rename(op.Source, op.Dest)
+	}
+	if errors.Is(err, syscall.EXDEV) {
+		return moveAcrossDevices(op)
+	}
+	return err
+}
+
+// mergeMove moves the contents of the directory src into the existing
+// directory dst one item at a time, resolving each conflict. src is removed
+// once empty; items that were skipped keep it.
+func mergeMove(op FileOperation, src, dst string) error {
+	entries, err := op.fsys().ReadDir(src)
 	if err != nil {
 		return err
 	}
-
-	if sourceInfo.IsDir() {
-		return CopyDirWithProgress(op)
+	for _, entry := range entries {
+		if err := op.canceled(); err != nil {
+			return err
+		}
+		item := op
+		item.Source, item.Dest, item.merge = filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), false
+		item, skipped, err := item.settleDestination()
+		if err != nil {
+			return err
+		}
+		switch {
+		case skipped:
+			continue
+		case item.merge:
+			err = mergeMove(item, item.Source, item.Dest)
+		default:
+			err = moveItem(item)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	totalSize := sourceInfo.Size()
-	source, err := os.Open(op.Source)
+	info, err := op.fsys().Stat(src)
 	if err != nil {
 		return err
 	}
-	defer source.Close()
+	op.preserveMetadata(src, info, dst)
+	if err := op.fsys().Remove(src); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
 
-	dest, err := os.Create(op.Dest)
+// moveAcrossDevices moves op.Source to a filesystem it cannot be renamed onto.
+// It copies the source, keeping symlinks as they are like mv, checks that the
+// copy is complete and only then removes the source. A failed copy is removed
+// again, so the source is left as it was. Once the copy is verified it is
+// never removed: only removing the source is retried, and if that still
+// fails the move stops with both in place.
+func moveAcrossDevices(op FileOperation) error {
+	info, err := op.fsys().Lstat(op.Source)
 	if err != nil {
 		return err
 	}
-	defer dest.Close()
+	if info.IsDir() {
+		err = copyTree(op, info)
+	} else {
+		op.state.addWork(1, info.Size())
+		err = op.copyFile(op.context(), op.Source, info, op.Dest)
+	}
+	if err == nil {
+		err = verifyCopy(op)
+	}
+	if err != nil {
+		op.destFsys().RemoveAll(op.Dest)
+		return err
+	}
 
-	buf := make([]byte, 32*1024)
-	var bytesWritten int64
+	err = retryOperation(op.context(), func() error {
+		if info.IsDir() {
+			return removeTree(op)
+		}
+		if err := op.fsys().Remove(op.Source); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSourceKept, err)
+	}
+	return nil
+}
 
-	for {
-		n, err := source.Read(buf)
-		if n > 0 {
-			_, writeErr := dest.Write(buf[:n])
-			if writeErr != nil {
-				return writeErr
-			}
-			bytesWritten += int64(n)
-			op.state.Progress = float64(bytesWritten) / float64(totalSize) * 100
+// verifyCopy checks that op.Dest holds everything below op.Source, with the
+// same type and, for files, the same size and contents
+func verifyCopy(op FileOperation) error {
+	dstFs := op.destFsys()
+	return Walk(op.fsys(), op.Source, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := op.canceled(); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(op.Source, path)
+		dst := filepath.Join(op.Dest, rel)
+		copied, err := dstFs.Lstat(dst)
+		if err != nil {
+			return fmt.Errorf("copy is incomplete: %w", err)
+		}
+		if copied.Mode().Type() != info.Mode().Type() || info.Mode().IsRegular() && copied.Size() != info.Size() {
+			return fmt.Errorf("copy of %s does not match: %v, %d bytes, want %v, %d bytes",
+				path, copied.Mode().Type(), copied.Size(), info.Mode().Type(), info.Size())
 		}
-		if err == io.EOF {
-			break
+		if !info.Mode().IsRegular() {
+			return nil
 		}
+		want, err := op.checksum(op.fsys(), path)
 		if err != nil {
 			return err
 		}
-	}
+		got, err := op.checksum(dstFs, dst)
+		if err != nil {
+			return fmt.Errorf("copy is incomplete: %w", err)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("copy of %s does not match: contents differ", path)
+		}
+		return nil
+	})
+}
 
-	return nil
+// checksum hashes the contents of the file path on fsys with SHA-256
+func (op FileOperation) checksum(fsys FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if err := copyBuffered(op.context(), hash, f, func(int64) {}); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
 }
 
-// CopyFile copies a file from source to destination
-func CopyFile(src, dst string) error {
-	sourceInfo, err := os.Stat(src)
+// CopyFileWithProgress copies a file from source to destination with progress tracking
+func CopyFileWithProgress(op FileOperation) error {
+	sourceInfo, err := op.fsys().Stat(op.Source)
 	if err != nil {
 		return err
 	}
 
 	if sourceInfo.IsDir() {
-		return CopyDir(src, dst)
+		return CopyDirWithProgress(op)
 	}
 
-	input, err := os.ReadFile(src)
+	op.state.addWork(1, sourceInfo.Size())
+	return op.copyFile(op.context(), op.Source, sourceInfo, op.Dest)
+}
+
+// copyFile copies the file src, described by info, to dst and its metadata
+// after it, adding to the progress of the operation as the data is written
+func (op FileOperation) copyFile(ctx context.Context, src string, info os.FileInfo, dst string) error {
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return op.copySymlink(src, dst)
+	}
+
+	source, err := op.fsys().Open(src)
 	if err != nil {
 		return err
 	}
+	defer source.Close()
 
-	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	// Without the mode preserved, a new file gets the source's mode less the umask, like cp
+	dest, err := op.destFsys().Create(dst, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
+	defer dest.Close()
 
-	return os.WriteFile(dst, input, sourceInfo.Mode())
-}
-// CopyDir recursively copies a directory
-func CopyDir(src, dst string) error {
-	srcInfo, err := os.Stat(src)
+	err = copyContents(ctx, dest, source, func(n int64) { op.state.addDone(0, n) })
 	if err != nil {
 		return err
 	}
 
-	err = os.MkdirAll(dst, srcInfo.Mode())
+	// Close before setting the times, which later writes would change
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	op.preserveMetadata(src, info, dst)
+	op.state.addDone(1, 0)
+	return nil
+}
+
+// copySymlink recreates the symlink src as dst. Its metadata stays behind,
+// since changing it through the FS would change what the link points to. A
+// link an earlier attempt already made is kept, so a retried copy can pass it.
+func (op FileOperation) copySymlink(src, dst string) error {
+	target, err := op.fsys().Readlink(src)
 	if err != nil {
 		return err
 	}
+	if err := op.destFsys().Symlink(target, dst); err != nil {
+		if existing, readErr := op.destFsys().Readlink(dst); readErr != nil || existing != target {
+			return err
+		}
+	}
+	op.state.addDone(1, 0)
+	return nil
+}
 
-	entries, err := os.ReadDir(src)
+// CopyFile copies a file from source to destination within fsys
+func CopyFile(fsys FS, src, dst string) error {
+	sourceInfo, err := fsys.Stat(src)
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+	if sourceInfo.IsDir() {
+		return CopyDir(fsys, src, dst)
+	}
 
-		if entry.IsDir() {
-			err = CopyDir(srcPath, dstPath)
-			if err != nil {
-				return err
-			}
-		} else {
-			err = CopyFile(srcPath, dstPath)
-			if err != nil {
-				return err
-			}
-		}
+	err = fsys.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
 	}
 
+	source, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	dest, err := fsys.Create(dst, sourceInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	if err := copyContents(context.Background(), dest, source, nil); err != nil {
+		return err
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	// Backups keep what they can, since they are renamed back over the original
+	PreserveMetadata(fsys, src, sourceInfo, fsys, dst, DefaultPreserveOptions())
 	return nil
 }
+// CopyDir recursively copies a directory within fsys
+func CopyDir(fsys FS, src, dst string) error {
+	srcInfo, err := fsys.Stat(src)
+	if err != nil {
+		return err
+	}
+	// Backups keep what they can, since they are renamed back over the original
+	op := NewFileOperation(OpCopy, src, dst, nil)
+	op.fs = fsys
+	return copyTree(op, srcInfo)
+}
+
+// guiEditors open their own window, so they run detached instead of taking over the terminal
+var guiEditors = map[string]bool{
+	"code": true, "code-insiders": true, "codium": true, "cursor": true, "zed": true,
+	"subl": true, "atom": true, "mate": true, "gedit": true, "kate": true,
+	"gvim": true, "mvim": true, "idea": true, "open": true, "xdg-open": true,
+}
+
+// EditorCommand builds the command that opens path in editor. The editor may
+// include arguments, such as "code --reuse-window".
+func EditorCommand(editor, path string) (*exec.Cmd, error) {
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no editor configured")
+	}
+	return exec.Command(fields[0], append(fields[1:], path)...), nil
+}
+
+// IsGUIEditor reports whether editor opens its own window rather than running in the terminal
+func IsGUIEditor(editor string) bool {
+	fields := strings.Fields(editor)
+	return len(fields) > 0 && guiEditors[filepath.Base(fields[0])]
+}
 
-// LaunchEditor launches the user's preferred editor
+// LaunchEditor starts a GUI editor detached from the terminal and does not wait for it.
+// Terminal editors must instead run through tea.ExecProcess.
 func LaunchEditor(editor, path string) error {
-	cmd := exec.Command(editor, path)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Start()
+	cmd, err := EditorCommand(editor, path)
+	if err != nil {
+		return err
+	}
+	return StartDetached(cmd)
 }
 
-// ChangeShellDirectory writes a command to change the shell's directory
-func ChangeShellDirectory(dir string) error {
+// StartDetached starts cmd without a terminal and does not wait for it
+func StartDetached(cmd *exec.Cmd) error {
+	// Start a new session so the editor survives the app and ignores its signals
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the process when it exits
+	go cmd.Wait()
+	return nil
+}
+
+// ChangeShellDirectory writes dir to the per-session file the shell wrapper
+// reads after modaltree exits to change the shell's directory
+func ChangeShellDirectory(lastDirFile, dir string) error {
+	if lastDirFile == "" {
+		return fmt.Errorf("shell integration is not set up; see modaltree init --help")
+	}
+
 	// create or truncate the file
-	f, err := os.Create("/tmp/modaltree_lastdir")
+	f, err := os.OpenFile(lastDirFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
@@ -372,57 +846,12 @@ type OperationProgress struct {
     Progress float64
 }
 
-// Add to existing code
+// CopyDirWithProgress copies the directory op.Source to op.Dest through a
+// tree pipeline, so many files are copied at once
 func CopyDirWithProgress(op FileOperation) error {
-    // Get total items to process
-    var totalItems int
-    filepath.Walk(op.Source, func(path string, info os.FileInfo, err error) error {
-        totalItems++
-        return nil
-    })
-
-    itemsProcessed := 0
-
-    srcInfo, err := os.Stat(op.Source)
-    if err != nil {
-        return err
-    }
-
-    err = os.MkdirAll(op.Dest, srcInfo.Mode())
-    if err != nil {
-        return err
-    }
-
-    entries, err := os.ReadDir(op.Source)
-    if err != nil {
-        return err
-    }
-
-    for _, entry := range entries {
-        srcPath := filepath.Join(op.Source, entry.Name())
-        dstPath := filepath.Join(op.Dest, entry.Name())
-
-        if entry.IsDir() {
-            subOp := op
-            subOp.Source = srcPath
-            subOp.Dest = dstPath
-            err = CopyDirWithProgress(subOp)
-        } else {
-            err = CopyFileWithProgress(FileOperation{
-                Type: OpCopy,
-                Source: srcPath,
-                Dest: dstPath,
-                state: op.state,
-            })
-        }
-
-        if err != nil {
-            return err
-        }
-
-        itemsProcessed++
-        op.state.Progress = float64(itemsProcessed) / float64(totalItems) * 100
-    }
-
-    return nil
+	srcInfo, err := op.fsys().Stat(op.Source)
+	if err != nil {
+		return err
+	}
+	return copyTree(op, srcInfo)
 }
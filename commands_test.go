@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// memOperation builds an operation on fsys for the item at source
+func memOperation(t *testing.T, fsys FS, opType OperationType, source, dest string) FileOperation {
+	t.Helper()
+	info, err := fsys.Lstat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := &FileItem{path: source, name: info.Name(), isDir: info.IsDir(), mode: info.Mode()}
+	op := NewFileOperation(opType, source, dest, item)
+	op.fs = fsys
+	return op
+}
+
+func memProject(t *testing.T) *MemFS {
+	t.Helper()
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/w/src/pkg", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("/w/out", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/w/src/a.txt", []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/w/src/pkg/b.txt", []byte("beta"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+func TestExecuteCopyOnMemFS(t *testing.T) {
+	fsys := memProject(t)
+	op := memOperation(t, fsys, OpCopy, "/w/src", "/w/out/src")
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fsys, "/w/out/src/pkg/b.txt"); err != nil || string(data) != "beta" {
+		t.Errorf("got %q, %v in the copy", data, err)
+	}
+	if _, err := fsys.Stat("/w/src/a.txt"); err != nil {
+		t.Errorf("expected the source to remain: %v", err)
+	}
+	if snapshot := op.state.Snapshot(); snapshot.Stage != StageCompleted || snapshot.Progress != 100 {
+		t.Errorf("unexpected final state %v at %v%%", snapshot.Stage, snapshot.Progress)
+	}
+}
+
+func TestExecuteMoveRenameDeleteOnMemFS(t *testing.T) {
+	fsys := memProject(t)
+
+	if err := ExecuteFileOperation(memOperation(t, fsys, OpMove, "/w/src/a.txt", "/w/out/a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExecuteFileOperation(memOperation(t, fsys, OpRename, "/w/src/pkg", "/w/src/lib")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fsys, "/w/src/lib/b.txt"); err != nil || string(data) != "beta" {
+		t.Errorf("got %q, %v after the rename", data, err)
+	}
+	if err := ExecuteFileOperation(memOperation(t, fsys, OpDelete, "/w/src", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := fsys.ReadDir("/w")
+	if len(entries) != 1 || entries[0].Name() != "out" {
+		t.Errorf("expected only out to remain, and no backups, got %v", entries)
+	}
+	if data, err := ReadFile(fsys, "/w/out/a.txt"); err != nil || string(data) != "alpha" {
+		t.Errorf("got %q, %v after the move", data, err)
+	}
+}
+
+func TestValidatePermissionsOnMemFS(t *testing.T) {
+	fsys := memProject(t)
+
+	if err := ExecuteFileOperation(memOperation(t, fsys, OpCopy, "/w/src/a.txt", "/w/src/pkg/b.txt")); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected a collision error, got %v", err)
+	}
+	if err := ExecuteFileOperation(memOperation(t, fsys, OpCopy, "/w/src/a.txt", "/w/none/a.txt")); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a missing destination error, got %v", err)
+	}
+
+	if err := fsys.Chmod("/w/out", 0555); err != nil {
+		t.Fatal(err)
+	}
+	err := ExecuteFileOperation(memOperation(t, fsys, OpMove, "/w/src/a.txt", "/w/out/a.txt"))
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+	if _, err := fsys.Stat("/w/src/a.txt"); err != nil {
+		t.Errorf("expected the source to be untouched: %v", err)
+	}
+}
+
+// exdevFS is a MemFS with another device mounted at mount, which renames
+// cannot cross, and on which the file readOnly cannot be created
+type exdevFS struct {
+	*MemFS
+	mount, readOnly string
+}
+
+func (e exdevFS) Rename(oldname, newname string) error {
+	if strings.HasPrefix(oldname, e.mount+"/") != strings.HasPrefix(newname, e.mount+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return e.MemFS.Rename(oldname, newname)
+}
+
+func (e exdevFS) Create(name string, perm fs.FileMode) (File, error) {
+	if name == e.readOnly {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+	return e.MemFS.Create(name, perm)
+}
+
+func TestMoveAcrossDevices(t *testing.T) {
+	fsys := exdevFS{MemFS: memProject(t), mount: "/w/out"}
+	if err := fsys.Symlink("../a.txt", "/w/src/pkg/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	op := memOperation(t, fsys, OpMove, "/w/src", "/w/out/src")
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fsys, "/w/out/src/pkg/b.txt"); err != nil || string(data) != "beta" {
+		t.Errorf("got %q, %v after the move", data, err)
+	}
+	if target, err := fsys.Readlink("/w/out/src/pkg/link"); err != nil || target != "../a.txt" {
+		t.Errorf("expected the symlink to be kept, got %q, %v", target, err)
+	}
+	if _, err := fsys.Lstat("/w/src"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the source to be removed, got %v", err)
+	}
+	snapshot := op.state.Snapshot()
+	if snapshot.RetryCount != 1 || snapshot.BytesDone != int64(len("alpha")+len("beta")) {
+		t.Errorf("got %d attempts and %d bytes of progress", snapshot.RetryCount, snapshot.BytesDone)
+	}
+}
+
+func TestMoveBetweenFilesystemsMakesNoBackup(t *testing.T) {
+	fsys, dest := memProject(t), NewMemFS()
+	if err := dest.MkdirAll("/w", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	op := memOperation(t, fsys, OpMove, "/w/src", "/w/src")
+	op.destFs = dest
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if backup := op.state.Snapshot().BackupPath; backup != "" {
+		t.Errorf("expected the source to be copied only once, got a backup at %s", backup)
+	}
+	if data, err := ReadFile(dest, "/w/src/pkg/b.txt"); err != nil || string(data) != "beta" {
+		t.Errorf("got %q, %v after the move", data, err)
+	}
+}
+
+func TestMoveAcrossDevicesKeepsSourceOnFailure(t *testing.T) {
+	fsys := exdevFS{MemFS: memProject(t), mount: "/w/out", readOnly: "/w/out/src/pkg/b.txt"}
+
+	op := memOperation(t, fsys, OpMove, "/w/src", "/w/out/src")
+	if err := ExecuteFileOperation(op); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("expected a read-only destination to fail the move, got %v", err)
+	}
+	if _, err := fsys.Stat("/w/out/src"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the partial copy to be removed, got %v", err)
+	}
+	if _, err := fsys.Stat("/w/src/a.txt"); err != nil {
+		t.Errorf("expected the source to be kept: %v", err)
+	}
+	if attempts := op.state.Snapshot().RetryCount; attempts != 1 {
+		t.Errorf("expected a permanent failure not to be retried, got %d attempts", attempts)
+	}
+}
+
+// stuckFS is a MemFS on which removing stuck fails with errno the first
+// *failures times
+type stuckFS struct {
+	*MemFS
+	stuck    string
+	errno    syscall.Errno
+	failures *int
+}
+
+func (s stuckFS) Remove(name string) error {
+	if name == s.stuck && *s.failures > 0 {
+		*s.failures--
+		return &fs.PathError{Op: "remove", Path: name, Err: s.errno}
+	}
+	return s.MemFS.Remove(name)
+}
+
+func TestMoveAcrossDevicesRetriesOnlyRemovingTheSource(t *testing.T) {
+	failures := 1
+	fsys, dest := stuckFS{MemFS: memProject(t), stuck: "/w/src/pkg", errno: syscall.EBUSY, failures: &failures}, NewMemFS()
+	if err := fsys.Symlink("../a.txt", "/w/src/pkg/link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.MkdirAll("/w", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	op := memOperation(t, fsys, OpMove, "/w/src", "/w/src")
+	op.destFs = dest
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(dest, "/w/src/pkg/b.txt"); err != nil || string(data) != "beta" {
+		t.Errorf("got %q, %v after the move", data, err)
+	}
+	if target, err := dest.Readlink("/w/src/pkg/link"); err != nil || target != "../a.txt" {
+		t.Errorf("expected the symlink to be kept, got %q, %v", target, err)
+	}
+	if _, err := fsys.Lstat("/w/src"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the source to be removed, got %v", err)
+	}
+	if attempts := op.state.Snapshot().RetryCount; attempts != 1 {
+		t.Errorf("expected the copy to be made once, got %d attempts", attempts)
+	}
+}
+
+func TestMoveAcrossDevicesKeepsCopyWhenSourceStays(t *testing.T) {
+	failures := 1
+	fsys, dest := stuckFS{MemFS: memProject(t), stuck: "/w/src/a.txt", errno: syscall.EACCES, failures: &failures}, NewMemFS()
+	if err := dest.MkdirAll("/w", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	op := memOperation(t, fsys, OpMove, "/w/src", "/w/src")
+	op.destFs = dest
+	err := ExecuteFileOperation(op)
+	if !errors.Is(err, errSourceKept) || !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("expected the source that cannot be removed to stop the move, got %v", err)
+	}
+	if data, err := ReadFile(dest, "/w/src/a.txt"); err != nil || string(data) != "alpha" {
+		t.Errorf("expected the complete copy to be kept, got %q, %v", data, err)
+	}
+	if data, err := ReadFile(fsys, "/w/src/a.txt"); err != nil || string(data) != "alpha" {
+		t.Errorf("expected the file to stay in the source, got %q, %v", data, err)
+	}
+	if attempts := op.state.Snapshot().RetryCount; attempts != 1 {
+		t.Errorf("expected the copy to be made once, got %d attempts", attempts)
+	}
+}
+
+func TestCopySymlinkKeepsLinkFromEarlierAttempt(t *testing.T) {
+	fsys := memProject(t)
+	if err := fsys.Symlink("a.txt", "/w/src/link"); err != nil {
+		t.Fatal(err)
+	}
+	op := memOperation(t, fsys, OpCopy, "/w/src/link", "/w/out/link")
+
+	// A copy retried after a full disk meets the links it already made
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := op.copySymlink("/w/src/link", "/w/out/link"); err != nil {
+			t.Fatalf("attempt %d: %v", attempt, err)
+		}
+	}
+	if target, err := fsys.Readlink("/w/out/link"); err != nil || target != "a.txt" {
+		t.Errorf("got %q, %v for the copied link", target, err)
+	}
+
+	if err := fsys.Symlink("pkg", "/w/out/other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.copySymlink("/w/src/link", "/w/out/other"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected a different link in the way to fail the copy, got %v", err)
+	}
+}
+
+func TestVerifyCopy(t *testing.T) {
+	fsys := memProject(t)
+	op := memOperation(t, fsys, OpCopy, "/w/src", "/w/out/src")
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCopy(op); err != nil {
+		t.Fatalf("expected the copy to match: %v", err)
+	}
+
+	if err := WriteFile(fsys, "/w/out/src/pkg/b.txt", []byte("bet"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCopy(op); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected a truncated file to be caught, got %v", err)
+	}
+	if err := WriteFile(fsys, "/w/out/src/pkg/b.txt", []byte("BETA"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCopy(op); err == nil || !strings.Contains(err.Error(), "contents differ") {
+		t.Errorf("expected a changed file of the same size to be caught, got %v", err)
+	}
+	if err := fsys.Remove("/w/out/src/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCopy(op); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing file to be caught, got %v", err)
+	}
+}
+
+func TestRetryOperationClassifiesErrors(t *testing.T) {
+	for _, err := range []error{
+		&os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.EXDEV},
+		&fs.PathError{Op: "open", Path: "/a", Err: syscall.EACCES},
+		&fs.PathError{Op: "stat", Path: "/a", Err: syscall.ENOENT},
+		fs.ErrPermission,
+	} {
+		attempts := 0
+		got := retryOperation(context.Background(), func() error {
+			attempts++
+			return err
+		})
+		if attempts != 1 || got != err {
+			t.Errorf("%v: got %d attempts and %v, want one attempt", err, attempts, got)
+		}
+	}
+
+	// A busy file may be free and a full disk may have room by the next attempt
+	for _, errno := range []syscall.Errno{syscall.EBUSY, syscall.ENOSPC} {
+		attempts := 0
+		err := retryOperation(context.Background(), func() error {
+			attempts++
+			if attempts == 1 {
+				return &fs.PathError{Op: "write", Path: "/a", Err: errno}
+			}
+			return nil
+		})
+		if err != nil || attempts != 2 {
+			t.Errorf("%v: got %d attempts and %v, want a successful retry", errno, attempts, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// completionShells lists the shells "modaltree completion" writes scripts for
+var completionShells = []string{"bash", "fish", "zsh"}
+
+// completionCommand is a command as the completion scripts see it; the TUI itself has no name
+type completionCommand struct {
+	name    string
+	summary string
+	flags   []*flag.Flag
+	args    argKind
+	choices []string
+}
+
+// completionCommands collects the flag definitions of the TUI and every subcommand
+func completionCommands() []completionCommand {
+	var opts CLIOptions
+	commands := []completionCommand{{flags: definedFlags(newRootFlagSet(&opts, io.Discard)), args: argFile}}
+	for _, cmd := range subcommands() {
+		commands = append(commands, completionCommand{
+			name:    cmd.name,
+			summary: cmd.summary,
+			flags:   definedFlags(cmd.flags(io.Discard)),
+			args:    cmd.args,
+			choices: cmd.choices,
+		})
+	}
+	return commands
+}
+
+// definedFlags lists the flags of a flag set in name order
+func definedFlags(flags *flag.FlagSet) []*flag.Flag {
+	var defined []*flag.Flag
+	flags.VisitAll(func(f *flag.Flag) {
+		defined = append(defined, f)
+	})
+	return defined
+}
+
+// flagCompletion describes the value a flag takes: none for booleans, a fixed
+// set of choices, a path, or free text
+func flagCompletion(f *flag.Flag) (takesValue bool, choices []string, path bool) {
+	switch value := f.Value.(type) {
+	case choiceFlag:
+		return true, value.choices, false
+	case pathFlag:
+		return true, nil, true
+	case interface{ IsBoolFlag() bool }:
+		if value.IsBoolFlag() {
+			return false, nil, false
+		}
+	}
+	return true, nil, false
+}
+
+// CompletionScript returns the completion script for shell
+func CompletionScript(shell string) (string, error) {
+	commands := completionCommands()
+	switch shell {
+	case "bash":
+		return bashCompletion(commands), nil
+	case "fish":
+		return fishCompletion(commands), nil
+	case "zsh":
+		return zshCompletion(commands), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q: must be one of %s", shell, strings.Join(completionShells, ", "))
+}
+
+// commandNames lists the subcommand names in commands
+func commandNames(commands []completionCommand) []string {
+	var names []string
+	for _, cmd := range commands {
+		if cmd.name != "" {
+			names = append(names, cmd.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bashCompletion(commands []completionCommand) string {
+	var b strings.Builder
+	b.WriteString(`# bash completion for modaltree, generated by "modaltree completion bash"
+_modaltree() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd=""
+    # COMP_WORDBREAKS splits --flag=value at the "="
+    if [[ $cur == "=" ]]; then
+        cur=""
+    elif [[ $prev == "=" ]]; then
+        prev="${COMP_WORDS[COMP_CWORD-2]}"
+    fi
+    if (( COMP_CWORD > 1 )); then
+        case "${COMP_WORDS[1]}" in
+`)
+	fmt.Fprintf(&b, "            %s) cmd=\"${COMP_WORDS[1]}\" ;;\n", strings.Join(commandNames(commands), "|"))
+	b.WriteString(`        esac
+    fi
+
+    case "$cmd $prev" in
+`)
+	for _, cmd := range commands {
+		for _, f := range cmd.flags {
+			takesValue, choices, path := flagCompletion(f)
+			if !takesValue {
+				continue
+			}
+			reply := "COMPREPLY=()"
+			if path {
+				reply = `COMPREPLY=($(compgen -f -- "$cur"))`
+			} else if len(choices) > 0 {
+				reply = fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur"))`, strings.Join(choices, " "))
+			}
+			fmt.Fprintf(&b, "        \"%s -%s\"|\"%s --%s\") %s; return ;;\n", cmd.name, f.Name, cmd.name, f.Name, reply)
+		}
+	}
+	b.WriteString(`    esac
+
+    if [[ $cur == -* ]]; then
+        case "$cmd" in
+`)
+	for _, cmd := range commands {
+		var names []string
+		for _, f := range cmd.flags {
+			names = append(names, "--"+f.Name)
+		}
+		pattern := cmd.name
+		if pattern == "" {
+			pattern = `""`
+		}
+		fmt.Fprintf(&b, "            %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", pattern, strings.Join(names, " "))
+	}
+	b.WriteString(`        esac
+        return
+    fi
+
+    case "$cmd" in
+`)
+	for _, cmd := range commands {
+		var reply string
+		switch cmd.args {
+		case argNone:
+			reply = "COMPREPLY=()"
+		case argFile:
+			reply = `COMPREPLY=($(compgen -f -- "$cur"))`
+		case argDir:
+			reply = `COMPREPLY=($(compgen -d -- "$cur"))`
+		case argChoice:
+			reply = fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur"))`, strings.Join(cmd.choices, " "))
+		}
+		if cmd.name == "" {
+			// The first word may also be a command
+			reply += fmt.Sprintf("\n            if (( COMP_CWORD == 1 )); then\n                COMPREPLY+=($(compgen -W \"%s\" -- \"$cur\"))\n            fi", strings.Join(commandNames(commands), " "))
+			fmt.Fprintf(&b, "        \"\")\n            %s\n            ;;\n", reply)
+			continue
+		}
+		fmt.Fprintf(&b, "        %s) %s ;;\n", cmd.name, reply)
+	}
+	b.WriteString(`    esac
+}
+complete -o filenames -F _modaltree modaltree
+`)
+	return b.String()
+}
+
+// zshQuote escapes s for a description or value inside a single-quoted _arguments spec
+func zshQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `:`, `\:`, `'`, `'\''`).Replace(s)
+}
+
+// zshFlagSpecs returns the _arguments specs for flags
+func zshFlagSpecs(flags []*flag.Flag) []string {
+	var specs []string
+	for _, f := range flags {
+		takesValue, choices, path := flagCompletion(f)
+		spec := fmt.Sprintf("'--%s[%s]'", f.Name, zshQuote(f.Usage))
+		if takesValue {
+			action := " "
+			if path {
+				action = "_files"
+			} else if len(choices) > 0 {
+				action = "(" + strings.Join(choices, " ") + ")"
+			}
+			spec = fmt.Sprintf("'--%s=[%s]:%s:%s'", f.Name, zshQuote(f.Usage), f.Name, action)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func zshCompletion(commands []completionCommand) string {
+	var b strings.Builder
+	b.WriteString(`#compdef modaltree
+# zsh completion for modaltree, generated by "modaltree completion zsh"
+
+_modaltree() {
+    local context state state_descr line
+    typeset -A opt_args
+    local -a commands=(
+`)
+	for _, cmd := range commands {
+		if cmd.name != "" {
+			fmt.Fprintf(&b, "        '%s:%s'\n", cmd.name, zshQuote(cmd.summary))
+		}
+	}
+	b.WriteString(`    )
+
+    if (( CURRENT > 2 )); then
+        case $words[2] in
+`)
+	for _, cmd := range commands {
+		if cmd.name == "" {
+			continue
+		}
+		specs := zshFlagSpecs(cmd.flags)
+		switch cmd.args {
+		case argFile:
+			specs = append(specs, "'1:path:_files'")
+		case argDir:
+			specs = append(specs, "'1:directory:_files -/'")
+		case argChoice:
+			specs = append(specs, fmt.Sprintf("'1:%s:(%s)'", cmd.name, strings.Join(cmd.choices, " ")))
+		}
+		fmt.Fprintf(&b, "            %s)\n                shift words\n                (( CURRENT-- ))\n", cmd.name)
+		if len(specs) > 0 {
+			fmt.Fprintf(&b, "                _arguments \\\n                    %s\n", strings.Join(specs, " \\\n                    "))
+		}
+		b.WriteString("                return\n                ;;\n")
+	}
+	b.WriteString(`        esac
+    fi
+
+    _arguments \
+`)
+	for _, spec := range zshFlagSpecs(commands[0].flags) {
+		fmt.Fprintf(&b, "        %s \\\n", spec)
+	}
+	b.WriteString(`        '1: :->path'
+    if [[ $state == path ]]; then
+        _describe -t commands command commands
+        _files
+    fi
+}
+
+# Autoloaded from $fpath, or sourced with: source <(modaltree completion zsh)
+if [[ $funcstack[1] == _modaltree ]]; then
+    _modaltree "$@"
+else
+    compdef _modaltree modaltree
+fi
+`)
+	return b.String()
+}
+
+// fishQuote single-quotes s for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func fishCompletion(commands []completionCommand) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for modaltree, generated by \"modaltree completion fish\"\n")
+	b.WriteString("complete -c modaltree -f\n")
+	for _, cmd := range commands {
+		condition := "__fish_use_subcommand"
+		if cmd.name != "" {
+			fmt.Fprintf(&b, "complete -c modaltree -n __fish_use_subcommand -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+			condition = fishQuote("__fish_seen_subcommand_from " + cmd.name)
+		}
+		for _, f := range cmd.flags {
+			takesValue, choices, path := flagCompletion(f)
+			line := fmt.Sprintf("complete -c modaltree -n %s -l %s", condition, f.Name)
+			switch {
+			case path:
+				line += " -r -F"
+			case len(choices) > 0:
+				line += " -x -a " + fishQuote(strings.Join(choices, " "))
+			case takesValue:
+				line += " -x"
+			}
+			fmt.Fprintf(&b, "%s -d %s\n", line, fishQuote(f.Usage))
+		}
+		switch cmd.args {
+		case argFile:
+			fmt.Fprintf(&b, "complete -c modaltree -n %s -F\n", condition)
+		case argDir:
+			fmt.Fprintf(&b, "complete -c modaltree -n %s -a '(__fish_complete_directories)'\n", condition)
+		case argChoice:
+			fmt.Fprintf(&b, "complete -c modaltree -n %s -a %s\n", condition, fishQuote(strings.Join(cmd.choices, " ")))
+		}
+	}
+	return b.String()
+}
+
+func newCompletionFlagSet(stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("completion", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: modaltree completion <%s>\n\n", strings.Join(completionShells, "|"))
+		fmt.Fprintf(stderr, "Prints a completion script for the shell. For example, in ~/.bashrc:\n\n")
+		fmt.Fprintf(stderr, "    source <(modaltree completion bash)\n")
+	}
+	return flags
+}
+
+// runCompletion implements "modaltree completion <shell>" and returns the exit code
+func runCompletion(args []string, stdout, stderr io.Writer) int {
+	flags := newCompletionFlagSet(stderr)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	script, err := CompletionScript(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	fmt.Fprint(stdout, script)
+	return 0
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,6 +13,9 @@ const (
 	configFile = "config.yaml"
 )
 
+// configPathOverride replaces the default config location when set, by --config
+var configPathOverride string
+
 // LoadConfig loads configuration from file or returns defaults
 func LoadConfig() (Config, error) {
 	config := defaultConfig()
@@ -22,11 +26,11 @@ func LoadConfig() (Config, error) {
 	}
 
 	data, err := os.ReadFile(configPath)
-	if os.IsNotExist(err) {
-		// Create default config
-		if err := SaveConfig(config); err != nil {
-			return config, err
-		}
+	if os.IsNotExist(err) && configPathOverride != "" {
+		// A config named on the command line must exist, so a typo is not silently ignored
+		return config, err
+	} else if os.IsNotExist(err) {
+		// Nothing is written, so the defaults can still change between releases
 		return config, nil
 	} else if err != nil {
 		return config, err
@@ -39,19 +43,40 @@ func LoadConfig() (Config, error) {
 	return config, nil
 }
 
-// SaveConfig saves the configuration to file
+// SaveConfig saves the settings that differ from the defaults to the config
+// file, keeping whatever the file already sets
 func SaveConfig(config Config) error {
 	configPath, err := getConfigPath()
 	if err != nil {
 		return err
 	}
 
+	saved := map[string]any{}
+	data, err := os.ReadFile(configPath)
+	if err == nil {
+		if err := yaml.Unmarshal(data, &saved); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	current, err := settingsOf(config)
+	if err != nil {
+		return err
+	}
+	defaults, err := settingsOf(defaultConfig())
+	if err != nil {
+		return err
+	}
+	mergeChangedSettings(saved, current, defaults)
+
 	// Ensure config directory exists
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(config)
+	data, err = yaml.Marshal(saved)
 	if err != nil {
 		return err
 	}
@@ -59,6 +84,40 @@ func SaveConfig(config Config) error {
 	return os.WriteFile(configPath, data, 0644)
 }
 
+// settingsOf returns the config as the keys and values its file would hold
+func settingsOf(config Config) (map[string]any, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	err = yaml.Unmarshal(data, &settings)
+	return settings, err
+}
+
+// mergeChangedSettings copies into saved the current settings that differ from
+// the defaults or that saved already has, section by section
+func mergeChangedSettings(saved, current, defaults map[string]any) {
+	for key, value := range current {
+		section, isSection := value.(map[string]any)
+		if isSection {
+			savedSection, _ := saved[key].(map[string]any)
+			if savedSection == nil {
+				savedSection = map[string]any{}
+			}
+			defaultSection, _ := defaults[key].(map[string]any)
+			mergeChangedSettings(savedSection, section, defaultSection)
+			if len(savedSection) > 0 {
+				saved[key] = savedSection
+			}
+			continue
+		}
+		if _, ok := saved[key]; ok || !reflect.DeepEqual(value, defaults[key]) {
+			saved[key] = value
+		}
+	}
+}
+
 // defaultConfig returns default configuration values
 func defaultConfig() Config {
 	cwd, err := os.Getwd()
@@ -70,17 +129,48 @@ func defaultConfig() Config {
 	
 	return Config{
 		ShowHidden:     true,
-		Editor:         "code",
+		Editor:         "", // resolved from $VISUAL, $EDITOR or the editors on $PATH
 		ConfirmActions: true,
 		CurrentDir:     cwd,
 		Display:        display,
+		Mouse:          true,
+		Preserve:       DefaultPreserveOptions(),
+		Parallelism:    DefaultParallelism,
+		Conflicts:      DefaultConflictConfig(),
 		icons:          UnicodeIconSet(),
 		treeSymbols:    UnicodeTreeSymbols(),
 	}
 }
 
+// loadIcons selects the icon set for the display settings and layers the user's mappings on top
+func (c *Config) loadIcons() {
+	var base IconSet
+	switch c.Display.iconMode {
+	case IconsNerd:
+		base = NerdFontIconSet()
+	case IconsASCII:
+		base = ASCIIIconSet()
+	case IconsUnicode:
+		base = UnicodeIconSet()
+	default:
+		base = UnicodeIconSet()
+		if c.Display.UseNerdFont {
+			base = NerdFontIconSet()
+		}
+	}
+	c.icons = base.WithOverrides(c.Icons)
+}
+
+// loadTreeSymbols selects the tree-drawing symbols for the display settings
+func (c *Config) loadTreeSymbols() {
+	c.treeSymbols = c.Display.ResolveTreeSymbols()
+}
+
 // getConfigPath returns the full path to config file
 func getConfigPath() (string, error) {
+	if configPathOverride != "" {
+		return configPathOverride, nil
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
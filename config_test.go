@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigWritesNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.ShowHidden || config.Editor != "" {
+		t.Errorf("expected the defaults, got %+v", config)
+	}
+	if _, err := os.Stat(filepath.Join(home, configDir)); !os.IsNotExist(err) {
+		t.Errorf("expected no config to be written, got %v", err)
+	}
+}
+
+func TestSaveConfigWritesChangedKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, configDir, configFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("mouse: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := defaultConfig()
+	config.ShowHidden = false
+	config.Display.TreeStyle = "ascii"
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(data)
+	for _, want := range []string{"showhidden: false", "treestyle: ascii", "mouse: true"} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("expected %q in the saved config, got:\n%s", want, saved)
+		}
+	}
+	if strings.Contains(saved, "editor") || strings.Contains(saved, "parallelism") {
+		t.Errorf("expected the defaults not to be saved, got:\n%s", saved)
+	}
+
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ShowHidden || loaded.Display.TreeStyle != "ascii" {
+		t.Errorf("got %+v", loaded)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ConflictPolicy is what a move or copy does with a destination that already exists
+type ConflictPolicy int
+
+const (
+	ConflictAsk       ConflictPolicy = iota // show the conflict dialog
+	ConflictOverwrite                       // replace the destination
+	ConflictSkip                            // leave both the source and the destination alone
+	ConflictRename                          // copy next to the destination under a free name
+	ConflictKeepNewer                       // overwrite when the source was modified later, else skip
+	ConflictMerge                           // copy the contents of a directory into the existing one
+)
+
+// conflictPolicyNames are the names of the policies in the config
+var conflictPolicyNames = map[ConflictPolicy]string{
+	ConflictAsk:       "ask",
+	ConflictOverwrite: "overwrite",
+	ConflictSkip:      "skip",
+	ConflictRename:    "rename",
+	ConflictKeepNewer: "newer",
+	ConflictMerge:     "merge",
+}
+
+func (p ConflictPolicy) String() string {
+	return conflictPolicyNames[p]
+}
+
+// Choices offered for a file, and for a directory that meets an existing directory
+var (
+	fileConflictChoices = []ConflictPolicy{ConflictOverwrite, ConflictSkip, ConflictRename, ConflictKeepNewer}
+	dirConflictChoices  = []ConflictPolicy{ConflictMerge, ConflictOverwrite, ConflictSkip, ConflictRename}
+)
+
+// errDestinationExists is the conflict of an operation that cannot ask what to do
+var errDestinationExists = errors.New("destination already exists")
+
+// ConflictConfig sets what happens to existing destinations without asking,
+// for files and for directories that meet an existing directory
+type ConflictConfig struct {
+	Files       string // ask, overwrite, skip, rename or newer
+	Directories string // ask, merge, overwrite, skip or rename
+}
+
+// DefaultConflictConfig asks about every conflict
+func DefaultConflictConfig() ConflictConfig {
+	return ConflictConfig{Files: "ask", Directories: "ask"}
+}
+
+// policies parses the config, where an empty setting means ask
+func (c ConflictConfig) policies() (files, dirs ConflictPolicy, err error) {
+	parse := func(name, setting string, choices []ConflictPolicy) (ConflictPolicy, error) {
+		if setting == "" || setting == "ask" {
+			return ConflictAsk, nil
+		}
+		var names []string
+		for _, choice := range choices {
+			if choice.String() == setting {
+				return choice, nil
+			}
+			names = append(names, choice.String())
+		}
+		return ConflictAsk, fmt.Errorf("unknown %s conflict policy %q (want ask, %s)", name, setting, strings.Join(names, ", "))
+	}
+	files, err = parse("file", c.Files, fileConflictChoices)
+	if err != nil {
+		return
+	}
+	dirs, err = parse("directory", c.Directories, dirConflictChoices)
+	return
+}
+
+// Conflict is a source whose destination already exists, waiting for the
+// user to choose what happens to it
+type Conflict struct {
+	Source, Dest         string
+	SourceInfo, DestInfo fs.FileInfo
+	reply                chan ConflictChoice
+}
+
+// ConflictChoice answers a conflict
+type ConflictChoice struct {
+	Policy ConflictPolicy
+	All    bool // also apply it to the conflicts of the same kind that follow
+}
+
+// Directories reports whether a directory meets an existing directory, which
+// can be merged; any other pair is treated like files
+func (c *Conflict) Directories() bool {
+	return c.SourceInfo.IsDir() && c.DestInfo.IsDir()
+}
+
+// Choices returns the policies the conflict can be resolved with
+func (c *Conflict) Choices() []ConflictPolicy {
+	if c.Directories() {
+		return dirConflictChoices
+	}
+	return fileConflictChoices
+}
+
+// Answer resolves the conflict. The operation waiting on it takes the first answer.
+func (c *Conflict) Answer(choice ConflictChoice) {
+	select {
+	case c.reply <- choice:
+	default:
+	}
+}
+
+// conflictResolver decides the conflicts of one operation, from the config
+// or by asking, and remembers answers that apply to all
+type conflictResolver struct {
+	mu          sync.Mutex
+	files, dirs ConflictPolicy
+	interactive bool       // whether the UI answers conflicts published in the operation state
+	setAside    []setAside // destinations overwritten so far, kept until the operation succeeds
+}
+
+// setAside is a destination an overwrite renamed to aside, out of the way of the source
+type setAside struct {
+	dest, aside string
+}
+
+// newConflictResolver resolves conflicts as config says, asking when it says
+// to ask and interactive is set. A config that does not parse asks.
+func newConflictResolver(config ConflictConfig, interactive bool) *conflictResolver {
+	files, dirs, _ := config.policies()
+	return &conflictResolver{files: files, dirs: dirs, interactive: interactive}
+}
+
+// choose returns the policy for c, asking through the state of op when needed
+func (r *conflictResolver) choose(op FileOperation, c *Conflict) (ConflictPolicy, error) {
+	if r == nil {
+		return ConflictAsk, errDestinationExists
+	}
+	// One question at a time, so an answer for all applies to the next
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	policy := &r.files
+	if c.Directories() {
+		policy = &r.dirs
+	}
+	if *policy != ConflictAsk {
+		return *policy, nil
+	}
+	if !r.interactive {
+		return ConflictAsk, errDestinationExists
+	}
+
+	c.reply = make(chan ConflictChoice, 1)
+	op.state.update(func(s *OperationState) { s.Conflict = c })
+	defer op.state.update(func(s *OperationState) { s.Conflict = nil })
+	select {
+	case choice := <-c.reply:
+		if choice.All {
+			*policy = choice.Policy
+		}
+		return choice.Policy, nil
+	case <-op.context().Done():
+		return ConflictAsk, op.context().Err()
+	}
+}
+
+// resolveConflict decides what happens to src, described by srcInfo, whose
+// destination dst already exists. It returns where src goes, "" when it is
+// skipped, and whether it merges into the existing directory dst. An
+// overwritten destination is renamed aside here, so src can take its place,
+// and only removed once the operation succeeds.
+func (op FileOperation) resolveConflict(src string, srcInfo fs.FileInfo, dst string, dstInfo fs.FileInfo) (string, bool, error) {
+	conflict := &Conflict{Source: src, Dest: dst, SourceInfo: srcInfo, DestInfo: dstInfo}
+	policy, err := op.conflicts.choose(op, conflict)
+	if err != nil {
+		return "", false, err
+	}
+
+	if policy == ConflictKeepNewer {
+		policy = ConflictSkip
+		if srcInfo.ModTime().After(dstInfo.ModTime()) {
+			policy = ConflictOverwrite
+		}
+	}
+	switch policy {
+	case ConflictSkip:
+		op.state.update(func(s *OperationState) { s.Skipped++ })
+		return "", false, nil
+	case ConflictRename:
+		return freeCopyName(op.destFsys(), dst, srcInfo.IsDir()), false, nil
+	case ConflictMerge:
+		if !conflict.Directories() {
+			return "", false, fmt.Errorf("cannot merge %s into %s: both must be directories", src, dst)
+		}
+		return dst, true, nil
+	case ConflictOverwrite:
+		if !op.crossFS() && within(src, dst) {
+			return "", false, fmt.Errorf("cannot overwrite %s: it holds %s", dst, src)
+		}
+		if err := op.conflicts.setAsideDest(op.destFsys(), dst); err != nil {
+			return "", false, err
+		}
+		return dst, false, nil
+	}
+	return "", false, fmt.Errorf("unsupported conflict policy: %v", policy)
+}
+
+// setAsideDest renames dst to a hidden sibling, which keeps it until the
+// operation is over
+func (r *conflictResolver) setAsideDest(fsys FS, dst string) error {
+	aside := freeName(fsys, filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".modaltree-old"))
+	if err := fsys.Rename(dst, aside); err != nil {
+		return fmt.Errorf("cannot set %s aside: %w", dst, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setAside = append(r.setAside, setAside{dest: dst, aside: aside})
+	return nil
+}
+
+// discardSetAside removes the overwritten destinations once the operation has succeeded
+func (r *conflictResolver) discardSetAside(fsys FS) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.setAside {
+		fsys.RemoveAll(s.aside)
+	}
+	r.setAside = nil
+}
+
+// restoreSetAside puts the overwritten destinations back after op failed,
+// replacing whatever it wrote there. A destination a move has already put
+// its source in is kept, since that source is gone.
+func (r *conflictResolver) restoreSetAside(op FileOperation) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fsys := op.destFsys()
+	var errs []error
+	for _, s := range r.setAside {
+		if _, err := fsys.Lstat(s.dest); err == nil && op.Type == OpMove {
+			fsys.RemoveAll(s.aside)
+			continue
+		}
+		if err := fsys.RemoveAll(s.dest); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := fsys.Rename(s.aside, s.dest); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.setAside = nil
+	return errors.Join(errs...)
+}
+
+// settleDestination resolves a destination of a move or copy that already
+// exists before anything changes. It returns the operation to run, with its
+// new Dest or merge set, or skipped when the source is left alone.
+func (op FileOperation) settleDestination() (FileOperation, bool, error) {
+	dstInfo, err := op.destFsys().Lstat(op.Dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return op, false, nil
+	} else if err != nil {
+		return op, false, fmt.Errorf("cannot check destination: %w", err)
+	}
+	// A move renames symlinks; a copy copies what they point to
+	stat := op.fsys().Stat
+	if op.Type == OpMove {
+		stat = op.fsys().Lstat
+	}
+	srcInfo, err := stat(op.Source)
+	if err != nil {
+		return op, false, err
+	}
+
+	dest, merge, err := op.resolveConflict(op.Source, srcInfo, op.Dest, dstInfo)
+	if err != nil {
+		return op, false, err
+	}
+	if dest == "" {
+		return op, true, nil
+	}
+	op.Dest, op.merge = dest, merge
+	return op, false, nil
+}
+
+// within reports whether path is dir or below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// freeCopyName returns the first free name for a copy of path with a numeric
+// suffix, which files take before their extension: "notes-1.txt"
+func freeCopyName(fsys FS, path string, isDir bool) string {
+	ext := filepath.Ext(path)
+	if _, archiveExt := splitArchiveExt(path); isDir || archiveExt != "" || ext == "" || ext == filepath.Base(path) {
+		return freeName(fsys, path)
+	}
+	stem := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := stem + "-" + strconv.Itoa(i) + ext
+		if _, err := fsys.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+			return candidate
+		}
+	}
+}
+
+// conflictActions map the keys of the conflict dialog to their answers
+var conflictActions = map[Action]ConflictChoice{
+	ActionConflictOverwrite:    {Policy: ConflictOverwrite},
+	ActionConflictSkip:         {Policy: ConflictSkip},
+	ActionConflictRename:       {Policy: ConflictRename},
+	ActionConflictNewer:        {Policy: ConflictKeepNewer},
+	ActionConflictMerge:        {Policy: ConflictMerge},
+	ActionConflictOverwriteAll: {Policy: ConflictOverwrite, All: true},
+	ActionConflictSkipAll:      {Policy: ConflictSkip, All: true},
+	ActionConflictRenameAll:    {Policy: ConflictRename, All: true},
+	ActionConflictNewerAll:     {Policy: ConflictKeepNewer, All: true},
+	ActionConflictMergeAll:     {Policy: ConflictMerge, All: true},
+}
+
+// offers reports whether the conflict can be resolved with policy
+func (c *Conflict) offers(policy ConflictPolicy) bool {
+	for _, choice := range c.Choices() {
+		if choice == policy {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Model) handleConflictViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.conflict == nil {
+		m.activeView = TreeView
+		return m, nil
+	}
+
+	action := m.keys.Lookup(ConflictView, msg.String())
+	switch action {
+	case ActionConflictCancel:
+		m.conflict = nil
+		m.activeView = TreeView
+		m.cancelOperation()
+		return m, nil
+	case ActionHelp:
+		return m.openHelp(), nil
+	}
+
+	choice, ok := conflictActions[action]
+	if !ok || !m.conflict.offers(choice.Policy) {
+		return m, nil
+	}
+	m.conflict.Answer(choice)
+	// Keep the answered conflict, so the next tick does not show it again
+	m.activeView = TreeView
+	return m, nil
+}
+
+// View renders the conflict dialog: both items, and the keys of the choices it offers
+func (c *Conflict) View(keys KeyMap) string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(fmt.Sprintf("%s already exists", c.Dest)) + "\n\n")
+
+	newer := c.SourceInfo.ModTime().Compare(c.DestInfo.ModTime())
+	row := func(label, path string, info fs.FileInfo, isNewer bool) {
+		size := formatSize(info.Size())
+		if info.IsDir() {
+			size = "directory"
+		}
+		line := fmt.Sprintf("  %-12s %10s  %s", label, size, info.ModTime().Format("2006-01-02 15:04:05"))
+		if isNewer {
+			line += successMessageStyle.Render(" (newer)")
+		}
+		b.WriteString(line + "  " + inactiveHeaderStyle.Render(path) + "\n")
+	}
+	row("Source", c.Source, c.SourceInfo, newer > 0)
+	row("Destination", c.Dest, c.DestInfo, newer < 0)
+	b.WriteString("\n")
+
+	var choices, all []string
+	for _, binding := range keys.Bindings(ConflictView) {
+		choice, ok := conflictActions[binding.Action]
+		switch {
+		case binding.Action == ActionConflictCancel:
+			choices = append(choices, fmt.Sprintf("%s: %s", binding.KeyNames(), binding.Help))
+		case !ok || !c.offers(choice.Policy):
+		case choice.All:
+			all = append(all, binding.KeyNames())
+		default:
+			choices = append(choices, fmt.Sprintf("%s: %s", binding.KeyNames(), binding.Help))
+		}
+	}
+	b.WriteString("  " + strings.Join(choices, "   ") + "\n")
+	if len(all) > 0 {
+		b.WriteString("  " + strings.Join(all, "/") + ": the same for every conflict like it that follows\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// conflictProject is a tree to copy and a destination that already holds parts of it
+func conflictProject(t *testing.T) *MemFS {
+	t.Helper()
+	fsys := memProject(t)
+	if err := fsys.MkdirAll("/w/out/src/pkg", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/w/out/src/a.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/w/out/src/pkg/b.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/w/out/src/keep.txt", []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/w/src/pkg/c.txt", []byte("gamma"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+// policyOperation builds an operation that resolves conflicts as config says, without asking
+func policyOperation(t *testing.T, fsys FS, opType OperationType, source, dest string, config ConflictConfig) FileOperation {
+	t.Helper()
+	op := memOperation(t, fsys, opType, source, dest)
+	op.conflicts = newConflictResolver(config, false)
+	return op
+}
+
+func TestFileConflictPolicies(t *testing.T) {
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		policy    string
+		destOlder bool
+		want      map[string]string
+		skipped   int
+	}{
+		{"overwrite", false, map[string]string{"/w/out/a.txt": "alpha"}, 0},
+		{"skip", true, map[string]string{"/w/out/a.txt": "old"}, 1},
+		{"rename", false, map[string]string{"/w/out/a.txt": "old", "/w/out/a-1.txt": "alpha"}, 0},
+		{"newer", true, map[string]string{"/w/out/a.txt": "alpha"}, 0},
+		{"newer", false, map[string]string{"/w/out/a.txt": "old"}, 1},
+	}
+	for _, tt := range tests {
+		for _, opType := range []OperationType{OpCopy, OpMove} {
+			fsys := memProject(t)
+			if err := WriteFile(fsys, "/w/out/a.txt", []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.destOlder {
+				if err := fsys.Chtimes("/w/out/a.txt", old, old); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				if err := fsys.Chtimes("/w/src/a.txt", old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			op := policyOperation(t, fsys, opType, "/w/src/a.txt", "/w/out/a.txt", ConflictConfig{Files: tt.policy})
+			if err := ExecuteFileOperation(op); err != nil {
+				t.Fatalf("%s %s: %v", getOperationName(opType), tt.policy, err)
+			}
+			for path, want := range tt.want {
+				if data, err := ReadFile(fsys, path); err != nil || string(data) != want {
+					t.Errorf("%s %s: got %q, %v in %s, want %q", getOperationName(opType), tt.policy, data, err, path, want)
+				}
+			}
+			if skipped := op.state.Snapshot().Skipped; skipped != tt.skipped {
+				t.Errorf("%s %s: got %d skipped, want %d", getOperationName(opType), tt.policy, skipped, tt.skipped)
+			}
+			_, err := fsys.Stat("/w/src/a.txt")
+			if moved := opType == OpMove && tt.skipped == 0; moved != errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s %s: got source %v", getOperationName(opType), tt.policy, err)
+			}
+		}
+	}
+}
+
+func TestMergeDirectories(t *testing.T) {
+	for _, opType := range []OperationType{OpCopy, OpMove} {
+		fsys := conflictProject(t)
+		op := policyOperation(t, fsys, opType, "/w/src", "/w/out/src", ConflictConfig{Files: "skip", Directories: "merge"})
+		if err := ExecuteFileOperation(op); err != nil {
+			t.Fatal(err)
+		}
+
+		for path, want := range map[string]string{
+			"/w/out/src/a.txt":     "old",
+			"/w/out/src/pkg/b.txt": "old",
+			"/w/out/src/pkg/c.txt": "gamma",
+			"/w/out/src/keep.txt":  "mine",
+		} {
+			if data, err := ReadFile(fsys, path); err != nil || string(data) != want {
+				t.Errorf("%s: got %q, %v in %s, want %q", getOperationName(opType), data, err, path, want)
+			}
+		}
+		if skipped := op.state.Snapshot().Skipped; skipped != 2 {
+			t.Errorf("%s: got %d skipped, want 2", getOperationName(opType), skipped)
+		}
+		if opType == OpMove {
+			// Only what was skipped stays behind
+			if _, err := fsys.Stat("/w/src/pkg/c.txt"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected c.txt to be moved, got %v", err)
+			}
+			if _, err := fsys.Stat("/w/src/pkg/b.txt"); err != nil {
+				t.Errorf("expected the skipped b.txt to stay: %v", err)
+			}
+		}
+	}
+}
+
+func TestOverwriteDirectoryReplacesIt(t *testing.T) {
+	fsys := conflictProject(t)
+	op := policyOperation(t, fsys, OpCopy, "/w/src", "/w/out/src", ConflictConfig{Directories: "overwrite"})
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("/w/out/src/keep.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the old directory to be replaced, got %v", err)
+	}
+	if _, err := fsys.Stat("/w/out/.src.modaltree-old"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the old directory to be removed once the copy succeeded, got %v", err)
+	}
+	if data, _ := ReadFile(fsys, "/w/out/src/pkg/b.txt"); string(data) != "beta" {
+		t.Errorf("got %q, want the copied b.txt", data)
+	}
+
+	// Never the directory the source is in
+	op = policyOperation(t, fsys, OpMove, "/w/src/a.txt", "/w/src", ConflictConfig{Files: "overwrite"})
+	if err := ExecuteFileOperation(op); err == nil || !strings.Contains(err.Error(), "holds") {
+		t.Errorf("expected overwriting the parent to fail, got %v", err)
+	}
+	if _, err := fsys.Stat("/w/src/a.txt"); err != nil {
+		t.Errorf("expected the source to be kept: %v", err)
+	}
+}
+
+// cancelingFS is a MemFS that cancels the operation once it creates the file at
+type cancelingFS struct {
+	*MemFS
+	at     string
+	cancel context.CancelFunc
+}
+
+func (c cancelingFS) Create(name string, perm os.FileMode) (File, error) {
+	if name == c.at {
+		c.cancel()
+	}
+	return c.MemFS.Create(name, perm)
+}
+
+func TestCanceledOverwriteKeepsDestination(t *testing.T) {
+	for _, config := range []ConflictConfig{{Directories: "overwrite"}, {Files: "overwrite", Directories: "merge"}} {
+		mem := NewMemFS()
+		if err := mem.MkdirAll("/w/src/pkg", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := mem.MkdirAll("/w/out/src/pkg", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(mem, "/w/src/a.txt", []byte("alpha"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(mem, "/w/src/pkg/b.txt", []byte("beta"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(mem, "/w/out/src/a.txt", []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(mem, "/w/out/src/pkg/b.txt", []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fsys := cancelingFS{MemFS: mem, at: "/w/out/src/pkg/b.txt", cancel: cancel}
+
+		op := NewFileOperation(OpCopy, "/w/src", "/w/out/src", &FileItem{path: "/w/src", name: "src", isDir: true})
+		op.fs, op.ctx, op.parallelism = fsys, ctx, 1
+		op.conflicts = newConflictResolver(config, false)
+		if err := ExecuteFileOperation(op); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%+v: expected the copy to be canceled, got %v", config, err)
+		}
+		for path, want := range map[string]string{"/w/out/src/a.txt": "old", "/w/out/src/pkg/b.txt": "old"} {
+			if data, err := ReadFile(fsys, path); err != nil || string(data) != want {
+				t.Errorf("%+v: got %q, %v in %s, want the old destination", config, data, err, path)
+			}
+		}
+		for _, dir := range []string{"/w/out", "/w/out/src", "/w/out/src/pkg"} {
+			entries, _ := fsys.ReadDir(dir)
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), ".modaltree-old") {
+					t.Errorf("%+v: expected nothing left set aside, got %s", config, filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+	}
+}
+
+func TestConflictWithoutPolicyFails(t *testing.T) {
+	fsys := conflictProject(t)
+	op := policyOperation(t, fsys, OpCopy, "/w/src", "/w/out/src", DefaultConflictConfig())
+	if err := ExecuteFileOperation(op); !errors.Is(err, errDestinationExists) {
+		t.Errorf("expected a conflict nobody can answer to fail, got %v", err)
+	}
+	if snapshot := op.state.Snapshot(); snapshot.RetryCount != 0 {
+		t.Errorf("expected no attempt, got %d", snapshot.RetryCount)
+	}
+}
+
+func TestConflictConfigPolicies(t *testing.T) {
+	files, dirs, err := ConflictConfig{Files: "newer", Directories: "merge"}.policies()
+	if err != nil || files != ConflictKeepNewer || dirs != ConflictMerge {
+		t.Errorf("got %v, %v, %v", files, dirs, err)
+	}
+	if files, dirs, err := (ConflictConfig{}).policies(); err != nil || files != ConflictAsk || dirs != ConflictAsk {
+		t.Errorf("expected an empty config to ask, got %v, %v, %v", files, dirs, err)
+	}
+	if _, _, err := (ConflictConfig{Files: "merge"}).policies(); err == nil || !strings.Contains(err.Error(), "want ask, overwrite, skip, rename, newer") {
+		t.Errorf("expected files not to merge, got %v", err)
+	}
+}
+
+func TestFreeCopyName(t *testing.T) {
+	fsys := NewMemFS()
+	for _, name := range []string{"/notes.txt", "/notes-1.txt", "/src.tar.gz", "/.bashrc", "/v1.2"} {
+		if err := WriteFile(fsys, name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  string
+	}{
+		{"/notes.txt", false, "/notes-2.txt"},
+		{"/src.tar.gz", false, "/src-1.tar.gz"},
+		{"/.bashrc", false, "/.bashrc-1"},
+		{"/v1.2", true, "/v1.2-1"},
+	}
+	for _, tt := range tests {
+		if got := freeCopyName(fsys, tt.path, tt.isDir); got != tt.want {
+			t.Errorf("freeCopyName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// nextConflict waits for the operation to ask about a conflict other than previous
+func nextConflict(t *testing.T, state *OperationState, previous *Conflict) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if c := state.Snapshot().Conflict; c != nil && c != previous {
+			return
+		}
+	}
+	t.Fatal("expected the operation to ask about a conflict")
+}
+
+func TestConflictDialog(t *testing.T) {
+	dir := t.TempDir()
+	for path, data := range map[string]string{
+		"src/a.txt": "alpha", "src/pkg/b.txt": "beta", "src/pkg/c.txt": "gamma",
+		"out/src/a.txt": "old", "out/src/pkg/b.txt": "old", "out/src/keep.txt": "mine",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := dualPaneModel(dir, filepath.Join(dir, "out"))
+	m.keys = DefaultKeyMap()
+	src := filepath.Join(dir, "src")
+	m, cmd := m.startOperation(m.newOperation(OpCopy, src, filepath.Join(dir, "out/src"), &FileItem{path: src, name: "src", isDir: true}))
+	done := make(chan operationDoneMsg)
+	go func() { done <- cmd().(tea.BatchMsg)[0]().(operationDoneMsg) }()
+
+	answer := func(choice string, want ...string) {
+		t.Helper()
+		nextConflict(t, m.operation, m.conflict)
+		newModel, _ := m.handleOperationTick(operationTickMsg{state: m.operation})
+		m = newModel.(Model)
+		if m.activeView != ConflictView {
+			t.Fatalf("expected the conflict dialog, got view %v", m.activeView)
+		}
+		view := m.View()
+		for _, text := range want {
+			if !strings.Contains(view, text) {
+				t.Errorf("expected %q in the dialog:\n%s", text, view)
+			}
+		}
+		newModel, _ = m.handleConflictViewKeys(key(choice))
+		m = newModel.(Model)
+	}
+	// Merge the directory, overwrite every file, and merge every directory after
+	answer("m", "out/src already exists", "directory", "m: merge directories", "M: the same")
+	answer("O", "a.txt already exists", "5 B", "3 B", "n: keep the newer file", "(newer)")
+	answer("M", "pkg already exists")
+
+	msg := <-done
+	if msg.err != nil {
+		t.Fatal(msg.err)
+	}
+	for path, want := range map[string]string{
+		"out/src/a.txt": "alpha", "out/src/pkg/b.txt": "beta", "out/src/pkg/c.txt": "gamma", "out/src/keep.txt": "mine",
+	} {
+		if data, err := os.ReadFile(filepath.Join(dir, path)); err != nil || string(data) != want {
+			t.Errorf("got %q, %v in %s, want %q", data, err, path, want)
+		}
+	}
+
+	newModel, _ := m.handleOperationDone(msg)
+	if m = newModel.(Model); m.activeView != TreeView || m.conflict != nil {
+		t.Errorf("expected the dialog to be gone, got view %v", m.activeView)
+	}
+}
+
+func TestConflictDialogCancels(t *testing.T) {
+	fsys := conflictProject(t)
+	m := dualPaneModel(t.TempDir(), t.TempDir())
+	m.tree.fs = fsys
+	m, cmd := m.startOperation(m.newOperation(OpCopy, "/w/src/a.txt", "/w/out/src/a.txt", &FileItem{path: "/w/src/a.txt", name: "a.txt"}))
+	done := make(chan operationDoneMsg)
+	go func() { done <- cmd().(tea.BatchMsg)[0]().(operationDoneMsg) }()
+
+	nextConflict(t, m.operation, nil)
+	newModel, _ := m.handleOperationTick(operationTickMsg{state: m.operation})
+	newModel, _ = newModel.(Model).handleConflictViewKeys(tea.KeyMsg{Type: tea.KeyEsc})
+	if m = newModel.(Model); m.activeView != TreeView {
+		t.Errorf("expected to return to the tree, got view %v", m.activeView)
+	}
+	if msg := <-done; !errors.Is(msg.err, context.Canceled) {
+		t.Errorf("expected the operation to be canceled, got %v", msg.err)
+	}
+	if data, _ := ReadFile(fsys, "/w/out/src/a.txt"); string(data) != "old" {
+		t.Errorf("expected the destination to be left alone, got %q", data)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// copyBufferSize is the buffer of copies the kernel cannot do itself
+const copyBufferSize = 1 << 20
+
+// copyContents copies all of src into the new, empty file dst, calling progress
+// with the bytes done after each step. Between local files the kernel does the
+// work where it can (see copyOSFile); anything else gets a buffered copy.
+func copyContents(ctx context.Context, dst, src File, progress func(n int64)) error {
+	report := func(n int64) {
+		if n > 0 && progress != nil {
+			progress(n)
+		}
+	}
+	srcFile, srcOK := src.(*os.File)
+	dstFile, dstOK := dst.(*os.File)
+	if srcOK && dstOK {
+		return copyOSFile(ctx, dstFile, srcFile, report)
+	}
+	return copyBuffered(ctx, dst, src, report)
+}
+
+// copyBuffered copies src to dst through a buffer, checking ctx between reads
+func copyBuffered(ctx context.Context, dst io.Writer, src io.Reader, progress func(n int64)) error {
+	buf := make([]byte, copyBufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			progress(int64(n))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
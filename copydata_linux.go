@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyChunk bounds each copy_file_range call, so progress and cancellation stay responsive
+const copyChunk = 16 << 20
+
+// copyFileRange is copy_file_range(2), replaced in tests
+var copyFileRange = unix.CopyFileRange
+
+// dataSegment is a stretch of a file that holds data rather than a hole
+type dataSegment struct {
+	offset, length int64
+}
+
+// copyOSFile copies src into the empty file dst. It shares the blocks with a
+// FICLONE reflink where the filesystem supports it (btrfs, xfs), else copies
+// in the kernel with copy_file_range and skips the holes SEEK_DATA and
+// SEEK_HOLE find, so sparse files stay sparse. Holes count towards progress.
+func copyOSFile(ctx context.Context, dst, src *os.File, progress func(n int64)) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 || !info.Mode().IsRegular() {
+		return copyBuffered(ctx, dst, src, progress)
+	}
+
+	if unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())) == nil {
+		progress(size)
+		return nil
+	}
+
+	var offset int64
+	kernel := true
+	for _, segment := range dataSegments(src, size) {
+		progress(segment.offset - offset)
+		if err := copyRange(ctx, dst, src, segment, &kernel, progress); err != nil {
+			return err
+		}
+		offset = segment.offset + segment.length
+	}
+	// A source truncated since the Stat has holes where its data was, so
+	// padding the copy to the old size would hide what is missing
+	if info, err = src.Stat(); err != nil {
+		return err
+	}
+	if info.Size() < size {
+		return fmt.Errorf("%s shrank while being copied: %w", src.Name(), io.ErrUnexpectedEOF)
+	}
+	progress(size - offset)
+	// A trailing hole is just the length of the file
+	return dst.Truncate(size)
+}
+
+// dataSegments lists the data of f, up to size. Filesystems that cannot find
+// holes report the whole file as data.
+func dataSegments(f *os.File, size int64) []dataSegment {
+	fd := int(f.Fd())
+	var segments []dataSegment
+	for offset := int64(0); offset < size; {
+		data, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			break // only a hole is left
+		}
+		if err != nil {
+			return []dataSegment{{0, size}}
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return []dataSegment{{0, size}}
+		}
+		hole = min(hole, size)
+		if hole > data {
+			segments = append(segments, dataSegment{data, hole - data})
+		}
+		offset = hole
+	}
+	return segments
+}
+
+// copyRange copies one segment to the same offset of dst, with copy_file_range
+// while *kernel is set. A kernel or filesystem that refuses clears it, and the
+// rest of the copy is buffered. Some filesystems (FUSE, overlayfs) and kernels
+// copy nothing and report no error instead, so the segment is buffered then too.
+func copyRange(ctx context.Context, dst, src *os.File, segment dataSegment, kernel *bool, progress func(n int64)) error {
+	offset, end := segment.offset, segment.offset+segment.length
+	inKernel := *kernel
+	var buf []byte
+	for offset < end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := min(end-offset, copyChunk)
+
+		if inKernel {
+			srcOffset, dstOffset := offset, offset
+			n, err := copyFileRange(int(src.Fd()), &srcOffset, int(dst.Fd()), &dstOffset, int(chunk), 0)
+			switch {
+			case err == nil && n == 0:
+				inKernel = false
+			case err == nil:
+				offset += int64(n)
+				progress(int64(n))
+				continue
+			case kernelCopyUnsupported(err):
+				inKernel, *kernel = false, false
+			default:
+				return err
+			}
+		}
+
+		if buf == nil {
+			buf = make([]byte, copyBufferSize)
+		}
+		n, err := io.CopyBuffer(io.NewOffsetWriter(dst, offset), io.NewSectionReader(src, offset, chunk), buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Padding the copy to the old size would hide what is missing
+			return fmt.Errorf("%s shrank while being copied: %w", src.Name(), io.ErrUnexpectedEOF)
+		}
+		offset += n
+		progress(n)
+	}
+	return nil
+}
+
+// kernelCopyUnsupported reports whether copy_file_range failed because it
+// cannot copy between these files, rather than because the copy went wrong
+func kernelCopyUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EXDEV) ||
+		errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EBADF)
+}
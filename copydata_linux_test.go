@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyRangeBuffersWhenKernelCopiesNothing(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("modaltree"), 1000)
+	if err := os.WriteFile(filepath.Join(dir, "src"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.Open(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	// Like a FUSE filesystem that claims success without copying
+	saved := copyFileRange
+	copyFileRange = func(int, *int64, int, *int64, int, int) (int, error) { return 0, nil }
+	t.Cleanup(func() { copyFileRange = saved })
+
+	kernel := true
+	var done int64
+	segment := dataSegment{0, int64(len(data))}
+	if err := copyRange(context.Background(), dst, src, segment, &kernel, func(n int64) { done += n }); err != nil {
+		t.Fatal(err)
+	}
+	if copied, _ := os.ReadFile(filepath.Join(dir, "dst")); !bytes.Equal(copied, data) {
+		t.Errorf("expected the data to be copied, got %d bytes", len(copied))
+	}
+	if done != int64(len(data)) {
+		t.Errorf("got progress %d, want %d", done, len(data))
+	}
+
+	// A source shorter than it was is an error, not a zero-filled copy
+	segment = dataSegment{0, int64(len(data)) + 100}
+	err = copyRange(context.Background(), dst, src, segment, &kernel, func(int64) {})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected the copy to fail when the source ends early, got %v", err)
+	}
+}
+
+func TestCopyOSFileFailsWhenSourceShrinks(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data := bytes.Repeat([]byte("modaltree"), 8<<10)[:64<<10]
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if segments := dataSegments(f, 1<<20); len(segments) != 1 || segments[0].length != 64<<10 {
+		t.Skip("the temporary directory does not support sparse files")
+	}
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	// The trailing hole goes while the data before it is copied
+	saved := copyFileRange
+	copied := false
+	copyFileRange = func(rfd int, roff *int64, wfd int, woff *int64, n int, flags int) (int, error) {
+		if err := f.Truncate(64 << 10); err != nil {
+			return 0, err
+		}
+		copied = true
+		return saved(rfd, roff, wfd, woff, n, flags)
+	}
+	t.Cleanup(func() { copyFileRange = saved })
+
+	err = copyOSFile(context.Background(), dst, f, func(int64) {})
+	if !copied {
+		t.Skip("the filesystem cloned the file")
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected the copy to fail when the source shrinks, got %v", err)
+	}
+}
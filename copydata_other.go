@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// copyOSFile copies between local files through a buffer where the kernel
+// offers no copy of its own
+func copyOSFile(ctx context.Context, dst, src *os.File, progress func(n int64)) error {
+	return copyBuffered(ctx, dst, src, progress)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestCopyKeepsSparseFilesSparse(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "disk.img")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 << 20
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("boot"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte("data"), 1024), 32<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(src); info.Sys().(*syscall.Stat_t).Blocks*512 >= size {
+		t.Skip("the temporary directory does not support sparse files")
+	}
+
+	dst := filepath.Join(dir, "copy.img")
+	op := memOperation(t, OSFS{}, OpCopy, src, dst)
+	if err := CopyFileWithProgress(op); err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := os.ReadFile(src)
+	got, _ := os.ReadFile(dst)
+	if !bytes.Equal(got, want) {
+		t.Fatal("expected the copy to have the same contents")
+	}
+	info, _ := os.Stat(dst)
+	if info.Size() != size {
+		t.Errorf("got size %d, want %d", info.Size(), size)
+	}
+	if blocks := info.Sys().(*syscall.Stat_t).Blocks * 512; runtime.GOOS == "linux" && blocks >= size {
+		t.Errorf("expected the copy to stay sparse, got %d bytes allocated", blocks)
+	}
+	if progress := op.state.Snapshot().Progress; progress != 100 {
+		t.Errorf("got progress %v, want 100", progress)
+	}
+}
+
+func TestCopyContentsReportsProgress(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 300_000) // over a few buffers
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "src"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemFS()
+	if err := WriteFile(mem, "/src", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fsys := range []struct {
+		name string
+		FS
+		dir string
+	}{{"os", OSFS{}, dir}, {"mem", mem, "/"}} {
+		t.Run(fsys.name, func(t *testing.T) {
+			src, err := fsys.Open(filepath.Join(fsys.dir, "src"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			dst, err := fsys.Create(filepath.Join(fsys.dir, "dst"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var total int64
+			calls := 0
+			err = copyContents(context.Background(), dst, src, func(n int64) {
+				if n <= 0 {
+					t.Errorf("got progress of %d bytes", n)
+				}
+				total += n
+				calls++
+			})
+			dst.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != int64(len(data)) || calls == 0 {
+				t.Errorf("got %d bytes of progress in %d calls, want %d", total, calls, len(data))
+			}
+			if got, _ := ReadFile(fsys, filepath.Join(fsys.dir, "dst")); !bytes.Equal(got, data) {
+				t.Error("expected the copy to have the same contents")
+			}
+		})
+	}
+}
+
+func TestCopyContentsStopsWhenCanceled(t *testing.T) {
+	mem := NewMemFS()
+	if err := WriteFile(mem, "/src", bytes.Repeat([]byte("x"), 4<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := mem.Open("/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := mem.Create("/dst", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = copyContents(ctx, dst, src, func(int64) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the copy to be canceled, got %v", err)
+	}
+}
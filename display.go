@@ -1,23 +1,29 @@
 package main
 
 import (
+	"io/fs"
 	"path/filepath"
-
-	"github.com/mattn/go-runewidth"
+	"sort"
+	"strings"
 )
 
 // DisplayConfig holds the configuration for the display
 type DisplayConfig struct {
 	UseNerdFont bool // whether to use nerd font icons
+	Icons string // "auto", "nerd", "unicode" or "ascii"; empty follows UseNerdFont
 	IndentSize int // number of spaces to indent
-	TreeStyle string // "unicode" or "ascii"
+	TreeStyle string // "unicode", "rounded", "heavy", "double", "ascii" or "none"
+	TreeSymbols TreeSymbols // custom symbols that override the TreeStyle preset
+	PreferTheme bool // ignore LS_COLORS and color items with the built-in theme
 	fontVerified bool // internal state for font verification
+	iconMode string // concrete icon mode resolved from Icons
 }
 
 // DefaultDisplayConfig returns the default display configuration
 func DefaultDisplayConfig() DisplayConfig {
 	return DisplayConfig{
 		UseNerdFont: false,
+		Icons: "",
 		IndentSize: 2,
 		TreeStyle: "unicode",
 		fontVerified: false,
@@ -30,7 +36,21 @@ type IconSet struct {
 	DirectoryOpen string
 	ParentDir string
 	DefaultFile string
-	FileTypeIcons map[string]string
+	FileTypeIcons map[string]string // keyed by extension, e.g. ".go" or ".tar.gz"
+	FileNameIcons map[string]string // keyed by exact file name, e.g. "Makefile"
+	GlobIcons map[string]string // keyed by shell pattern matched against the name, e.g. "*.test.js"
+	DirectoryIcons map[string]string // keyed by exact directory name, e.g. ".github"
+	MIMEIcons map[string]string // keyed by MIME type or major type, e.g. "application/pdf" or "image/*"
+	globPatterns []string // keys of GlobIcons, most specific first
+}
+
+// IconConfig holds user-defined icon mappings that are layered over the active icon set
+type IconConfig struct {
+	Filenames   map[string]string // exact file names, e.g. "Dockerfile"
+	Extensions  map[string]string // extensions including the dot, e.g. ".go"
+	Globs       map[string]string // shell patterns matched against the name, e.g. "*_test.go"
+	Directories map[string]string // exact directory names, e.g. ".github"
+	MIME        map[string]string // MIME types or major types, e.g. "image/*"
 }
 
 // UnicodeIconSet returns the default Unicode tree icons
@@ -40,17 +60,103 @@ func UnicodeIconSet() IconSet {
 		DirectoryOpen: "▾",
 		ParentDir:     "▴",
 		DefaultFile:   "•",
+		File:          "•",
+		Executable:    "*",
+		Symlink:       "→",
+		Pipe:          "|",
+		Socket:        "=",
+		BlockDevice:   "▪",
+		CharDevice:    "▫",
+		Special:       "?",
+		Missing:       "✗",
+		FileTypeIcons: make(map[string]string),
+		FileNameIcons: make(map[string]string),
+		GlobIcons:     make(map[string]string),
+		DirectoryIcons: make(map[string]string),
+		MIMEIcons:     make(map[string]string),
+	}
+}
+
+// ASCIIIconSet returns icons for terminals that cannot render Unicode
+func ASCIIIconSet() IconSet {
+	return IconSet{
+		Directory:     "+",
+		DirectoryOpen: "-",
+		ParentDir:     "^",
+		DefaultFile:   ".",
+		File:          ".",
+		Executable:    "*",
+		Symlink:       "@",
+		Pipe:          "|",
+		Socket:        "=",
+		BlockDevice:   "b",
+		CharDevice:    "c",
+		Special:       "?",
+		Missing:       "!",
 		FileTypeIcons: make(map[string]string),
+		FileNameIcons: make(map[string]string),
+		GlobIcons:     make(map[string]string),
+		DirectoryIcons: make(map[string]string),
+		MIMEIcons:     make(map[string]string),
 	}
 }
 
 // NerdFontIconSet returns Nerd Font icons
 func NerdFontIconSet() IconSet {
-	return IconSet{
+	icons := IconSet{
 		Directory:     "\uf74a",     // Folder icon
 		DirectoryOpen: "\uf74b",     // Open folder icon
 		ParentDir:     "\uf743",     // Parent directory icon  
 		DefaultFile:   "\uf723",     // Default file icon
+		File:          "\uf723",     // Default file icon
+		Executable:    "\uf489",     // Terminal icon
+		Symlink:       "\uf481",     // Symlink icon
+		Pipe:          "\ufce3",     // Pipe icon
+		Socket:        "\uf6a7",     // Socket icon
+		BlockDevice:   "\uf7c9",     // Disk icon
+		CharDevice:    "\ue601",     // Device icon
+		Special:       "\uf059",     // Question mark icon
+		Missing:       "\uf071",     // Warning icon
+		FileNameIcons: map[string]string{
+			"Makefile":     "\ue673", // Makefile icon
+			"Dockerfile":   "\uf308", // Docker icon
+			"go.mod":       "\ue627", // Go module icon
+			"go.sum":       "\ue627", // Go sum icon
+			"LICENSE":      "\uf718", // License icon
+			"README.md":    "\uf48a", // Readme icon
+			".gitignore":   "\ue65d", // Git ignore icon
+			".gitmodules":  "\ue702", // Git icon
+			"package.json": "\ue71e", // npm icon
+			"Cargo.toml":   "\ue7a8", // Rust icon
+		},
+		GlobIcons: map[string]string{
+			"*_test.go":  "\uf499", // Test icon
+			"*.test.js":  "\uf499", // Test icon
+			"*.test.ts":  "\uf499", // Test icon
+			"Dockerfile.*": "\uf308", // Docker icon
+		},
+		DirectoryIcons: map[string]string{
+			".git":         "\ue5fb", // Git folder icon
+			".github":      "\ue5fd", // GitHub folder icon
+			".config":      "\ue5fc", // Config folder icon
+			"node_modules": "\ue5fa", // npm folder icon
+		},
+		MIMEIcons: map[string]string{
+			"image/*":                   "\uf03e", // Image icon
+			"video/*":                   "\uf72f", // Video icon
+			"audio/*":                   "\uf910", // Audio icon
+			"application/pdf":           "\uf724", // PDF icon
+			"application/zip":           "\uf292", // Zip icon
+			"application/gzip":          "\ue6aa", // Gzip icon
+			"application/x-tar":         "\ue6aa", // Tar icon
+			"application/x-xz":          "\ue6aa", // Xz icon
+			"application/zstd":          "\ue6aa", // Zstd icon
+			"application/x-shellscript": "\ue691", // Shell script icon
+			"text/x-python":             "\ue235", // Python icon
+			"application/x-ruby":        "\ue605", // Ruby icon
+			"application/javascript":    "\ue781", // JavaScript icon
+			"application/x-executable":  "\uf489", // Terminal icon
+		},
 		FileTypeIcons: map[string]string{
 			".go":     "\ue724", // Go icon
 			".mod":    "\ue624", // Go module icon
@@ -81,6 +187,7 @@ func NerdFontIconSet() IconSet {
 			".zip":    "\uf292", // Zip icon
 			".tar":    "\ue6aa", // Tar icon
 			".gz":     "\ue6aa", // Gzip icon
+			".tar.gz": "\ue6aa", // Tarball icon
 			".pdf":    "\uf724", // PDF icon
 			".doc":    "\ue6a5", // Word icon
 			".docx":   "\ue6a5", // Word icon
@@ -99,37 +206,148 @@ func NerdFontIconSet() IconSet {
 			".mov":    "\uf1c8", // MOV icon
 		},
 	}
+	icons.globPatterns = sortGlobPatterns(icons.GlobIcons)
+	return icons
 }
-// GetFileIcon returns the appropriate icon for a file
-func (is IconSet) GetFileIcon(item FileItem, config DisplayConfig) string {
-	// first check if nerd fonts are enabled and verified
-	if !config.UseNerdFont || !config.fontVerified {
-		// fall back to unicode icons if nerd fonts are not enabled or verified
-		if item.isDir {
-			if item.name == ".." {
-				return "▴" // unicode fallback for parent directory
-			}
-			return "▸" // unicode fallback for directory
-		}
-		return "•" // unicode fallback for file
+// WithOverrides returns a copy of the icon set with user-defined mappings layered on top
+func (is IconSet) WithOverrides(overrides IconConfig) IconSet {
+	// Extensions are looked up lowercased, so the configured keys are too
+	extensions := make(map[string]string, len(overrides.Extensions))
+	for ext, icon := range overrides.Extensions {
+		extensions[strings.ToLower(ext)] = icon
 	}
-	// use nerd fonts when verified
+	is.FileTypeIcons = mergeIcons(is.FileTypeIcons, extensions)
+	is.FileNameIcons = mergeIcons(is.FileNameIcons, overrides.Filenames)
+	is.GlobIcons = mergeIcons(is.GlobIcons, overrides.Globs)
+	is.globPatterns = sortGlobPatterns(is.GlobIcons)
+	is.DirectoryIcons = mergeIcons(is.DirectoryIcons, overrides.Directories)
+	is.MIMEIcons = mergeIcons(is.MIMEIcons, overrides.MIME)
+	return is
+}
+
+// mergeIcons copies base and applies overrides so the built-in sets are never mutated
+func mergeIcons(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// GetFileIcon returns the appropriate icon for an item.
+//
+// Directories resolve in this order: parent entry, exact directory name, glob,
+// then the open or closed directory icon. Files resolve in this order: broken
+// symlink, special file type (pipe, socket, device), exact file name, glob,
+// extension (longest first, so ".tar.gz" wins over ".gz"), symlink,
+// executable, then the default file icon.
+func (is IconSet) GetFileIcon(item FileItem, expanded bool) string {
 	if item.isDir {
 		if item.name == ".." {
 			return is.ParentDir
 		}
+		if icon, ok := is.DirectoryIcons[item.name]; ok {
+			return icon
+		}
+		if icon, ok := is.matchGlobIcon(item.name); ok {
+			return icon
+		}
+		if expanded {
+			return is.DirectoryOpen
+		}
 		return is.Directory
 	}
 
-	// get file extension
-	ext := filepath.Ext(item.name)
-	if icon, ok := is.FileTypeIcons[ext]; ok {
+	mode := item.mode
+	switch {
+	case item.broken:
+		return is.Missing
+	case mode&fs.ModeNamedPipe != 0:
+		return is.Pipe
+	case mode&fs.ModeSocket != 0:
+		return is.Socket
+	case mode&fs.ModeDevice != 0 && mode&fs.ModeCharDevice != 0:
+		return is.CharDevice
+	case mode&fs.ModeDevice != 0:
+		return is.BlockDevice
+	case mode&fs.ModeIrregular != 0:
+		return is.Special
+	}
+
+	if icon, ok := is.FileNameIcons[item.name]; ok {
+		return icon
+	}
+	if icon, ok := is.matchGlobIcon(item.name); ok {
+		return icon
+	}
+
+	// try every extension from the longest compound one down, ignoring case
+	lower := strings.ToLower(item.name)
+	for i := 0; i < len(lower); i++ {
+		if lower[i] != '.' {
+			continue
+		}
+		if icon, ok := is.FileTypeIcons[lower[i:]]; ok {
+			return icon
+		}
+	}
+
+	// content-detected types cover extensionless scripts and misnamed files
+	if icon, ok := matchMIMEIcon(is.MIMEIcons, item.mime); ok {
 		return icon
 	}
 
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return is.Symlink
+	case mode&0111 != 0:
+		return is.Executable
+	}
+
 	return is.DefaultFile
 }
 
+// matchMIMEIcon returns the icon for an exact MIME type, or else for its major type
+func matchMIMEIcon(icons map[string]string, mimeType string) (string, bool) {
+	if mimeType == "" {
+		return "", false
+	}
+	if icon, ok := icons[mimeType]; ok {
+		return icon, true
+	}
+	major, _, _ := strings.Cut(mimeType, "/")
+	icon, ok := icons[major+"/*"]
+	return icon, ok
+}
+
+// sortGlobPatterns returns the patterns of globs, most specific (longest) first
+func sortGlobPatterns(globs map[string]string) []string {
+	patterns := make([]string, 0, len(globs))
+	for pattern := range globs {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	return patterns
+}
+
+// matchGlobIcon returns the icon of the most specific glob matching name
+func (is IconSet) matchGlobIcon(name string) (string, bool) {
+	for _, pattern := range is.globPatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return is.GlobIcons[pattern], true
+		}
+	}
+	return "", false
+}
+
 // TreeSymbols contains the symbols used to draw the tree
 type TreeSymbols struct {
 	Vertical, Corner, Tee, Horizontal string
@@ -155,22 +373,221 @@ func AsciiTreeSymbols() TreeSymbols {
 	}
 }
 
-// VerifyNerdFont checks if nerd fonts are available in the terminal
-func (dc *DisplayConfig) VerifyNerdFont() bool {
-	if !dc.UseNerdFont {
-		return false
+// RoundedTreeSymbols returns Unicode tree symbols with a rounded corner
+func RoundedTreeSymbols() TreeSymbols {
+	return TreeSymbols{
+		Vertical:   "│",
+		Corner:     "╰",
+		Tee:        "├",
+		Horizontal: "─",
+	}
+}
+
+// HeavyTreeSymbols returns heavy Unicode box-drawing tree symbols
+func HeavyTreeSymbols() TreeSymbols {
+	return TreeSymbols{
+		Vertical:   "┃",
+		Corner:     "┗",
+		Tee:        "┣",
+		Horizontal: "━",
+	}
+}
+
+// DoubleTreeSymbols returns double-line Unicode box-drawing tree symbols
+func DoubleTreeSymbols() TreeSymbols {
+	return TreeSymbols{
+		Vertical:   "║",
+		Corner:     "╚",
+		Tee:        "╠",
+		Horizontal: "═",
+	}
+}
+
+// NoTreeSymbols returns blank symbols so the tree is drawn with indentation only
+func NoTreeSymbols() TreeSymbols {
+	return TreeSymbols{
+		Vertical:   " ",
+		Corner:     " ",
+		Tee:        " ",
+		Horizontal: " ",
+	}
+}
+
+// TreeStyles lists the tree-drawing presets in the order the toggle key cycles through them
+var TreeStyles = []string{"unicode", "rounded", "heavy", "double", "ascii", "none"}
+
+// treeStylePresets maps DisplayConfig.TreeStyle values to their symbols
+var treeStylePresets = map[string]func() TreeSymbols{
+	"unicode": UnicodeTreeSymbols,
+	"rounded": RoundedTreeSymbols,
+	"heavy":   HeavyTreeSymbols,
+	"double":  DoubleTreeSymbols,
+	"ascii":   AsciiTreeSymbols,
+	"none":    NoTreeSymbols,
+}
+
+// isASCII reports whether every symbol can be drawn without Unicode support
+func (ts TreeSymbols) isASCII() bool {
+	for _, s := range []string{ts.Vertical, ts.Corner, ts.Tee, ts.Horizontal} {
+		for i := 0; i < len(s); i++ {
+			if s[i] >= 0x80 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// withOverrides replaces any symbol that has a non-empty override
+func (ts TreeSymbols) withOverrides(overrides TreeSymbols) TreeSymbols {
+	if overrides.Vertical != "" {
+		ts.Vertical = overrides.Vertical
+	}
+	if overrides.Corner != "" {
+		ts.Corner = overrides.Corner
+	}
+	if overrides.Tee != "" {
+		ts.Tee = overrides.Tee
+	}
+	if overrides.Horizontal != "" {
+		ts.Horizontal = overrides.Horizontal
+	}
+	return ts
+}
+
+// ResolveTreeSymbols returns the symbols for TreeStyle with the custom symbols applied.
+// Styles that need Unicode fall back to ASCII when the locale is not UTF-8.
+func (dc DisplayConfig) ResolveTreeSymbols() TreeSymbols {
+	preset, ok := treeStylePresets[dc.TreeStyle]
+	if !ok {
+		preset = UnicodeTreeSymbols
+	}
+	symbols := preset().withOverrides(dc.TreeSymbols)
+
+	if !symbols.isASCII() && !isUTF8Locale() {
+		return AsciiTreeSymbols()
+	}
+	return symbols
+}
+
+// NextTreeStyle advances TreeStyle to the next preset that the locale can draw
+func (dc *DisplayConfig) NextTreeStyle() {
+	current := 0
+	for i, style := range TreeStyles {
+		if style == dc.TreeStyle {
+			current = i
+			break
+		}
+	}
+
+	utf8 := isUTF8Locale()
+	for step := 1; step <= len(TreeStyles); step++ {
+		next := TreeStyles[(current+step)%len(TreeStyles)]
+		if utf8 || treeStylePresets[next]().isASCII() {
+			dc.TreeStyle = next
+			return
+		}
+	}
+}
+
+// Prefixes returns the connector lines drawn before each item. Items at depth 0
+// get no connectors; deeper items get a vertical line for every ancestor that
+// still has siblings below it, followed by a tee or corner.
+func (ts TreeSymbols) Prefixes(items []FileItem, indent int) []string {
+	if indent < 2 {
+		indent = 2
+	}
+
+	// Walk backwards to find which items are the last among their siblings
+	isLast := make([]bool, len(items))
+	var hasSiblingAfter []bool
+	for i := len(items) - 1; i >= 0; i-- {
+		depth := items[i].depth
+		for len(hasSiblingAfter) <= depth {
+			hasSiblingAfter = append(hasSiblingAfter, false)
+		}
+		isLast[i] = !hasSiblingAfter[depth]
+		hasSiblingAfter[depth] = true
+		for k := depth + 1; k < len(hasSiblingAfter); k++ {
+			hasSiblingAfter[k] = false
+		}
+	}
+
+	prefixes := make([]string, len(items))
+	var ancestorLast []bool
+	padding := strings.Repeat(" ", indent-1)
+	for i, item := range items {
+		depth := item.depth
+		for len(ancestorLast) <= depth {
+			ancestorLast = append(ancestorLast, false)
+		}
+		ancestorLast[depth] = isLast[i]
+		if depth == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		for level := 1; level < depth; level++ {
+			if ancestorLast[level] {
+				b.WriteString(" " + padding)
+			} else {
+				b.WriteString(ts.Vertical + padding)
+			}
+		}
+		if isLast[i] {
+			b.WriteString(ts.Corner)
+		} else {
+			b.WriteString(ts.Tee)
+		}
+		b.WriteString(strings.Repeat(ts.Horizontal, indent-1))
+		prefixes[i] = b.String()
+	}
+
+	return prefixes
+}
+
+// ResolveIcons settles on a concrete icon mode, probing the terminal when Icons is auto.
+// Explicit modes are honored even when the terminal was measured not to support them.
+func (dc *DisplayConfig) ResolveIcons() {
+	requested := dc.Icons
+	if requested == "" {
+		requested = IconsUnicode
+		if dc.UseNerdFont {
+			requested = IconsNerd
+		}
+	}
+
+	var caps TermCaps
+	if requested == IconsAuto {
+		caps = DetectTermCaps()
+	} else {
+		caps, _ = CachedTermCaps()
 	}
 
-	// Test character that exists only in nerd fonts
-	testChar := "\uf74a"
-	
-	// Use tcell to check if the character can be displayed
-	width := runewidth.StringWidth(testChar)
-	
-	// If width is 0 or greater than 1, the font likely isn't properly supported
-	dc.fontVerified = width == 1
-	
+	// Asking for Nerd Font icons by name vouches for the font
+	dc.fontVerified = caps.NerdFont || requested == IconsNerd
+	dc.setIconMode(resolveIconMode(requested, caps))
+}
+
+// ToggleNerdFont switches between Nerd Font icons and the best non-Nerd Font fallback.
+// It reports false when Nerd Font icons were enabled without the terminal verifying them.
+func (dc *DisplayConfig) ToggleNerdFont() bool {
+	if dc.iconMode == IconsNerd {
+		if isUTF8Locale() {
+			dc.setIconMode(IconsUnicode)
+		} else {
+			dc.setIconMode(IconsASCII)
+		}
+		return true
+	}
+
+	dc.setIconMode(IconsNerd)
 	return dc.fontVerified
 }
 
+func (dc *DisplayConfig) setIconMode(mode string) {
+	dc.iconMode = mode
+	dc.UseNerdFont = mode == IconsNerd
+}
+
 var DefaultIconSet = UnicodeIconSet()
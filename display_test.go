@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+)
+
+func TestGetFileIconPrecedence(t *testing.T) {
+	icons := UnicodeIconSet().WithOverrides(IconConfig{
+		Filenames:   map[string]string{"Makefile": "M", "go.mod": "G"},
+		Extensions:  map[string]string{".go": "g", ".gz": "z", ".tar.gz": "T", ".PROTO": "P"},
+		Globs:       map[string]string{"*_test.go": "t", "*.go": "x"},
+		Directories: map[string]string{".github": "H"},
+	})
+
+	tests := []struct {
+		name     string
+		item     FileItem
+		expanded bool
+		want     string
+	}{
+		{"Parent directory", FileItem{name: "..", isDir: true}, false, "▴"},
+		{"Named directory", FileItem{name: ".github", isDir: true}, true, "H"},
+		{"Closed directory", FileItem{name: "src", isDir: true}, false, "▸"},
+		{"Open directory", FileItem{name: "src", isDir: true}, true, "▾"},
+		{"Exact filename", FileItem{name: "Makefile", mode: 0755}, false, "M"},
+		{"Filename beats extension", FileItem{name: "go.mod", mode: 0644}, false, "G"},
+		{"Longest glob wins", FileItem{name: "main_test.go", mode: 0644}, false, "t"},
+		{"Glob beats extension", FileItem{name: "main.go", mode: 0644}, false, "x"},
+		{"Compound extension", FileItem{name: "src.TAR.GZ", mode: 0644}, false, "T"},
+		{"Configured extension ignores case", FileItem{name: "api.proto", mode: 0644}, false, "P"},
+		{"Executable", FileItem{name: "run", mode: 0755}, false, "*"},
+		{"Symlink", FileItem{name: "link", mode: fs.ModeSymlink | 0777}, false, "→"},
+		{"Broken symlink", FileItem{name: "main.go", mode: fs.ModeSymlink | 0777, broken: true}, false, "✗"},
+		{"Pipe", FileItem{name: "fifo.go", mode: fs.ModeNamedPipe | 0644}, false, "|"},
+		{"Socket", FileItem{name: "sock", mode: fs.ModeSocket | 0755}, false, "="},
+		{"Block device", FileItem{name: "sda", mode: fs.ModeDevice | 0660}, false, "▪"},
+		{"Char device", FileItem{name: "tty", mode: fs.ModeDevice | fs.ModeCharDevice | 0620}, false, "▫"},
+		{"Default", FileItem{name: "notes", mode: 0644}, false, "•"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := icons.GetFileIcon(tt.item, tt.expanded); got != tt.want {
+				t.Errorf("got icon %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithOverridesDoesNotMutateBase(t *testing.T) {
+	base := NerdFontIconSet()
+	_ = base.WithOverrides(IconConfig{Extensions: map[string]string{".go": "g"}})
+	if base.FileTypeIcons[".go"] == "g" {
+		t.Error("expected base icon set to be unchanged by overrides")
+	}
+}
+
+func TestTreeSymbolsPrefixes(t *testing.T) {
+	items := []FileItem{
+		{name: "..", depth: 0},
+		{name: "src", depth: 0},
+		{name: "cmd", depth: 1},
+		{name: "main.go", depth: 2},
+		{name: "util.go", depth: 1},
+		{name: "go.mod", depth: 0},
+	}
+	want := []string{"", "", "├─", "│ └─", "└─", ""}
+
+	got := UnicodeTreeSymbols().Prefixes(items, 2)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("item %q: got prefix %q, want %q", items[i].name, got[i], want[i])
+		}
+	}
+}
+
+func TestResolveTreeSymbols(t *testing.T) {
+	tests := []struct {
+		name   string
+		style  string
+		custom TreeSymbols
+		lang   string
+		want   TreeSymbols
+	}{
+		{"Heavy preset", "heavy", TreeSymbols{}, "en_US.UTF-8", HeavyTreeSymbols()},
+		{"Unknown style", "fancy", TreeSymbols{}, "en_US.UTF-8", UnicodeTreeSymbols()},
+		{"Custom corner", "unicode", TreeSymbols{Corner: "╰"}, "en_US.UTF-8", RoundedTreeSymbols()},
+		{"Non-UTF-8 locale", "double", TreeSymbols{}, "C", AsciiTreeSymbols()},
+		{"None stays blank", "none", TreeSymbols{}, "C", NoTreeSymbols()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", "")
+			t.Setenv("LC_CTYPE", "")
+			t.Setenv("LANG", tt.lang)
+			dc := DisplayConfig{TreeStyle: tt.style, TreeSymbols: tt.custom}
+			if got := dc.ResolveTreeSymbols(); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextTreeStyleSkipsUnicodeWithoutUTF8(t *testing.T) {
+	t.Setenv("LC_ALL", "C")
+	dc := DisplayConfig{TreeStyle: "ascii"}
+	dc.NextTreeStyle()
+	if dc.TreeStyle != "none" {
+		t.Fatalf("got %q, want %q", dc.TreeStyle, "none")
+	}
+	dc.NextTreeStyle()
+	if dc.TreeStyle != "ascii" {
+		t.Errorf("got %q, want %q", dc.TreeStyle, "ascii")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editorFinishedMsg reports that a terminal program exited and the screen was restored
+type editorFinishedMsg struct {
+	path string
+	err  error
+}
+
+// editFile opens path in the resolved editor, falling back to the system opener.
+// Terminal editors take over the screen through tea.ExecProcess until they exit;
+// GUI editors run detached.
+func (m Model) editFile(path string) (tea.Model, tea.Cmd) {
+	editor := ResolveEditor(m.config.Editor)
+	if editor == "" {
+		if opener := systemOpener(); opener != "" {
+			return m.runHandler(Handler{Name: opener, Command: opener + " {path}", GUI: true}, path)
+		}
+		m.statusBar.setMessage("No editor found; set editor in the config or $EDITOR", MessageError)
+		return m, nil
+	}
+	return m.runHandler(Handler{Name: editor, Command: editor + " {path}", GUI: IsGUIEditor(editor)}, path)
+}
+
+// editSelected opens the selected file in the editor
+func (m Model) editSelected() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.isDir {
+		return m, nil
+	}
+	return m.editFile(item.path)
+}
+
+// handleEditorFinished reports editor failures and reloads the trees, since the
+// editor may have created, renamed or deleted files
+func (m Model) handleEditorFinished(msg editorFinishedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.statusBar.setMessage(fmt.Sprintf("Editor exited with error: %v", msg.err), MessageError)
+	}
+	return m, m.reloadPanes()
+}
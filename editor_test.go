@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEditorCommand(t *testing.T) {
+	cmd, err := EditorCommand("code --reuse-window", "/tmp/file.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"code", "--reuse-window", "/tmp/file.go"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("got args %v, want %v", cmd.Args, want)
+	}
+	if _, err := EditorCommand("  ", "/tmp/file.go"); err == nil {
+		t.Error("expected an error for an empty editor")
+	}
+}
+
+func TestIsGUIEditor(t *testing.T) {
+	tests := map[string]bool{
+		"code":                 true,
+		"/usr/bin/code --wait": true,
+		"subl":                 true,
+		"vim":                  false,
+		"nano":                 false,
+		"hx":                   false,
+		"":                     false,
+	}
+	for editor, want := range tests {
+		if got := IsGUIEditor(editor); got != want {
+			t.Errorf("IsGUIEditor(%q) = %v, want %v", editor, got, want)
+		}
+	}
+}
+
+func TestTerminalEditorRefreshesTree(t *testing.T) {
+	dir := t.TempDir()
+	m := tabModel(dir)
+	m.config.Editor = "vim"
+
+	// Terminal editors hand the screen over through a command rather than starting directly
+	if _, cmd := m.editFile(dir + "/file.txt"); cmd == nil {
+		t.Fatal("expected an exec command for a terminal editor")
+	}
+
+	newModel, cmd := m.Update(editorFinishedMsg{path: dir + "/file.txt", err: errors.New("exit status 1")})
+	m = newModel.(Model)
+	if cmd == nil {
+		t.Error("expected the tree to reload after the editor exits")
+	}
+	if m.statusBar.message == "" {
+		t.Error("expected the editor error in the status bar")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -13,8 +15,16 @@ type FileTree struct {
 	root      string
 	items     []FileItem
 	cursor    int
+	offset    int // index of the first visible item
 	expanded  map[string]bool
 	showHidden bool
+	sortBy    SortMode
+	filter    string // shell pattern files must match; directories are always shown
+	marked    map[string]bool // paths of marked items
+	expandDepth int // expand every directory this many levels deep; negative for unlimited
+	dirsOnly  bool  // list directories only
+	selectPath string // item to put the cursor on when the next listing arrives
+	fs        FS     // filesystem the tree lists
 }
 
 type FileItem struct {
@@ -22,18 +32,146 @@ type FileItem struct {
 	name     string
 	isDir    bool
 	mode     fs.FileMode
+	size     int64
+	modTime  time.Time
+	broken   bool // symlink whose target does not exist
+	depth    int  // nesting level below the tree's current directory
+	mime     string // detected MIME type, empty for directories and broken symlinks
+	archive  bool   // archive the tree's FS can expand like a directory
+	entry    bool   // lives inside an archive
+	guessed  bool   // mime comes from the name; the contents have not been read yet
+}
+
+// expandable reports whether the item lists children when expanded
+func (item FileItem) expandable() bool {
+	return (item.isDir || item.archive) && item.name != ".."
+}
+
+// SortMode selects the order of items within a directory
+type SortMode int
+
+const (
+	SortName SortMode = iota
+	SortSize
+	SortModTime
+	SortExtension
+)
+
+// sortModeNames are shown in the status bar when the sort order changes
+var sortModeNames = map[SortMode]string{
+	SortName:      "name",
+	SortSize:      "size",
+	SortModTime:   "modified",
+	SortExtension: "extension",
+}
+
+// sortNames lists the sort mode names in cycling order
+func sortNames() []string {
+	names := make([]string, len(sortModeNames))
+	for mode, name := range sortModeNames {
+		names[mode] = name
+	}
+	return names
+}
+
+// parseSortMode returns the sort mode with the given name
+func parseSortMode(name string) (SortMode, bool) {
+	for mode, modeName := range sortModeNames {
+		if modeName == name {
+			return mode, true
+		}
+	}
+	return SortName, false
+}
+
+// listOptions controls which items a directory listing includes and how they are ordered
+type listOptions struct {
+	showHidden  bool
+	sortBy      SortMode
+	filter      string
+	expandDepth int // directories at depths below this are expanded regardless of the expanded set; negative for all
+	dirsOnly    bool
+}
+
+// expands reports whether the options expand every directory at depth
+func (o listOptions) expands(depth int) bool {
+	return o.expandDepth < 0 || depth < o.expandDepth
+}
+
+// listOptions returns the listing options of the tree
+func (t *FileTree) listOptions() listOptions {
+	return listOptions{
+		showHidden:  t.showHidden,
+		sortBy:      t.sortBy,
+		filter:      t.filter,
+		expandDepth: t.expandDepth,
+		dirsOnly:    t.dirsOnly,
+	}
+}
+
+// CycleSort switches to the next sort order and returns a command to reload the tree
+func (t *FileTree) CycleSort() tea.Cmd {
+	t.sortBy = (t.sortBy + 1) % SortMode(len(sortModeNames))
+	return t.LoadDirectory(t.root)
+}
+
+// SetFilter limits the files shown to those matching pattern; an empty pattern shows everything
+func (t *FileTree) SetFilter(pattern string) tea.Cmd {
+	t.filter = pattern
+	t.cursor = 0
+	t.offset = 0
+	return t.LoadDirectory(t.root)
 }
 
 func NewFileTree(root string) *FileTree {
 	return &FileTree{
 		root:      root,
 		expanded:  make(map[string]bool),
+		marked:    make(map[string]bool),
 		showHidden: true,
+		fs:        NewMountFS(OSFS{}),
 	}
 }
 
-// LoadDirectory reads the directory contents and returns a command
+// setItems installs a new listing, keeping the cursor in range. A pending
+// selectPath moves the cursor to that item, and an initial expandDepth is
+// turned into ordinary expanded directories so they can be collapsed again.
+func (t *FileTree) setItems(items []FileItem) {
+	t.items = items
+	if t.expandDepth != 0 {
+		opts := t.listOptions()
+		for _, item := range items {
+			if item.isDir && item.name != ".." && opts.expands(item.depth) {
+				t.expanded[item.path] = true
+			}
+		}
+		t.expandDepth = 0
+	}
+	if t.selectPath != "" {
+		for i, item := range items {
+			if item.path == t.selectPath {
+				t.cursor = i
+				break
+			}
+		}
+		t.selectPath = ""
+	}
+	if t.cursor >= len(t.items) {
+		t.cursor = max(len(t.items)-1, 0)
+	}
+}
+
+// LoadDirectory reads the directory contents, along with the contents of any
+// expanded subdirectories, and returns a command
 func (t *FileTree) LoadDirectory(dir string) tea.Cmd {
+	// Snapshot the expansion state so the command can run off the update loop
+	expanded := make(map[string]bool, len(t.expanded))
+	for path := range t.expanded {
+		expanded[path] = true
+	}
+	opts := t.listOptions()
+	fsys := t.fs
+
 	return func() tea.Msg {
 		items := []FileItem{}
 		
@@ -46,41 +184,166 @@ func (t *FileTree) LoadDirectory(dir string) tea.Cmd {
 			})
 		}
 
-		entries, err := os.ReadDir(dir)
+		children, err := readDirItems(fsys, dir, opts, 0, expanded)
 		if err != nil {
 			return errMsg{err}
 		}
+		items = append(items, children...)
+
+		return loadedDirectoryMsg{tree: t, items: items}
+	}
+}
+
+// readDirItems lists dir sorted with directories first, recursing into
+// expanded subdirectories so their children follow them at depth+1
+func readDirItems(fsys FS, dir string, opts listOptions, depth int, expanded map[string]bool) ([]FileItem, error) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []FileItem{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
 
-		for _, entry := range entries {
-			info, err := entry.Info()
-			if err != nil {
-				continue
+		name := entry.Name()
+		// Skip hidden files if showHidden is false
+		if !opts.showHidden && name[0] == '.' && name != ".." {
+			continue
+		}
+		// Directories stay visible so matching files below them can still be reached
+		if opts.filter != "" && !entry.IsDir() && !matchFilter(opts.filter, name) {
+			continue
+		}
+		if opts.dirsOnly && !entry.IsDir() {
+			continue
+		}
+
+		item := FileItem{
+			path:    filepath.Join(dir, name),
+			name:    name,
+			isDir:   entry.IsDir(),
+			mode:    info.Mode(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			depth:   depth,
+		}
+		if item.mode&fs.ModeSymlink != 0 {
+			if _, err := fsys.Stat(item.path); err != nil {
+				item.broken = true
 			}
+		}
+		if !item.isDir && !item.broken {
+			// Reading every file would make big and remote listings slow, so
+			// contents are only read once the item is shown
+			item.mime, item.guessed = mimeTypes.Guess(fsys, item.path, info)
+			item.archive = expandsAsArchive(fsys, item)
+		}
+		items = append(items, item)
+	}
+
+	sortItems(items, opts.sortBy)
 
-			name := entry.Name()
-			// Skip hidden files if showHidden is false
-			if !t.showHidden && name[0] == '.' && name != ".." {
-				continue
+	result := make([]FileItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, item)
+		// Archives only open on request, since reading one can be slow
+		if item.isDir && (expanded[item.path] || opts.expands(depth)) || item.archive && expanded[item.path] {
+			// An unreadable subdirectory shows as empty rather than failing the whole tree
+			children, err := readDirItems(fsys, item.path, opts, depth+1, expanded)
+			if err == nil {
+				for i := range children {
+					children[i].entry = item.archive || item.entry
+				}
+				result = append(result, children...)
 			}
+		}
+	}
 
-			items = append(items, FileItem{
-				path:  filepath.Join(dir, name),
-				name:  name,
-				isDir: entry.IsDir(),
-				mode:  info.Mode(),
-			})
+	return result, nil
+}
+
+// expandsAsArchive reports whether item is an archive that fsys can expand
+func expandsAsArchive(fsys FS, item FileItem) bool {
+	if _, ok := fsys.(*MountFS); !ok || archiveKind(item.name, item.mime) == "" {
+		return false
+	}
+	return item.mode.IsRegular() || item.mode&fs.ModeSymlink != 0
+}
+
+// detectVisible returns a command that reads the contents of the visible items
+// whose MIME type was guessed from the name
+func (t *FileTree) detectVisible(rows int) tea.Cmd {
+	var paths []string
+	end := min(t.offset+rows, len(t.items))
+	for i := t.offset; i < end; i++ {
+		if t.items[i].guessed {
+			// Once is enough, however often the rows are shown before the answer
+			t.items[i].guessed = false
+			paths = append(paths, t.items[i].path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	fsys := t.fs
+	return func() tea.Msg {
+		types := make(map[string]string, len(paths))
+		for _, path := range paths {
+			types[path] = mimeTypes.DetectFS(fsys, path, nil)
 		}
+		return detectedMIMEMsg{tree: t, types: types}
+	}
+}
 
-		// Sort items: directories first, then files, both alphabetically
-		sort.Slice(items, func(i, j int) bool {
-			if items[i].isDir != items[j].isDir {
-				return items[i].isDir
+// setMIMETypes records the detected MIME types of items, keyed by path
+func (t *FileTree) setMIMETypes(types map[string]string) {
+	for i := range t.items {
+		if mimeType, ok := types[t.items[i].path]; ok {
+			t.items[i].mime = mimeType
+			t.items[i].guessed = false
+			t.items[i].archive = expandsAsArchive(t.fs, t.items[i])
+		}
+	}
+}
+
+// sortItems sorts directories first, then files, each by the sort mode with name as the tie-breaker
+func sortItems(items []FileItem, sortBy SortMode) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.isDir != b.isDir {
+			return a.isDir
+		}
+		switch sortBy {
+		case SortSize:
+			if a.size != b.size {
+				return a.size > b.size
+			}
+		case SortModTime:
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.After(b.modTime)
+			}
+		case SortExtension:
+			if extA, extB := filepath.Ext(a.name), filepath.Ext(b.name); extA != extB {
+				return extA < extB
 			}
-			return items[i].name < items[j].name
-		})
+		}
+		return a.name < b.name
+	})
+}
 
-		return loadedDirectoryMsg{items}
+// matchFilter reports whether name matches a filter. Patterns without glob
+// characters match as a case-insensitive substring.
+func matchFilter(filter, name string) bool {
+	if strings.ContainsAny(filter, "*?[") {
+		matched, _ := filepath.Match(filter, name)
+		return matched
 	}
+	return strings.Contains(strings.ToLower(name), strings.ToLower(filter))
 }
 
 // MoveUp moves the cursor up
@@ -97,25 +360,141 @@ func (t *FileTree) MoveDown() {
 	}
 }
 
-// ToggleExpand expands or collapses the current directory
+// ScrollIntoView adjusts the scroll offset so the cursor is within the visible rows
+func (t *FileTree) ScrollIntoView(rows int) {
+	if rows <= 0 {
+		return
+	}
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	} else if t.cursor >= t.offset+rows {
+		t.offset = t.cursor - rows + 1
+	}
+	t.offset = max(min(t.offset, len(t.items)-rows), 0)
+}
+
+// Scroll moves the visible rows by delta items, dragging the cursor along so it stays visible
+func (t *FileTree) Scroll(delta, rows int) {
+	if rows <= 0 {
+		return
+	}
+	t.offset = max(min(t.offset+delta, len(t.items)-rows), 0)
+	if t.cursor < t.offset {
+		t.cursor = t.offset
+	} else if t.cursor >= t.offset+rows {
+		t.cursor = t.offset + rows - 1
+	}
+}
+
+// ItemAt returns the index of the item drawn on the given visible row, or -1
+func (t *FileTree) ItemAt(row int) int {
+	index := t.offset + row
+	if row < 0 || index >= len(t.items) {
+		return -1
+	}
+	return index
+}
+
+// ToggleExpand expands or collapses the current directory or archive
 func (t *FileTree) ToggleExpand() tea.Cmd {
 	if t.cursor >= len(t.items) {
 		return nil
 	}
 
 	item := t.items[t.cursor]
-	if !item.isDir {
+	if !item.expandable() {
 		return nil
 	}
 
 	if t.expanded[item.path] {
-		delete(t.expanded, item.path)
-	} else {
-		t.expanded[item.path] = true
-		return t.LoadDirectory(item.path)
+		t.Collapse()
+		return nil
+	}
+
+	t.expanded[item.path] = true
+	return t.loadChildren(item)
+}
+
+// loadChildren reads the contents of a directory or archive being expanded,
+// without rereading the rest of the tree, and returns a command
+func (t *FileTree) loadChildren(parent FileItem) tea.Cmd {
+	expanded := make(map[string]bool, len(t.expanded))
+	for path := range t.expanded {
+		expanded[path] = true
 	}
+	opts := t.listOptions()
+	fsys := t.fs
 
-	return nil
+	return func() tea.Msg {
+		children, err := readDirItems(fsys, parent.path, opts, parent.depth+1, expanded)
+		if err != nil {
+			return errMsg{err}
+		}
+		for i := range children {
+			children[i].entry = parent.archive || parent.entry
+		}
+		return loadedChildrenMsg{tree: t, parent: parent.path, items: children}
+	}
+}
+
+// insertChildren shows the contents of an expanded item below it, replacing
+// any it already had. Nothing changes if the item was collapsed or has gone
+// since the contents were requested.
+func (t *FileTree) insertChildren(parent string, children []FileItem) {
+	if !t.expanded[parent] {
+		return
+	}
+	index := -1
+	for i, item := range t.items {
+		if item.path == parent && item.name != ".." {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+
+	end := index + 1
+	for end < len(t.items) && t.items[end].depth > t.items[index].depth {
+		end++
+	}
+	items := make([]FileItem, 0, len(t.items)-(end-index-1)+len(children))
+	items = append(items, t.items[:index+1]...)
+	items = append(items, children...)
+	items = append(items, t.items[end:]...)
+	if t.cursor >= end {
+		t.cursor += len(items) - len(t.items)
+	}
+	t.items = items
+}
+
+// Collapse collapses the directory under the cursor and drops its visible descendants
+func (t *FileTree) Collapse() {
+	if t.cursor >= len(t.items) {
+		return
+	}
+
+	item := t.items[t.cursor]
+	for path := range t.expanded {
+		if path == item.path || strings.HasPrefix(path, item.path+string(os.PathSeparator)) {
+			delete(t.expanded, path)
+		}
+	}
+
+	end := t.cursor + 1
+	for end < len(t.items) && t.items[end].depth > item.depth {
+		end++
+	}
+	t.items = append(t.items[:t.cursor+1], t.items[end:]...)
+}
+
+// SetRoot changes the directory the tree is rooted at and returns a command to load it
+func (t *FileTree) SetRoot(dir string) tea.Cmd {
+	t.root = dir
+	t.cursor = 0
+	t.offset = 0
+	return t.LoadDirectory(dir)
 }
 
 // ToggleHidden toggles visibility of hidden files
@@ -124,6 +503,44 @@ func (t *FileTree) ToggleHidden() tea.Cmd {
 	return t.LoadDirectory(t.root)
 }
 
+// ToggleMark marks or unmarks the item under the cursor and moves to the next item
+func (t *FileTree) ToggleMark() {
+	item := t.GetSelectedItem()
+	if item == nil || item.name == ".." {
+		return
+	}
+	if t.marked == nil {
+		t.marked = make(map[string]bool)
+	}
+	if t.marked[item.path] {
+		delete(t.marked, item.path)
+	} else {
+		t.marked[item.path] = true
+	}
+	t.MoveDown()
+}
+
+// MarkedPaths returns the marked paths in tree order, followed by marked paths
+// that are no longer visible
+func (t *FileTree) MarkedPaths() []string {
+	var paths []string
+	seen := make(map[string]bool, len(t.marked))
+	for _, item := range t.items {
+		if t.marked[item.path] {
+			paths = append(paths, item.path)
+			seen[item.path] = true
+		}
+	}
+	var hidden []string
+	for path := range t.marked {
+		if !seen[path] {
+			hidden = append(hidden, path)
+		}
+	}
+	sort.Strings(hidden)
+	return append(paths, hidden...)
+}
+
 // GetSelectedItem returns the currently selected FileItem
 func (t *FileTree) GetSelectedItem() *FileItem {
 	if t.cursor >= len(t.items) {
@@ -134,9 +551,23 @@ func (t *FileTree) GetSelectedItem() *FileItem {
 
 // Custom messages
 type loadedDirectoryMsg struct {
+	tree  *FileTree // the tree that requested the load
 	items []FileItem
 }
 
+// loadedChildrenMsg carries the contents of a directory or archive that was expanded
+type loadedChildrenMsg struct {
+	tree   *FileTree
+	parent string
+	items  []FileItem
+}
+
+// detectedMIMEMsg carries the MIME types of items detected from their contents
+type detectedMIMEMsg struct {
+	tree  *FileTree
+	types map[string]string
+}
+
 type errMsg struct {
 	error
 }
\ No newline at end of file
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadDirItemsExpanded(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/nested", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"a/one.txt", "a/nested/two.txt", "b/three.txt", "z.txt", ".hidden"} {
+		if err := os.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expanded := map[string]bool{
+		filepath.Join(root, "a"):        true,
+		filepath.Join(root, "a/nested"): true,
+	}
+	items, err := readDirItems(OSFS{}, root, listOptions{}, 0, expanded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name  string
+		depth int
+	}{
+		{"a", 0}, {"nested", 1}, {"two.txt", 2}, {"one.txt", 1}, {"b", 0}, {"z.txt", 0},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for i, w := range want {
+		if items[i].name != w.name || items[i].depth != w.depth {
+			t.Errorf("item %d: got %s@%d, want %s@%d", i, items[i].name, items[i].depth, w.name, w.depth)
+		}
+	}
+}
+
+func TestCollapseRemovesDescendants(t *testing.T) {
+	tree := NewFileTree("/root")
+	tree.items = []FileItem{
+		{path: "/root/a", name: "a", isDir: true, depth: 0},
+		{path: "/root/a/b", name: "b", isDir: true, depth: 1},
+		{path: "/root/a/b/c", name: "c", depth: 2},
+		{path: "/root/z", name: "z", depth: 0},
+	}
+	tree.expanded["/root/a"] = true
+	tree.expanded["/root/a/b"] = true
+
+	tree.Collapse()
+
+	if len(tree.items) != 2 || tree.items[1].name != "z" {
+		t.Errorf("expected descendants of a to be removed, got %+v", tree.items)
+	}
+	if len(tree.expanded) != 0 {
+		t.Errorf("expected nested expansion state to be cleared, got %v", tree.expanded)
+	}
+}
+
+func TestReadDirItemsSortAndFilter(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int{"a.go": 3, "b.txt": 10, "c.go": 1}
+	for name, size := range files {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(items []FileItem) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		opts listOptions
+		want []string
+	}{
+		{"by size", listOptions{sortBy: SortSize}, []string{"dir", "b.txt", "a.go", "c.go"}},
+		{"by extension", listOptions{sortBy: SortExtension}, []string{"dir", "a.go", "c.go", "b.txt"}},
+		{"glob filter keeps directories", listOptions{filter: "*.go"}, []string{"dir", "a.go", "c.go"}},
+		{"substring filter", listOptions{filter: "TX"}, []string{"dir", "b.txt"}},
+	}
+	for _, tt := range tests {
+		items, err := readDirItems(OSFS{}, root, tt.opts, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(items); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestToggleExpandReadsOnlyThatDirectory(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.MkdirAll("/p/a", 0755)
+	fsys.MkdirAll("/p/b", 0755)
+	WriteFile(fsys, "/p/b/y.txt", nil, 0644)
+	WriteFile(fsys, "/p/z.txt", nil, 0644)
+
+	tree := NewFileTree("/p")
+	tree.fs = fsys
+	tree.setItems(tree.LoadDirectory("/p")().(loadedDirectoryMsg).items)
+	// Not listed until the whole tree is reloaded
+	WriteFile(fsys, "/p/new.txt", nil, 0644)
+
+	tree.cursor = 2 // b
+	msg, ok := tree.ToggleExpand()().(loadedChildrenMsg)
+	if !ok {
+		t.Fatal("expected expanding to list only the directory")
+	}
+	tree.cursor = 3 // z.txt, moved to while the listing was read
+	tree.insertChildren(msg.parent, msg.items)
+
+	var got []string
+	for _, item := range tree.items {
+		got = append(got, item.path)
+	}
+	want := []string{"/", "/p/a", "/p/b", "/p/b/y.txt", "/p/z.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if tree.items[3].depth != 1 {
+		t.Errorf("got depth %d for y.txt, want 1", tree.items[3].depth)
+	}
+	if tree.cursor != 4 {
+		t.Errorf("expected the cursor to stay on z.txt, got %d", tree.cursor)
+	}
+}
+
+func TestInsertChildrenIgnoresCollapsedDirectory(t *testing.T) {
+	tree := NewFileTree("/root")
+	tree.items = []FileItem{
+		{path: "/root/a", name: "a", isDir: true, depth: 0},
+		{path: "/root/z", name: "z", depth: 0},
+	}
+
+	// Collapsed again before its contents arrived
+	tree.insertChildren("/root/a", []FileItem{{path: "/root/a/b", name: "b", depth: 1}})
+
+	if len(tree.items) != 2 {
+		t.Errorf("expected the listing to be dropped, got %+v", tree.items)
+	}
+}
+
+func TestMIMEDetectedOnlyForVisibleItems(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.MkdirAll("/p", 0755)
+	WriteFile(fsys, "/p/a-deploy", []byte("#!/bin/sh\necho hi\n"), 0755)
+	WriteFile(fsys, "/p/b-deploy", []byte("#!/bin/sh\necho hi\n"), 0755)
+
+	tree := NewFileTree("/p")
+	tree.fs = fsys
+	tree.setItems(tree.LoadDirectory("/p")().(loadedDirectoryMsg).items)
+	if !tree.items[1].guessed || tree.items[1].mime != "" {
+		t.Fatalf("expected the listing not to read a-deploy, got %q", tree.items[1].mime)
+	}
+
+	// Only ".." and a-deploy fit
+	msg := tree.detectVisible(2)().(detectedMIMEMsg)
+	tree.setMIMETypes(msg.types)
+	if got := tree.items[1].mime; got != "application/x-shellscript" {
+		t.Errorf("got %q for a-deploy, want application/x-shellscript", got)
+	}
+	if !tree.items[2].guessed || tree.items[2].mime != "" {
+		t.Errorf("expected b-deploy to wait until it is shown, got %q", tree.items[2].mime)
+	}
+	if tree.detectVisible(2) != nil {
+		t.Error("expected shown items to be read only once")
+	}
+}
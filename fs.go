@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Modes for FS.Access, as in access(2)
+const (
+	AccessExists  = unix.F_OK
+	AccessRead    = unix.R_OK
+	AccessWrite   = unix.W_OK
+	AccessExecute = unix.X_OK
+)
+
+// File is an open file of an FS
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Stat() (fs.FileInfo, error)
+}
+
+// FS is the filesystem the tree and file operations work on, so they can run
+// against the disk, an in-memory tree in tests, or another backend. Errors
+// follow the os package: they can be tested with errors.Is against fs.ErrNotExist,
+// fs.ErrExist and fs.ErrPermission.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)  // follows symlinks
+	Lstat(name string) (fs.FileInfo, error) // describes a symlink itself
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Readlink(name string) (string, error)
+	Open(name string) (File, error)                     // for reading
+	Create(name string, perm fs.FileMode) (File, error) // for writing, truncating an existing file
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error // a file or an empty directory
+	RemoveAll(name string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Symlink(oldname, newname string) error
+	Access(name string, mode uint32) error // mode is a combination of the Access constants
+}
+
+// OwnerFS is an FS whose files have owners that can be changed
+type OwnerFS interface {
+	Lchown(name string, uid, gid int) error
+}
+
+// XattrFS is an FS with extended attributes, which also hold POSIX ACLs
+type XattrFS interface {
+	Listxattr(name string) ([]string, error)
+	Getxattr(name, attr string) ([]byte, error)
+	Setxattr(name, attr string, data []byte) error
+}
+
+// OSFS is the FS of the operating system
+type OSFS struct{}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (OSFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (OSFS) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (OSFS) Open(name string) (File, error)             { return os.Open(name) }
+
+func (OSFS) Create(name string, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (OSFS) Mkdir(name string, perm fs.FileMode) error    { return os.Mkdir(name, perm) }
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+func (OSFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFS) Remove(name string) error                     { return os.Remove(name) }
+func (OSFS) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (OSFS) Chmod(name string, mode fs.FileMode) error    { return os.Chmod(name, mode) }
+func (OSFS) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OSFS) Access(name string, mode uint32) error {
+	if err := unix.Access(name, mode); err != nil {
+		return &fs.PathError{Op: "access", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (OSFS) Lchown(name string, uid, gid int) error {
+	if err := unix.Lchown(name, uid, gid); err != nil {
+		return &fs.PathError{Op: "lchown", Path: name, Err: err}
+	}
+	return nil
+}
+
+// ReadFile reads the whole file at name from fsys
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// WriteFile writes data to name in fsys, creating it with perm if it does not exist
+func WriteFile(fsys FS, name string, data []byte, perm fs.FileMode) error {
+	f, err := fsys.Create(name, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Walk calls fn for root and everything below it in lexical order, like
+// filepath.Walk but through fsys. Symlinks are reported, not followed.
+func Walk(fsys FS, root string, fn func(path string, info fs.FileInfo, err error) error) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(fsys, root, info, fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walk(fsys FS, path string, info fs.FileInfo, fn func(string, fs.FileInfo, error) error) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	entries, err := fsys.ReadDir(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		childInfo, err := fsys.Lstat(child)
+		if err != nil {
+			if err := fn(child, childInfo, err); err != nil && err != fs.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walk(fsys, child, childInfo, fn); err != nil {
+			if !childInfo.IsDir() || err != fs.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Extended attributes of the OS, on the systems that have them
+
+func (OSFS) Listxattr(name string) ([]string, error) {
+	buf, err := xattrBuffer(func(buf []byte) (int, error) { return unix.Listxattr(name, buf) })
+	if err != nil {
+		return nil, &fs.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	var names []string
+	for _, attr := range strings.Split(string(buf), "\x00") {
+		if attr != "" {
+			names = append(names, attr)
+		}
+	}
+	return names, nil
+}
+
+func (OSFS) Getxattr(name, attr string) ([]byte, error) {
+	buf, err := xattrBuffer(func(buf []byte) (int, error) { return unix.Getxattr(name, attr, buf) })
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return buf, nil
+}
+
+func (OSFS) Setxattr(name, attr string, data []byte) error {
+	if err := unix.Setxattr(name, attr, data, 0); err != nil {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+// xattrBuffer calls get with a buffer large enough for its result, which may
+// grow between asking for the size and reading it
+func xattrBuffer(get func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+var _ XattrFS = OSFS{}
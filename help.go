@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Styles for the help overlay
+var (
+	helpBoxStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			Padding(0, 1)
+
+	helpCategoryStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	helpKeyStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+)
+
+// helpChromeLines is the number of overlay lines that are not bindings (border, title, search)
+const helpChromeLines = 6
+
+// HelpOverlay lists the key bindings of the view it was opened from
+type HelpOverlay struct {
+	source View
+	filter string
+	offset int
+}
+
+// NewHelpOverlay creates a help overlay for the bindings of source
+func NewHelpOverlay(source View) *HelpOverlay {
+	return &HelpOverlay{source: source}
+}
+
+// Update handles a key press and reports whether the overlay should close.
+// Keys that are not bound in the help view are typed into the search field.
+func (h *HelpOverlay) Update(keys KeyMap, msg tea.KeyMsg) bool {
+	switch keys.Lookup(HelpView, msg.String()) {
+	case ActionHelpClose:
+		return true
+	case ActionHelpScrollUp:
+		if h.offset > 0 {
+			h.offset--
+		}
+	case ActionHelpScrollDown:
+		h.offset++
+	case ActionHelpBackspace:
+		if h.filter != "" {
+			runes := []rune(h.filter)
+			h.filter = string(runes[:len(runes)-1])
+			h.offset = 0
+		}
+	default:
+		if msg.Type != tea.KeyRunes {
+			return false
+		}
+		// "?" toggles the overlay closed unless a search is being typed
+		if h.filter == "" && msg.String() == "?" {
+			return true
+		}
+		h.filter += string(msg.Runes)
+		h.offset = 0
+	}
+	return false
+}
+
+// lines returns the bindings matching the search, grouped by category in the
+// order categories first appear in the key map
+func (h *HelpOverlay) lines(keys KeyMap) []string {
+	filter := strings.ToLower(h.filter)
+	groups := make(map[string][]KeyBinding)
+	var categories []string
+
+	for _, binding := range keys.Bindings(h.source) {
+		if filter != "" {
+			haystack := strings.ToLower(binding.Category + " " + binding.Help + " " + binding.KeyNames() + " " + string(binding.Action))
+			if !strings.Contains(haystack, filter) {
+				continue
+			}
+		}
+		if _, ok := groups[binding.Category]; !ok {
+			categories = append(categories, binding.Category)
+		}
+		groups[binding.Category] = append(groups[binding.Category], binding)
+	}
+
+	var lines []string
+	for i, category := range categories {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, helpCategoryStyle.Render(category))
+		for _, binding := range groups[category] {
+			keyText := fmt.Sprintf("%-16s", binding.KeyNames())
+			lines = append(lines, "  "+helpKeyStyle.Render(keyText)+" "+binding.Help)
+		}
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, "No matching key bindings")
+	}
+	return lines
+}
+
+// View renders the overlay within the given terminal size; zero means unbounded
+func (h *HelpOverlay) View(keys KeyMap, width, height int) string {
+	lines := h.lines(keys)
+
+	if height > helpChromeLines {
+		visible := height - helpChromeLines
+		maxOffset := max(len(lines)-visible, 0)
+		h.offset = min(h.offset, maxOffset)
+		lines = lines[h.offset:min(h.offset+visible, len(lines))]
+	}
+
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(fmt.Sprintf("Key bindings: %s", viewNames[h.source])) + "\n")
+	b.WriteString(fmt.Sprintf("Search: %s█", h.filter) + "\n\n")
+	b.WriteString(strings.Join(lines, "\n"))
+
+	style := helpBoxStyle
+	if width > 4 {
+		style = style.MaxWidth(width)
+	}
+	return style.Render(b.String())
+}
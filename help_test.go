@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestHelpOverlaySearch(t *testing.T) {
+	keys := DefaultKeyMap()
+	help := NewHelpOverlay(TreeView)
+
+	for _, r := range "hidden" {
+		if help.Update(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}) {
+			t.Fatal("expected typing to keep the overlay open")
+		}
+	}
+
+	view := help.View(keys, 0, 0)
+	if !strings.Contains(view, "toggle hidden files") {
+		t.Errorf("expected matching binding in view, got %q", view)
+	}
+	if strings.Contains(view, "move up") {
+		t.Errorf("expected non-matching bindings to be filtered out, got %q", view)
+	}
+}
+
+func TestHelpOverlayClose(t *testing.T) {
+	keys := DefaultKeyMap()
+
+	help := NewHelpOverlay(TreeView)
+	if !help.Update(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")}) {
+		t.Error("expected ? to close the overlay when not searching")
+	}
+
+	help = NewHelpOverlay(TreeView)
+	help.Update(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	if help.Update(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")}) {
+		t.Error("expected ? to be searched for once a search is typed")
+	}
+	if !help.Update(keys, tea.KeyMsg{Type: tea.KeyEsc}) {
+		t.Error("expected esc to close the overlay")
+	}
+}
+
+func TestHandleTreeViewKeysOpensHelp(t *testing.T) {
+	m := Model{activeView: TreeView, tree: NewFileTree("/")}
+	newModel, _ := m.handleTreeViewKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")})
+	result := newModel.(Model)
+	if result.activeView != HelpView || result.help == nil {
+		t.Fatal("expected ? to open the help overlay")
+	}
+
+	newModel, _ = result.handleHelpViewKeys(tea.KeyMsg{Type: tea.KeyEsc})
+	result = newModel.(Model)
+	if result.activeView != TreeView {
+		t.Errorf("expected help to return to the tree view, got %v", result.activeView)
+	}
+}
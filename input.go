@@ -12,6 +12,9 @@ const (
 	InputRename InputType = iota
 	InputMove
 	InputCopy
+	InputFilter
+	InputCompress
+	InputExtract
 )
 
 type Input struct {
@@ -26,6 +29,9 @@ func NewInput(inputType InputType, initialValue string) *Input {
 		InputRename: "Rename to: ",
 		InputMove: "Move to: ",
 		InputCopy: "Copy to: ",
+		InputFilter: "Filter: ",
+		InputCompress: "Compress to: ",
+		InputExtract: "Extract to: ",
 	}
 
 	return &Input{
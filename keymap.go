@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Action identifies something a key can be bound to
+type Action string
+
+// Tree view actions
+const (
+	ActionQuit           Action = "quit"
+	ActionQuitCD         Action = "quit_cd"
+	ActionUp             Action = "up"
+	ActionDown           Action = "down"
+	ActionExpand         Action = "expand"
+	ActionCollapse       Action = "collapse"
+	ActionRename         Action = "rename"
+	ActionMove           Action = "move"
+	ActionCopy           Action = "copy"
+	ActionDelete         Action = "delete"
+	ActionCompress       Action = "compress"
+	ActionExtract        Action = "extract"
+	ActionSwitchPane     Action = "switch_pane"
+	ActionDualPane       Action = "dual_pane"
+	ActionSort           Action = "sort"
+	ActionEdit           Action = "edit"
+	ActionToggleMark     Action = "toggle_mark"
+	ActionOpen           Action = "open"
+	ActionOpenWith       Action = "open_with"
+	ActionTogglePreview  Action = "toggle_preview"
+	ActionFilter         Action = "filter"
+	ActionNewTab         Action = "new_tab"
+	ActionOpenInTab      Action = "open_in_tab"
+	ActionCloseTab       Action = "close_tab"
+	ActionNextTab        Action = "next_tab"
+	ActionPrevTab        Action = "prev_tab"
+	ActionMoveTabLeft    Action = "move_tab_left"
+	ActionMoveTabRight   Action = "move_tab_right"
+	ActionJumpTab        Action = "jump_tab"
+	ActionToggleHidden   Action = "toggle_hidden"
+	ActionToggleNerdFont Action = "toggle_nerd_font"
+	ActionTreeStyle      Action = "tree_style"
+	ActionToggleMouse    Action = "toggle_mouse"
+	ActionHelp           Action = "help"
+)
+
+// Input view actions
+const (
+	ActionInputConfirm   Action = "input_confirm"
+	ActionInputCancel    Action = "input_cancel"
+	ActionInputLeft      Action = "input_left"
+	ActionInputRight     Action = "input_right"
+	ActionInputBackspace Action = "input_backspace"
+)
+
+// Confirm view actions
+const (
+	ActionConfirmYes Action = "confirm_yes"
+	ActionConfirmNo  Action = "confirm_no"
+)
+
+// Open-with picker actions
+const (
+	ActionPickerUp     Action = "picker_up"
+	ActionPickerDown   Action = "picker_down"
+	ActionPickerSelect Action = "picker_select"
+	ActionPickerCancel Action = "picker_cancel"
+)
+
+// Conflict dialog actions; the _all variants apply the choice to the
+// conflicts of the same kind that follow in the operation
+const (
+	ActionConflictOverwrite    Action = "conflict_overwrite"
+	ActionConflictSkip         Action = "conflict_skip"
+	ActionConflictRename       Action = "conflict_rename"
+	ActionConflictNewer        Action = "conflict_newer"
+	ActionConflictMerge        Action = "conflict_merge"
+	ActionConflictOverwriteAll Action = "conflict_overwrite_all"
+	ActionConflictSkipAll      Action = "conflict_skip_all"
+	ActionConflictRenameAll    Action = "conflict_rename_all"
+	ActionConflictNewerAll     Action = "conflict_newer_all"
+	ActionConflictMergeAll     Action = "conflict_merge_all"
+	ActionConflictCancel       Action = "conflict_cancel"
+)
+
+// Help view actions
+const (
+	ActionHelpClose      Action = "help_close"
+	ActionHelpScrollUp   Action = "help_scroll_up"
+	ActionHelpScrollDown Action = "help_scroll_down"
+	ActionHelpBackspace  Action = "help_backspace"
+)
+
+// KeyBinding binds one or more keys to an action
+type KeyBinding struct {
+	Action   Action
+	Keys     []string // as reported by tea.KeyMsg.String()
+	Help     string
+	Category string
+	Short    bool // shown in the one-line help below the tree
+}
+
+// KeyMap holds the key bindings for every view
+type KeyMap struct {
+	bindings map[View][]KeyBinding
+}
+
+// viewNames are used as help overlay titles
+var viewNames = map[View]string{
+	TreeView:     "Tree",
+	InputView:    "Input",
+	ConfirmView:  "Confirm",
+	HelpView:     "Help",
+	OpenWithView: "Open With",
+	ConflictView: "Conflict",
+}
+
+// DefaultKeyMap returns the built-in key bindings
+func DefaultKeyMap() KeyMap {
+	return KeyMap{bindings: map[View][]KeyBinding{
+		TreeView: {
+			{ActionUp, []string{"up", "k"}, "move up", "Navigation", true},
+			{ActionDown, []string{"down", "j"}, "move down", "Navigation", true},
+			{ActionExpand, []string{"enter", "right", "l"}, "expand directory / open file", "Navigation", true},
+			{ActionCollapse, []string{"left", "h"}, "collapse / go to parent", "Navigation", true},
+			{ActionToggleMark, []string{"space"}, "mark / unmark", "File Operations", false},
+			{ActionEdit, []string{"e"}, "open in editor", "File Operations", true},
+			{ActionOpen, []string{"o"}, "open with the default handler", "File Operations", false},
+			{ActionOpenWith, []string{"w"}, "open with...", "File Operations", false},
+			{ActionRename, []string{"r"}, "rename", "File Operations", true},
+			{ActionMove, []string{"m"}, "move (to the other pane in dual-pane mode)", "File Operations", false},
+			{ActionCopy, []string{"c"}, "copy (to the other pane in dual-pane mode)", "File Operations", false},
+			{ActionDelete, []string{"d"}, "delete", "File Operations", false},
+			{ActionCompress, []string{"a"}, "compress the marked items (or the selected one) into an archive", "File Operations", false},
+			{ActionExtract, []string{"x"}, "extract the selected archive", "File Operations", false},
+			{ActionDualPane, []string{"|"}, "toggle dual-pane mode", "Panes", false},
+			{ActionSwitchPane, []string{"tab"}, "switch active pane", "Panes", false},
+			{ActionNewTab, []string{"ctrl+t"}, "open a new tab on the current directory", "Tabs", false},
+			{ActionOpenInTab, []string{"O"}, "open the selected directory in a new tab", "Tabs", false},
+			{ActionCloseTab, []string{"ctrl+w"}, "close tab", "Tabs", false},
+			{ActionNextTab, []string{"]"}, "next tab", "Tabs", false},
+			{ActionPrevTab, []string{"["}, "previous tab", "Tabs", false},
+			{ActionMoveTabLeft, []string{"{"}, "move tab left", "Tabs", false},
+			{ActionMoveTabRight, []string{"}"}, "move tab right", "Tabs", false},
+			{ActionJumpTab, []string{"alt+1", "alt+2", "alt+3", "alt+4", "alt+5", "alt+6", "alt+7", "alt+8", "alt+9"}, "jump to tab 1-9", "Tabs", false},
+			{ActionToggleHidden, []string{"."}, "toggle hidden files", "Display", true},
+			{ActionSort, []string{"s"}, "cycle sort order", "Display", false},
+			{ActionFilter, []string{"/"}, "filter files by pattern", "Display", false},
+			{ActionToggleNerdFont, []string{"n"}, "toggle nerd font icons", "Display", false},
+			{ActionTreeStyle, []string{"t"}, "cycle tree style", "Display", false},
+			{ActionTogglePreview, []string{"v"}, "toggle preview pane", "Display", false},
+			{ActionToggleMouse, []string{"M"}, "toggle mouse (for terminal text selection)", "Display", false},
+			{ActionHelp, []string{"?", "f1"}, "show key bindings", "General", true},
+			{ActionQuit, []string{"q", "ctrl+c"}, "quit", "General", true},
+			{ActionQuitCD, []string{"Q"}, "quit and cd the shell to the current directory", "General", false},
+		},
+		InputView: {
+			{ActionInputConfirm, []string{"enter"}, "confirm", "Editing", true},
+			{ActionInputCancel, []string{"esc"}, "cancel", "Editing", true},
+			{ActionInputLeft, []string{"left"}, "move cursor left", "Editing", false},
+			{ActionInputRight, []string{"right"}, "move cursor right", "Editing", false},
+			{ActionInputBackspace, []string{"backspace"}, "delete character", "Editing", false},
+			{ActionHelp, []string{"f1"}, "show key bindings", "General", false},
+		},
+		ConfirmView: {
+			{ActionConfirmYes, []string{"y", "Y"}, "confirm", "Confirm", true},
+			{ActionConfirmNo, []string{"n", "N", "q", "esc"}, "cancel", "Confirm", true},
+			{ActionHelp, []string{"?", "f1"}, "show key bindings", "General", false},
+		},
+		HelpView: {
+			{ActionHelpClose, []string{"esc", "f1"}, "close help", "Help", true},
+			{ActionHelpScrollUp, []string{"up"}, "scroll up", "Help", false},
+			{ActionHelpScrollDown, []string{"down"}, "scroll down", "Help", false},
+			{ActionHelpBackspace, []string{"backspace"}, "delete search character", "Help", false},
+		},
+		OpenWithView: {
+			{ActionPickerUp, []string{"up", "k"}, "previous handler", "Open With", true},
+			{ActionPickerDown, []string{"down", "j"}, "next handler", "Open With", true},
+			{ActionPickerSelect, []string{"enter"}, "open", "Open With", true},
+			{ActionPickerCancel, []string{"esc", "q"}, "cancel", "Open With", true},
+			{ActionHelp, []string{"?", "f1"}, "show key bindings", "General", false},
+		},
+		ConflictView: {
+			{ActionConflictOverwrite, []string{"o"}, "overwrite", "Conflict", true},
+			{ActionConflictSkip, []string{"s"}, "skip", "Conflict", true},
+			{ActionConflictRename, []string{"r"}, "rename with a numeric suffix", "Conflict", true},
+			{ActionConflictNewer, []string{"n"}, "keep the newer file", "Conflict", true},
+			{ActionConflictMerge, []string{"m"}, "merge directories", "Conflict", true},
+			{ActionConflictOverwriteAll, []string{"O"}, "overwrite all", "Apply to All", false},
+			{ActionConflictSkipAll, []string{"S"}, "skip all", "Apply to All", false},
+			{ActionConflictRenameAll, []string{"R"}, "rename all", "Apply to All", false},
+			{ActionConflictNewerAll, []string{"N"}, "keep the newer of all files", "Apply to All", false},
+			{ActionConflictMergeAll, []string{"M"}, "merge all directories", "Apply to All", false},
+			{ActionConflictCancel, []string{"esc", "q"}, "cancel the operation", "General", true},
+			{ActionHelp, []string{"?", "f1"}, "show key bindings", "General", false},
+		},
+	}}
+}
+
+// defaultKeyMap is used by models that were built without a key map
+var defaultKeyMap = DefaultKeyMap()
+
+// WithOverrides returns a copy of the key map where each action named in
+// overrides is rebound to the given keys in every view that has it
+func (km KeyMap) WithOverrides(overrides map[string][]string) (KeyMap, error) {
+	result := KeyMap{bindings: make(map[View][]KeyBinding, len(km.bindings))}
+	known := make(map[Action]bool)
+
+	for view, bindings := range km.bindings {
+		copied := make([]KeyBinding, len(bindings))
+		for i, binding := range bindings {
+			known[binding.Action] = true
+			if keys, ok := overrides[string(binding.Action)]; ok {
+				binding.Keys = append([]string(nil), keys...)
+			}
+			copied[i] = binding
+		}
+		result.bindings[view] = copied
+	}
+
+	var unknown []string
+	for name := range overrides {
+		if !known[Action(name)] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return result, fmt.Errorf("unknown key binding actions: %s", strings.Join(unknown, ", "))
+	}
+
+	return result, nil
+}
+
+// Lookup returns the action bound to key in view, or "" if the key is unbound
+func (km KeyMap) Lookup(view View, key string) Action {
+	if km.bindings == nil {
+		km = defaultKeyMap
+	}
+	// tea reports the space bar as " ", which is unreadable in configs and help
+	if key == " " {
+		key = "space"
+	}
+	for _, binding := range km.bindings[view] {
+		for _, k := range binding.Keys {
+			if k == key {
+				return binding.Action
+			}
+		}
+	}
+	return ""
+}
+
+// Bindings returns the bindings of a view that have at least one key
+func (km KeyMap) Bindings(view View) []KeyBinding {
+	if km.bindings == nil {
+		km = defaultKeyMap
+	}
+	var bound []KeyBinding
+	for _, binding := range km.bindings[view] {
+		if len(binding.Keys) > 0 {
+			bound = append(bound, binding)
+		}
+	}
+	return bound
+}
+
+// ShortHelp renders the one-line help for a view
+func (km KeyMap) ShortHelp(view View) string {
+	var parts []string
+	for _, binding := range km.Bindings(view) {
+		if binding.Short {
+			parts = append(parts, fmt.Sprintf("%s: %s", binding.KeyNames(), binding.Help))
+		}
+	}
+	return strings.Join(parts, "   ")
+}
+
+// KeyNames joins the keys of a binding for display
+func (b KeyBinding) KeyNames() string {
+	return strings.Join(b.Keys, "/")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyMapLookup(t *testing.T) {
+	keys := DefaultKeyMap()
+
+	tests := []struct {
+		name string
+		view View
+		key  string
+		want Action
+	}{
+		{"Tree up", TreeView, "k", ActionUp},
+		{"Tree rename", TreeView, "r", ActionRename},
+		{"Tree help", TreeView, "?", ActionHelp},
+		{"Confirm yes", ConfirmView, "Y", ActionConfirmYes},
+		{"Confirm no", ConfirmView, "esc", ActionConfirmNo},
+		{"Input cancel", InputView, "esc", ActionInputCancel},
+		{"Unbound", TreeView, "z", ""},
+		{"Bound in another view only", InputView, "k", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keys.Lookup(tt.view, tt.key); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyMapZeroValueUsesDefaults(t *testing.T) {
+	var keys KeyMap
+	if got := keys.Lookup(TreeView, "q"); got != ActionQuit {
+		t.Errorf("got %q, want %q", got, ActionQuit)
+	}
+}
+
+func TestKeyMapWithOverrides(t *testing.T) {
+	keys, err := DefaultKeyMap().WithOverrides(map[string][]string{
+		"up":   {"ctrl+p"},
+		"help": {"f2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := keys.Lookup(TreeView, "ctrl+p"); got != ActionUp {
+		t.Errorf("got %q, want %q", got, ActionUp)
+	}
+	if got := keys.Lookup(TreeView, "k"); got != "" {
+		t.Errorf("expected k to be unbound after remap, got %q", got)
+	}
+	// help is bound in several views and should be remapped in all of them
+	if got := keys.Lookup(InputView, "f2"); got != ActionHelp {
+		t.Errorf("got %q, want %q", got, ActionHelp)
+	}
+	if got := DefaultKeyMap().Lookup(TreeView, "k"); got != ActionUp {
+		t.Error("expected overrides not to modify the default key map")
+	}
+}
+
+func TestKeyMapUnknownOverride(t *testing.T) {
+	_, err := DefaultKeyMap().WithOverrides(map[string][]string{"teleport": {"x"}})
+	if err == nil || !strings.Contains(err.Error(), "teleport") {
+		t.Errorf("expected error naming the unknown action, got %v", err)
+	}
+}
+
+func TestShortHelpFollowsRemaps(t *testing.T) {
+	keys, _ := DefaultKeyMap().WithOverrides(map[string][]string{"rename": {"F2"}})
+	help := keys.ShortHelp(TreeView)
+	if !strings.Contains(help, "F2: rename") {
+		t.Errorf("expected remapped rename key in help, got %q", help)
+	}
+}
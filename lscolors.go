@@ -0,0 +1,251 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// LSColors holds the styles parsed from an LS_COLORS specification
+type LSColors struct {
+	types      map[string]lipgloss.Style // keyed by type code (di, ln, ex, ...)
+	patterns   []lsPattern               // extension and glob entries, in declaration order
+	linkTarget bool                      // ln=target: color symlinks like the file they point to
+}
+
+// lsPattern is a single *.ext or glob entry from LS_COLORS
+type lsPattern struct {
+	pattern string
+	suffix  bool // pattern is a plain "*suffix" and is matched case-insensitively
+	style   lipgloss.Style
+}
+
+// LoadLSColors parses LS_COLORS from the environment, returning nil if unset
+func LoadLSColors() *LSColors {
+	value := os.Getenv("LS_COLORS")
+	if value == "" {
+		return nil
+	}
+	return ParseLSColors(value)
+}
+
+// ParseLSColors parses a colon-separated LS_COLORS string as produced by dircolors
+func ParseLSColors(value string) *LSColors {
+	c := &LSColors{types: make(map[string]lipgloss.Style)}
+
+	for _, entry := range strings.Split(value, ":") {
+		key, codes, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			continue
+		}
+
+		if strings.HasPrefix(key, "*") || strings.ContainsAny(key, "*?[") {
+			rest := strings.TrimPrefix(key, "*")
+			c.patterns = append(c.patterns, lsPattern{
+				pattern: key,
+				suffix:  strings.HasPrefix(key, "*") && !strings.ContainsAny(rest, "*?["),
+				style:   sgrToStyle(codes),
+			})
+			continue
+		}
+
+		if key == "ln" && codes == "target" {
+			c.linkTarget = true
+			continue
+		}
+		c.types[key] = sgrToStyle(codes)
+	}
+
+	return c
+}
+
+// Style returns the style for an item, and false if LS_COLORS has no opinion on it
+func (c *LSColors) Style(item FileItem) (lipgloss.Style, bool) {
+	if c == nil {
+		return lipgloss.Style{}, false
+	}
+
+	mode := item.mode
+	if mode&fs.ModeSymlink != 0 {
+		if item.broken {
+			if style, ok := c.types["or"]; ok {
+				return style, true
+			}
+		}
+		if c.linkTarget && !item.broken {
+			if info, err := os.Stat(item.path); err == nil {
+				target := item
+				target.mode = info.Mode()
+				target.isDir = info.IsDir()
+				return c.Style(target)
+			}
+		}
+		return c.typeStyle("ln")
+	}
+
+	switch {
+	case item.isDir || mode.IsDir():
+		switch {
+		case mode&fs.ModeSticky != 0 && mode&0002 != 0:
+			return c.typeStyle("tw", "di")
+		case mode&0002 != 0:
+			return c.typeStyle("ow", "di")
+		case mode&fs.ModeSticky != 0:
+			return c.typeStyle("st", "di")
+		}
+		return c.typeStyle("di")
+	case mode&fs.ModeNamedPipe != 0:
+		return c.typeStyle("pi")
+	case mode&fs.ModeSocket != 0:
+		return c.typeStyle("so")
+	case mode&fs.ModeDevice != 0 && mode&fs.ModeCharDevice != 0:
+		return c.typeStyle("cd")
+	case mode&fs.ModeDevice != 0:
+		return c.typeStyle("bd")
+	case mode&fs.ModeSetuid != 0:
+		if style, ok := c.typeStyle("su"); ok {
+			return style, true
+		}
+	case mode&fs.ModeSetgid != 0:
+		if style, ok := c.typeStyle("sg"); ok {
+			return style, true
+		}
+	}
+
+	// Like ls, executables take precedence over extension colors
+	if mode&0111 != 0 {
+		if style, ok := c.typeStyle("ex"); ok {
+			return style, true
+		}
+	}
+
+	if style, ok := c.patternStyle(item.name); ok {
+		return style, true
+	}
+
+	return c.typeStyle("fi", "no")
+}
+
+// typeStyle returns the style of the first type code that is defined
+func (c *LSColors) typeStyle(codes ...string) (lipgloss.Style, bool) {
+	for _, code := range codes {
+		if style, ok := c.types[code]; ok {
+			return style, true
+		}
+	}
+	return lipgloss.Style{}, false
+}
+
+// patternStyle matches a file name against the extension and glob entries
+func (c *LSColors) patternStyle(name string) (lipgloss.Style, bool) {
+	lower := strings.ToLower(name)
+	for _, p := range c.patterns {
+		if p.suffix {
+			if strings.HasSuffix(lower, strings.ToLower(p.pattern[1:])) {
+				return p.style, true
+			}
+			continue
+		}
+		if matched, _ := filepath.Match(p.pattern, name); matched {
+			return p.style, true
+		}
+	}
+	return lipgloss.Style{}, false
+}
+
+// sgrToStyle converts a string of SGR parameters such as "01;38;5;208" to a lipgloss style
+func sgrToStyle(codes string) lipgloss.Style {
+	style := lipgloss.NewStyle()
+	params := strings.Split(codes, ";")
+
+	for i := 0; i < len(params); i++ {
+		n, err := strconv.Atoi(params[i])
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case n == 0:
+			style = lipgloss.NewStyle()
+		case n == 1:
+			style = style.Bold(true)
+		case n == 2:
+			style = style.Faint(true)
+		case n == 3:
+			style = style.Italic(true)
+		case n == 4:
+			style = style.Underline(true)
+		case n == 5 || n == 6:
+			style = style.Blink(true)
+		case n == 7:
+			style = style.Reverse(true)
+		case n == 9:
+			style = style.Strikethrough(true)
+		case n >= 30 && n <= 37:
+			style = style.Foreground(lipgloss.Color(strconv.Itoa(n - 30)))
+		case n >= 40 && n <= 47:
+			style = style.Background(lipgloss.Color(strconv.Itoa(n - 40)))
+		case n >= 90 && n <= 97:
+			style = style.Foreground(lipgloss.Color(strconv.Itoa(n - 90 + 8)))
+		case n >= 100 && n <= 107:
+			style = style.Background(lipgloss.Color(strconv.Itoa(n - 100 + 8)))
+		case n == 38 || n == 48:
+			color, consumed := extendedColor(params[i+1:])
+			i += consumed
+			if color == "" {
+				continue
+			}
+			if n == 38 {
+				style = style.Foreground(lipgloss.Color(color))
+			} else {
+				style = style.Background(lipgloss.Color(color))
+			}
+		}
+	}
+
+	return style
+}
+
+// extendedColor parses the arguments of a 38/48 SGR sequence (5;n or 2;r;g;b)
+// and returns the color along with the number of parameters consumed
+func extendedColor(params []string) (string, int) {
+	if len(params) == 0 {
+		return "", 0
+	}
+
+	switch params[0] {
+	case "5":
+		if len(params) < 2 {
+			return "", len(params)
+		}
+		n, err := strconv.Atoi(params[1])
+		if err != nil || n < 0 || n > 255 {
+			return "", 2
+		}
+		return strconv.Itoa(n), 2
+	case "2":
+		if len(params) < 4 {
+			return "", len(params)
+		}
+		var rgb [3]int
+		for j := range rgb {
+			v, err := strconv.Atoi(params[j+1])
+			if err != nil || v < 0 || v > 255 {
+				return "", 4
+			}
+			rgb[j] = v
+		}
+		return "#" + hexByte(rgb[0]) + hexByte(rgb[1]) + hexByte(rgb[2]), 4
+	}
+
+	return "", 1
+}
+
+func hexByte(v int) string {
+	const digits = "0123456789abcdef"
+	return string([]byte{digits[v>>4], digits[v&0x0f]})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestSgrToStyle(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     string
+		wantFg    string
+		wantBold  bool
+		wantUnder bool
+	}{
+		{"Basic color", "34", "4", false, false},
+		{"Bold with leading zero", "01;32", "2", true, false},
+		{"Bright color", "91", "9", false, false},
+		{"256 color", "38;5;208", "208", false, false},
+		{"True color", "38;2;255;128;0", "#ff8000", false, false},
+		{"Underline", "4;33", "3", false, true},
+		{"Reset clears attributes", "01;0;36", "6", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := sgrToStyle(tt.codes)
+			if got := style.GetForeground(); got != lipgloss.Color(tt.wantFg) {
+				t.Errorf("got foreground %v, want %v", got, tt.wantFg)
+			}
+			if got := style.GetBold(); got != tt.wantBold {
+				t.Errorf("got bold=%v, want bold=%v", got, tt.wantBold)
+			}
+			if got := style.GetUnderline(); got != tt.wantUnder {
+				t.Errorf("got underline=%v, want underline=%v", got, tt.wantUnder)
+			}
+		})
+	}
+}
+
+func TestLSColorsStyle(t *testing.T) {
+	colors := ParseLSColors("di=01;34:ln=01;36:or=31:ex=01;32:pi=33:so=35:bd=33;01:cd=33;01:su=37;41:sg=30;43:tw=30;42:ow=34;42:*.tar=01;31:*.go=36:*README=33")
+
+	tests := []struct {
+		name   string
+		item   FileItem
+		wantFg string
+	}{
+		{"Directory", FileItem{name: "src", isDir: true, mode: fs.ModeDir | 0755}, "4"},
+		{"Sticky other-writable", FileItem{name: "tmp", isDir: true, mode: fs.ModeDir | fs.ModeSticky | 0777}, "0"},
+		{"Other-writable", FileItem{name: "shared", isDir: true, mode: fs.ModeDir | 0777}, "4"},
+		{"Symlink", FileItem{name: "link", mode: fs.ModeSymlink | 0777}, "6"},
+		{"Orphan symlink", FileItem{name: "dangling", mode: fs.ModeSymlink | 0777, broken: true}, "1"},
+		{"Executable beats extension", FileItem{name: "run.go", mode: 0755}, "2"},
+		{"Setuid", FileItem{name: "sudo", mode: fs.ModeSetuid | 0755}, "7"},
+		{"Setgid", FileItem{name: "wall", mode: fs.ModeSetgid | 0755}, "0"},
+		{"Pipe", FileItem{name: "fifo", mode: fs.ModeNamedPipe | 0644}, "3"},
+		{"Socket", FileItem{name: "sock", mode: fs.ModeSocket | 0755}, "5"},
+		{"Block device", FileItem{name: "sda", mode: fs.ModeDevice | 0660}, "3"},
+		{"Char device", FileItem{name: "tty", mode: fs.ModeDevice | fs.ModeCharDevice | 0620}, "3"},
+		{"Extension", FileItem{name: "main.go", mode: 0644}, "6"},
+		{"Extension is case-insensitive", FileItem{name: "BACKUP.TAR", mode: 0644}, "1"},
+		{"Suffix glob", FileItem{name: "README", mode: 0644}, "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style, ok := colors.Style(tt.item)
+			if !ok {
+				t.Fatalf("expected a style for %q", tt.item.name)
+			}
+			if got := style.GetForeground(); got != lipgloss.Color(tt.wantFg) {
+				t.Errorf("got foreground %v, want %v", got, tt.wantFg)
+			}
+		})
+	}
+
+	if _, ok := colors.Style(FileItem{name: "notes.txt", mode: 0644}); ok {
+		t.Error("expected no style for a plain file without fi/no entries")
+	}
+}
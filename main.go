@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 // Config holds the application configuration
@@ -16,10 +19,21 @@ type Config struct {
 	ShowHidden      bool          // Show hidden files by default
 	Editor          string        // Default editor command
 	ConfirmActions  bool          // Whether to confirm destructive actions
-	CurrentDir      string        // Current working directory
+	CurrentDir      string        `yaml:"-"` // Current working directory
+	LastDirFile     string        `yaml:"-"` // File the shell wrapper reads to cd on quit
 	Display         DisplayConfig // Display configuration
+	Icons           IconConfig    // User-defined icon mappings
 	icons           IconSet       // Current icon set (determined by Display.UseNerdFont)
 	treeSymbols     TreeSymbols   // Current tree symbols (determined by Display.TreeStyle)
+	lsColors        *LSColors     // Styles parsed from LS_COLORS, nil when unset
+	Keys            map[string][]string // Key overrides, from action name to keys
+	Mouse           bool          // Enable mouse tracking (disable to let the terminal select text)
+	Openers         []OpenerRule  // Commands that open files by extension, MIME type or glob
+	Preview         bool          // Show the preview pane
+	Sort            string        // Initial sort order: "name", "size", "modified" or "extension"
+	Preserve        PreserveOptions // Metadata copies keep, like cp --preserve
+	Parallelism     int           // Files recursive copies and deletes work on at once
+	Conflicts       ConflictConfig // What moves and copies do with existing destinations
 }
 
 // Model represents the application state
@@ -30,8 +44,28 @@ type Model struct {
 	status     string
 	err        error
 	activeView View
-	// cleanup    context.CancelFunc
+	cleanup    context.CancelFunc // cancels the running file operation
 	statusBar  *StatusBar
+	keys       KeyMap
+	help       *HelpOverlay
+	width      int
+	height     int
+	lastClickIndex int       // item index of the last mouse click, for double-click detection
+	lastClickTime  time.Time // time of the last mouse click
+	lastClickPane  int       // pane of the last mouse click
+	panes      [2]*FileTree // left and right trees; tree points at the active one
+	activePane int
+	dualPane   bool
+	inputItem  *FileItem       // item the active input prompt operates on
+	inputPaths []string        // items the active compress prompt packs
+	confirm    *confirmPrompt  // operation waiting in the confirm view
+	operation  *OperationState // state of the running file operation, if any
+	tabs       []*Tab // tree sessions; the active one is mirrored in tree, panes, activePane and dualPane
+	activeTab  int
+	preview    *Preview // content of the preview pane, shared by all tabs
+	picker     *openWithPicker // handlers offered in the open-with view
+	conflict   *Conflict       // existing destination shown in the conflict view
+	pick       *PickMode       // set when running as a picker (--pick)
 }
 
 type View int
@@ -40,37 +74,58 @@ const (
 	TreeView View = iota
 	InputView
 	ConfirmView
+	HelpView
+	OpenWithView
+	ConflictView
 )
 
 // Initial setup function
 func initialModel() (Model, error) {
-	cwd, err := os.Getwd()
+	config, err := LoadConfig()
+	config.lsColors = LoadLSColors()
+	config.loadIcons()
+	config.loadTreeSymbols()
+
+	statusBar := NewStatusBar()
 	if err != nil {
-		return Model{}, fmt.Errorf("failed to get working directory: %w", err)
+		// Fall back to the defaults but let the user know their config was not read
+		statusBar.setMessage(fmt.Sprintf("Error loading config: %v", err), MessageError)
 	}
 
-	display := DefaultDisplayConfig()
-	
-	config := Config{
-		ShowHidden:     true,
-		Editor:         "code",
-		ConfirmActions: true,
-		CurrentDir:     cwd,
-		Display:        display,
-		icons:          UnicodeIconSet(),
-		treeSymbols:    UnicodeTreeSymbols(),
+	keys, err := DefaultKeyMap().WithOverrides(config.Keys)
+	if err != nil {
+		statusBar.setMessage(fmt.Sprintf("Error in key bindings: %v", err), MessageError)
 	}
 
+	tree := NewFileTree(config.CurrentDir)
+	tree.showHidden = config.ShowHidden
+	if config.Sort != "" {
+		sortBy, ok := parseSortMode(config.Sort)
+		if !ok {
+			statusBar.setMessage(fmt.Sprintf("Unknown sort order %q in config", config.Sort), MessageError)
+		}
+		tree.sortBy = sortBy
+	}
+	if _, _, err := config.Conflicts.policies(); err != nil {
+		statusBar.setMessage(fmt.Sprintf("Error in config: %v", err), MessageError)
+	}
+	// The second pane is rooted when dual-pane mode is first opened
+	other := NewFileTree("")
+
 	return Model{
 		config:     config,
-		tree:       NewFileTree(cwd),
+		tree:       tree,
+		panes:      [2]*FileTree{tree, other},
+		tabs:       []*Tab{{panes: [2]*FileTree{tree, other}}},
 		activeView: TreeView,
-		statusBar: NewStatusBar(),
+		statusBar: statusBar,
+		keys:       keys,
+		preview:    &Preview{},
 		input: nil,
 	}, nil
 }
 func (m Model) Init() tea.Cmd {
-	return m.tree.LoadDirectory(m.config.CurrentDir)
+	return tea.Batch(m.tree.LoadDirectory(m.config.CurrentDir), watchConnection(m.tree.fs))
 }
 
 // Styles for different elements
@@ -81,113 +136,148 @@ var (
 	selectedStyle  = lipgloss.NewStyle().Reverse(true)
 	statusStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
 	headerStyle    = lipgloss.NewStyle().Bold(true)
+	imageStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("13"))
+	mediaStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+	archiveStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
 	// errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
 )
 
-func (m Model) renderTreeItem(item FileItem, i int, depth int, isLastAtLevel bool) string {
-    // Ensure depth is non-negative
-    if depth < 0 {
-        depth = 0
-    }
-
-    // Calculate indentation and tree symbols
-    prefix := strings.Repeat(" ", m.config.Display.IndentSize * depth)
-    
-    // Add tree symbols only if depth > 0
-    if depth > 0 {
-        if isLastAtLevel {
-            prefix += m.config.treeSymbols.Corner + m.config.treeSymbols.Horizontal
-        } else {
-            prefix += m.config.treeSymbols.Tee + m.config.treeSymbols.Horizontal
-        }
+func (m Model) renderTreeItem(tree *FileTree, item FileItem, i int, connectors string, active bool) string {
+    var prefix string
+    if i == tree.cursor {
+        prefix = ">"
+    } else {
+        prefix = " "
     }
-
-    // Rest of the function remains the same
-    if i == m.tree.cursor {
-        prefix += "> "
+    if tree.marked[item.path] {
+        prefix += "*"
     } else {
-        prefix += "  "
+        prefix += " "
+    }
+    if connectors != "" {
+        prefix += connectors + " "
     }
 
     // Get appropriate icon and style
-    var icon string
-    var itemStyle lipgloss.Style
-    if item.isDir {
-        itemStyle = directoryStyle
-        if item.name == ".." {
-            icon = m.config.icons.ParentDir
-        } else if m.tree.expanded[item.path] {
-            icon = m.config.icons.DirectoryOpen
-        } else {
-            icon = m.config.icons.Directory
-        }
-    } else {
-        if item.mode&0111 != 0 {
-            itemStyle = executableStyle
-        } else {
-            itemStyle = fileStyle
-        }
-        icon = m.config.icons.GetFileIcon(item, m.config.Display)
-    }
+    itemStyle := m.itemStyle(item)
+    icon := m.config.icons.GetFileIcon(item, tree.expanded[item.path])
     
     itemText := fmt.Sprintf("%s%s %s", prefix, icon, item.name)
-    if !item.isDir {
+    switch {
+    case item.entry && !item.isDir:
+        // Entries of an archive show their size, as an archive listing does
+        itemText += fmt.Sprintf(" (%s, %s)", item.mode.String(), formatSize(item.size))
+    case !item.isDir:
         itemText += fmt.Sprintf(" (%s)", item.mode.String())
     }
 
-    if i == m.tree.cursor {
+    if i == tree.cursor && active {
         return selectedStyle.Render(itemText)
     }
     return itemStyle.Render(itemText)
 }
 
+// itemStyle picks the color for an item, preferring LS_COLORS unless the theme is configured
+func (m Model) itemStyle(item FileItem) lipgloss.Style {
+    if !m.config.Display.PreferTheme {
+        if style, ok := m.config.lsColors.Style(item); ok {
+            return style
+        }
+    }
+
+    switch {
+    case item.isDir:
+        return directoryStyle
+    case item.mode&0111 != 0:
+        return executableStyle
+    }
+    if style, ok := mimeStyle(item.mime); ok {
+        return style
+    }
+    return fileStyle
+}
+
+// mimeStyle colors files by their detected type when the theme is in use
+func mimeStyle(mimeType string) (lipgloss.Style, bool) {
+	major, _, _ := strings.Cut(mimeType, "/")
+	switch {
+	case major == "image":
+		return imageStyle, true
+	case major == "audio" || major == "video":
+		return mediaStyle, true
+	case isArchiveMIME(mimeType):
+		return archiveStyle, true
+	}
+	return lipgloss.Style{}, false
+}
+
+// treeHeaderLines is the number of lines drawn above the first tree item
+const treeHeaderLines = 2
+
+// renderFooter renders the status, help text and status bar shown below the tree
+func (m Model) renderFooter() string {
+	var b strings.Builder
+
+	// Preserve existing status and help text
+	b.WriteString("\n")
+	if m.status != "" {
+		b.WriteString(statusStyle.Render(m.status) + "\n")
+	}
+	helpText := "\n" + m.keys.ShortHelp(TreeView)
+	b.WriteString(helpText)
+
+	// Add status bar below help text
+	b.WriteString("\n")
+	b.WriteString(m.statusBar.View())
+
+	return b.String()
+}
+
+// treeRows returns how many tree items fit between the header and footer.
+// Before the first window size message, every item is shown.
+func (m Model) treeRows(footer string) int {
+	if m.height <= 0 {
+		if m.dualPane {
+			return max(len(m.panes[0].items), len(m.panes[1].items))
+		}
+		return len(m.tree.items)
+	}
+	return max(m.height-m.tabBarLines()-treeHeaderLines-lipgloss.Height(footer), 1)
+}
+
 func (m Model) View() string {
 	var b strings.Builder
 
 	// Render main content based on active view
 	switch m.activeView {
 	case TreeView:
-		// Show current directory at top
-		currentDirText := fmt.Sprintf("Directory: %s", m.config.CurrentDir)
-		b.WriteString(headerStyle.Render(currentDirText) + "\n\n")
-
-		// Calculate last items at each level for proper tree lines
-		lastAtLevel := make(map[int]bool)
-		for i, item := range m.tree.items {
-			depth := strings.Count(item.path, string(os.PathSeparator)) -
-				strings.Count(m.config.CurrentDir, string(os.PathSeparator))
-			if depth < 0 {
-				depth = 0
+		// Draw the current directory and the visible window of items, side by side in dual-pane mode
+		footer := m.renderFooter()
+		rows := m.treeRows(footer)
+		if m.tabBarLines() > 0 {
+			b.WriteString(m.renderTabBar() + "\n")
+		}
+		if m.columns() > 1 {
+			width := m.paneWidth()
+			var columns []string
+			if m.dualPane {
+				columns = append(columns,
+					m.renderPane(m.panes[0], rows, width, m.activePane == 0),
+					m.renderPane(m.panes[1], rows, width, m.activePane == 1),
+				)
+			} else {
+				columns = append(columns, m.renderPane(m.tree, rows, width, true))
 			}
-
-			// Check if this is the last item at its level
-			isLast := true
-			for j := i + 1; j < len(m.tree.items); j++ {
-				nextDepth := strings.Count(m.tree.items[j].path, string(os.PathSeparator)) -
-					strings.Count(m.config.CurrentDir, string(os.PathSeparator))
-				if nextDepth <= depth {
-					isLast = false
-					break
-				}
+			if m.config.Preview {
+				columns = append(columns, m.renderPreviewPane(rows, width))
 			}
-			lastAtLevel[depth] = isLast
-
-			// Render the item
-			b.WriteString(m.renderTreeItem(item, i, depth, isLast))
-			b.WriteString("\n")
+			b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, columns...))
+		} else {
+			b.WriteString(m.renderPane(m.tree, rows, 0, true))
 		}
-
-		// Preserve existing status and help text
 		b.WriteString("\n")
-		if m.status != "" {
-			b.WriteString(statusStyle.Render(m.status) + "\n")
-		}
-		helpText := "\nj/k: move   h/l: collapse/expand   .: toggle hidden   n: toggle nerd fonts   q: quit"
-		b.WriteString(helpText)
 
-		// Add status bar below help text
-		b.WriteString("\n")
-		b.WriteString(m.statusBar.View())
+		b.WriteString(footer)
 
 	case InputView:
 		if m.input != nil {
@@ -195,32 +285,119 @@ func (m Model) View() string {
 		}
 
 	case ConfirmView:
-		if m.input != nil {
-			return "Confirm View" // placeholder, we'll implement this later
+		if m.confirm != nil {
+			return m.confirm.message
+		}
+
+	case HelpView:
+		if m.help != nil {
+			return m.help.View(m.keys, m.width, m.height)
+		}
+
+	case OpenWithView:
+		if m.picker != nil {
+			return m.picker.View()
+		}
+
+	case ConflictView:
+		if m.conflict != nil {
+			return m.conflict.View(m.keys)
 		}
 	}
 
 	return b.String()
 }
+
+// Update handles a message, then scrolls the visible trees so their cursors stay on screen
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	model, cmd := m.update(msg)
+	if m, ok := model.(Model); ok && m.activeView == TreeView {
+		return model, tea.Batch(cmd, m.scrollTrees())
+	}
+	return model, cmd
+}
+
+// scrollTrees scrolls the cursor of every visible tree into view and returns a
+// command detecting the contents of the rows that are shown
+func (m Model) scrollTrees() tea.Cmd {
+	rows := m.treeRows(m.renderFooter())
+	trees := []*FileTree{m.tree}
+	if m.dualPane {
+		trees = m.panes[:]
+	}
+	var cmds []tea.Cmd
+	for _, tree := range trees {
+		tree.ScrollIntoView(rows)
+		// Until the window size is known, every item counts as visible
+		if m.height > 0 {
+			cmds = append(cmds, tree.detectVisible(rows))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		// Update status bar width
 		m.statusBar.Update(msg)
+		m.width, m.height = msg.Width, msg.Height
 
 	case FileOperation:
+		snapshot := msg.state.Snapshot()
 		m.statusBar.StartProgress()
-		m.statusBar.UpdateOperation(msg.state)
-		m.statusBar.UpdateProgress(msg.state.Progress)
+		m.statusBar.UpdateOperation(snapshot)
+		m.statusBar.UpdateProgress(snapshot.Progress)
 		return m, nil
 
+	case operationTickMsg:
+		return m.handleOperationTick(msg)
+
+	case operationDoneMsg:
+		return m.handleOperationDone(msg)
+
+	case tea.MouseMsg:
+		return withPreview(m.handleMouse(msg))
+
+	case editorFinishedMsg:
+		return m.handleEditorFinished(msg)
+
+	case previewLoadedMsg:
+		return m.handlePreviewLoaded(msg)
+
 	case OperationProgress:
 		m.statusBar.UpdateProgress(msg.Progress)
 		return m, nil
 
 	case loadedDirectoryMsg:
-		m.tree.items = msg.items
+		tree := msg.tree
+		if tree == nil {
+			tree = m.tree
+		}
+		tree.setItems(msg.items)
 		m.statusBar.UpdatePath(m.config.CurrentDir)
+		m.statusBar.UpdateConnection(m.tree.fs)
+		if tree == m.tree && m.preview != nil {
+			// The selected item may have changed on disk, so render it again
+			m.preview.stop()
+			m.preview.path = ""
+		}
+		return m, m.refreshPreview()
+
+	case detectedMIMEMsg:
+		msg.tree.setMIMETypes(msg.types)
+		return m, nil
+
+	case loadedChildrenMsg:
+		msg.tree.insertChildren(msg.parent, msg.items)
+		return m, nil
+
+	case connectionLostMsg:
+		message := fmt.Sprintf("Lost connection to %s", msg.fs.Label())
+		if msg.err != nil {
+			message += ": " + msg.err.Error()
+		}
+		m.statusBar.setMessage(message, MessageError)
 		return m, nil
 
 	case errMsg:
@@ -233,7 +410,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch m.activeView {
 	case TreeView:
 		if keyMsg, ok := msg.(tea.KeyMsg); ok {
-			return m.handleTreeViewKeys(keyMsg)
+			return withPreview(m.handleTreeViewKeys(keyMsg))
 		}
 	case InputView:
 		if keyMsg, ok := msg.(tea.KeyMsg); ok {
@@ -243,6 +420,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if keyMsg, ok := msg.(tea.KeyMsg); ok {
 			return m.handleConfirmViewKeys(keyMsg) // Implement this function
 		}
+	case HelpView:
+		if keyMsg, ok := msg.(tea.KeyMsg); ok {
+			return m.handleHelpViewKeys(keyMsg)
+		}
+	case OpenWithView:
+		if keyMsg, ok := msg.(tea.KeyMsg); ok {
+			return m.handleOpenWithViewKeys(keyMsg)
+		}
+	case ConflictView:
+		if keyMsg, ok := msg.(tea.KeyMsg); ok {
+			return m.handleConflictViewKeys(keyMsg)
+		}
 	}
 
 	return m, nil
@@ -254,18 +443,30 @@ func (m Model) handleInputViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	if msg.Type == tea.KeyEsc {
+	// Translate remapped editing keys into the keys the input understands
+	switch m.keys.Lookup(InputView, msg.String()) {
+	case ActionInputCancel:
 		m.input = nil
 		m.activeView = TreeView
 		return m, nil
+	case ActionHelp:
+		return m.openHelp(), nil
+	case ActionInputConfirm:
+		msg = tea.KeyMsg{Type: tea.KeyEnter}
+	case ActionInputLeft:
+		msg = tea.KeyMsg{Type: tea.KeyLeft}
+	case ActionInputRight:
+		msg = tea.KeyMsg{Type: tea.KeyRight}
+	case ActionInputBackspace:
+		msg = tea.KeyMsg{Type: tea.KeyBackspace}
 	}
 
-	_, done, cmd := m.input.Update(msg)
+	value, done, cmd := m.input.Update(msg)
 	if done {
+		inputType := m.input.inputType
 		m.input = nil
 		m.activeView = TreeView
-		// handle input value here based on operation type
-		return m, cmd
+		return m.submitInput(inputType, value)
 	}
 
 	if cmd != nil {
@@ -276,77 +477,196 @@ func (m Model) handleInputViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) handleConfirmViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "y", "Y":
+	switch m.keys.Lookup(ConfirmView, msg.String()) {
+	case ActionConfirmYes:
 		m.activeView = TreeView
-		// handle confirmation action here
+		if m.confirm == nil {
+			return m, nil
+		}
+		op := m.confirm.op
+		m.confirm = nil
+		return m.startOperation(op)
+	case ActionConfirmNo:
+		m.activeView = TreeView
+		m.confirm = nil
 		return m, nil
-	case "n", "N", "q", "esc":
+	case ActionHelp:
+		return m.openHelp(), nil
+	}
+
+	return m, nil
+}
+
+// openHelp shows the key bindings of the active view
+func (m Model) openHelp() Model {
+	m.help = NewHelpOverlay(m.activeView)
+	m.activeView = HelpView
+	return m
+}
+
+func (m Model) handleHelpViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.help == nil {
 		m.activeView = TreeView
 		return m, nil
 	}
 
+	if m.help.Update(m.keys, msg) {
+		m.activeView = m.help.source
+		m.help = nil
+	}
 	return m, nil
 }
 
 
 func (m Model) handleTreeViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "q", "ctrl+c":
+	switch m.keys.Lookup(TreeView, msg.String()) {
+	case ActionQuit:
 		return m, tea.Quit
 
-	case "up", "k":
+	case ActionQuitCD:
+		return m.quitAndChangeDirectory()
+
+	case ActionUp:
 		m.tree.MoveUp()
 
-	case "down", "j":
+	case ActionDown:
 		m.tree.MoveDown()
 
-	case "enter", "right", "l":
+	case ActionExpand:
 		if item := m.tree.GetSelectedItem(); item != nil {
-			if item.isDir {
+			if m.pick != nil && (!item.isDir || len(m.tree.marked) > 0) {
+				return m.pickSelected()
+			}
+			if item.expandable() {
 				return m, m.tree.ToggleExpand()
 			}
+			return m.openFile(item.path)
 		}
 
-	case "left", "h":
+	case ActionCollapse:
 		if item := m.tree.GetSelectedItem(); item != nil {
 			if item.name == ".." {
 				// Move up one directory level
 				m.config.CurrentDir = filepath.Dir(m.config.CurrentDir)
-				return m, m.tree.LoadDirectory(m.config.CurrentDir)
-			} else if item.isDir && m.tree.expanded[item.path] {
+				return m, m.tree.SetRoot(m.config.CurrentDir)
+			} else if item.expandable() && m.tree.expanded[item.path] {
 				// If directory is expanded, collapse it
-				delete(m.tree.expanded, item.path)
+				m.tree.Collapse()
 				return m, nil
 			} else {
 				// If it's a file or collapsed directory, try to move to parent directory
 				parentDir := filepath.Dir(item.path)
 				if parentDir != m.config.CurrentDir {
+					// Jump to the parent entry when inside an expanded directory
+					for i := m.tree.cursor - 1; i >= 0; i-- {
+						if m.tree.items[i].path == parentDir {
+							m.tree.cursor = i
+							return m, nil
+						}
+					}
 					m.config.CurrentDir = parentDir
-					return m, m.tree.LoadDirectory(m.config.CurrentDir)
+					return m, m.tree.SetRoot(m.config.CurrentDir)
 				}
 			}
 		}
 
-	case "p":
-		if item := m.tree.GetSelectedItem(); item != nil {
-			m.input = NewInput(InputRename, item.name)
-			m.activeView = InputView
-			return m, nil
+	case ActionRename:
+		return m.promptOperation(InputRename)
+
+	case ActionMove:
+		return m.promptOperation(InputMove)
+
+	case ActionCopy:
+		return m.promptOperation(InputCopy)
+
+	case ActionCompress:
+		return m.promptCompress()
+
+	case ActionExtract:
+		return m.promptExtract()
+
+	case ActionDelete:
+		return m.promptDelete()
+
+	case ActionSwitchPane:
+		if m.dualPane {
+			return m.focusPane(1 - m.activePane), nil
+		}
+
+	case ActionDualPane:
+		return m.toggleDualPane()
+
+	case ActionToggleMark:
+		m.tree.ToggleMark()
+
+	case ActionEdit:
+		return m.editSelected()
+
+	case ActionOpen:
+		if item := m.tree.GetSelectedItem(); item != nil && !item.isDir {
+			return m.openFile(item.path)
 		}
 
-	case ".":
+	case ActionOpenWith:
+		return m.openWith()
+
+	case ActionTogglePreview:
+		return m.togglePreview()
+
+	case ActionSort:
+		cmd := m.tree.CycleSort()
+		m.statusBar.setMessage(fmt.Sprintf("Sorted by %s", sortModeNames[m.tree.sortBy]), MessageNormal)
+		return m, cmd
+
+	case ActionFilter:
+		m.input = NewInput(InputFilter, m.tree.filter)
+		m.activeView = InputView
+		return m, nil
+
+	case ActionNewTab:
+		return m.openTab(m.tree.root)
+
+	case ActionOpenInTab:
+		return m.openSelectedInTab()
+
+	case ActionCloseTab:
+		return m.closeTab()
+
+	case ActionNextTab:
+		return m.cycleTab(1)
+
+	case ActionPrevTab:
+		return m.cycleTab(-1)
+
+	case ActionMoveTabLeft:
+		return m.moveTab(-1)
+
+	case ActionMoveTabRight:
+		return m.moveTab(1)
+
+	case ActionJumpTab:
+		return m.jumpToTab(msg.String())
+
+	case ActionToggleHidden:
 		m.tree.showHidden = !m.tree.showHidden
 		return m, m.tree.LoadDirectory(m.config.CurrentDir)
+
+	case ActionTreeStyle:
+		m.config.Display.NextTreeStyle()
+		m.config.loadTreeSymbols()
+		m.statusBar.setMessage(fmt.Sprintf("Tree style: %s", m.config.Display.TreeStyle), MessageNormal)
 		
-		case "n": // new toggle for nerd fonts
-		  m.config.Display.UseNerdFont = !m.config.Display.UseNerdFont
-			if m.config.Display.UseNerdFont {
-				m.config.icons = NerdFontIconSet()
-				m.config.Display.VerifyNerdFont()
-			} else {
-				m.config.icons = DefaultIconSet
+		case ActionToggleNerdFont: // new toggle for nerd fonts
+			if !m.config.Display.ToggleNerdFont() {
+				m.statusBar.setMessage("Nerd Font glyphs could not be verified in this terminal; pass --icons=nerd if they look right", MessageWarning)
 			}
+			m.config.loadIcons()
+
+	case ActionToggleMouse:
+		return m.toggleMouse()
+
+	case ActionHelp:
+		return m.openHelp(), nil
 	}
 
 
@@ -361,35 +681,64 @@ func (m Model) SaveConfig() {
 }
 
 func main() {
-	// nerd font flag
-	useNerdFont := flag.Bool("nerd-font", false, "Enable Nerd Font Icons")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if cmd, ok := findSubcommand(os.Args[1]); ok {
+			os.Exit(cmd.run(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
+	opts, err := ParseCLI(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(exitUsage)
+	}
+	if opts.Version {
+		fmt.Print(VersionInfo())
+		return
+	}
+	configPathOverride = opts.ConfigPath
 
 	model, err := initialModel()
 	if err != nil {
 		fmt.Printf("Error initializing model: %v", err)
 		os.Exit(1)
 	}
+	if err := opts.Apply(&model); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+
+	options := []tea.ProgramOption{tea.WithAltScreen()}
+	if model.config.Mouse {
+		options = append(options, tea.WithMouseCellMotion())
+	}
 
-	// Update display config based on nerd font flag
-	model.config.Display.UseNerdFont = *useNerdFont
-	if *useNerdFont {
-		model.config.icons = NerdFontIconSet()
-		model.config.Display.VerifyNerdFont()
+	if model.pick != nil {
+		ttyOptions, err := ttyProgramOptions()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		options = append(options, ttyOptions...)
+	}
+	// After the picker has chosen the color profile of its terminal
+	if opts.Theme == ThemeMono {
+		lipgloss.SetColorProfile(termenv.Ascii)
 	}
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
+	p := tea.NewProgram(model, options...)
 	if _, err := p.Run(); err != nil {
-		fmt.Printf("Error running program: %v", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
+		os.Exit(exitError)
+	}
+	if model.pick != nil {
+		os.Exit(finishPick(model.pick))
 	}
 }
 
 // Add validation method to Config struct
 func (c *Config) Validate() error {
-    if c.Editor == "" {
-        return fmt.Errorf("editor cannot be empty")
-    }
     if c.CurrentDir == "" {
         return fmt.Errorf("current directory cannot be empty")
     }
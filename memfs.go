@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxSymlinkHops bounds symlink resolution, like the kernel's ELOOP limit
+const maxSymlinkHops = 40
+
+// MemFS is an FS held in memory, for tests and virtual trees. It starts with an
+// empty root directory; paths are absolute and cleaned before use. Permission
+// checks use the owner bits, as if every file belonged to the caller.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode // keyed by clean absolute path
+	now   func() time.Time
+}
+
+// memNode is a file, directory or symlink of a MemFS
+type memNode struct {
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+	target  string // symlink target
+}
+
+// NewMemFS returns an empty in-memory filesystem
+func NewMemFS() *MemFS {
+	m := &MemFS{nodes: make(map[string]*memNode), now: time.Now}
+	m.nodes["/"] = &memNode{mode: fs.ModeDir | 0755, modTime: m.now()}
+	return m
+}
+
+// memFileInfo describes a node at the time it was looked up
+type memFileInfo struct {
+	name string
+	node memNode
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size() }
+func (i memFileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memFileInfo) ModTime() time.Time { return i.node.modTime }
+func (i memFileInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
+
+func (i memFileInfo) size() int64 {
+	if i.node.mode&fs.ModeSymlink != 0 {
+		return int64(len(i.node.target))
+	}
+	return int64(len(i.node.data))
+}
+
+func memError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// clean makes name absolute and clean
+func (m *MemFS) clean(name string) string {
+	return filepath.Clean("/" + name)
+}
+
+// resolve returns the path name refers to after following symlinks in its
+// directories, and in its last element too when followLast is set. The last
+// element need not exist; the directories leading to it must.
+func (m *MemFS) resolve(op, name string, followLast bool) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(m.clean(name), "/"), "/")
+	if parts[0] == "" {
+		return "/", nil
+	}
+
+	current, hops := "/", 0
+	for i := 0; i < len(parts); i++ {
+		next := filepath.Join(current, parts[i])
+		last := i == len(parts)-1
+		node, ok := m.nodes[next]
+		if !ok {
+			if last {
+				return next, nil
+			}
+			return "", memError(op, name, fs.ErrNotExist)
+		}
+		if node.mode&fs.ModeSymlink != 0 && (!last || followLast) {
+			if hops++; hops > maxSymlinkHops {
+				return "", memError(op, name, syscall.ELOOP)
+			}
+			target := node.target
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(current, target)
+			}
+			// Start over from the target with the rest of the path
+			rest := parts[i+1:]
+			parts = append(strings.Split(strings.TrimPrefix(filepath.Clean(target), "/"), "/"), rest...)
+			if parts[0] == "" {
+				parts = parts[1:]
+			}
+			current, i = "/", -1
+			continue
+		}
+		if !last && !node.mode.IsDir() {
+			return "", memError(op, name, syscall.ENOTDIR)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// lookup returns the node name refers to
+func (m *MemFS) lookup(op, name string, followLast bool) (string, *memNode, error) {
+	path, err := m.resolve(op, name, followLast)
+	if err != nil {
+		return "", nil, err
+	}
+	node, ok := m.nodes[path]
+	if !ok {
+		return "", nil, memError(op, name, fs.ErrNotExist)
+	}
+	return path, node, nil
+}
+
+// parentDir checks that the directory that will hold path exists and is writable
+func (m *MemFS) parentDir(op, name, path string) error {
+	parent, ok := m.nodes[filepath.Dir(path)]
+	switch {
+	case !ok:
+		return memError(op, name, fs.ErrNotExist)
+	case !parent.mode.IsDir():
+		return memError(op, name, syscall.ENOTDIR)
+	case parent.mode.Perm()&0200 == 0:
+		return memError(op, name, fs.ErrPermission)
+	}
+	return nil
+}
+
+// hasChildren reports whether the directory at path has entries
+func (m *MemFS) hasChildren(path string) bool {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for p := range m.nodes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, node, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(path), node: *node}, nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, node, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(path), node: *node}, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, node, err := m.lookup("readdirent", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, memError("readdirent", name, syscall.ENOTDIR)
+	}
+	if node.mode.Perm()&0400 == 0 {
+		return nil, memError("open", name, fs.ErrPermission)
+	}
+
+	var entries []fs.DirEntry
+	for p, child := range m.nodes {
+		if p != "/" && filepath.Dir(p) == path {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: filepath.Base(p), node: *child}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", memError("readlink", name, syscall.EINVAL)
+	}
+	return node.target, nil
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, node, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if node.mode.Perm()&0400 == 0 {
+		return nil, memError("open", name, fs.ErrPermission)
+	}
+	// Readers see the contents as they were when the file was opened
+	return &memFile{fs: m, name: name, path: path, reader: bytes.NewReader(bytes.Clone(node.data))}, nil
+}
+
+func (m *MemFS) Create(name string, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if node, ok := m.nodes[path]; ok {
+		switch {
+		case node.mode.IsDir():
+			return nil, memError("open", name, syscall.EISDIR)
+		case node.mode.Perm()&0200 == 0:
+			return nil, memError("open", name, fs.ErrPermission)
+		}
+		node.data = nil
+		node.modTime = m.now()
+	} else {
+		if err := m.parentDir("open", name, path); err != nil {
+			return nil, err
+		}
+		m.nodes[path] = &memNode{mode: perm.Perm(), modTime: m.now()}
+	}
+	return &memFile{fs: m, name: name, path: path, writable: true}, nil
+}
+
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdir(name, perm)
+}
+
+func (m *MemFS) mkdir(name string, perm fs.FileMode) error {
+	path, err := m.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[path]; ok {
+		return memError("mkdir", name, fs.ErrExist)
+	}
+	if err := m.parentDir("mkdir", name, path); err != nil {
+		return err
+	}
+	m.nodes[path] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: m.now()}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := m.clean(name)
+	var missing []string
+	for p := path; ; p = filepath.Dir(p) {
+		resolved, err := m.resolve("mkdir", p, true)
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, p)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if node, ok := m.nodes[resolved]; ok {
+			if !node.mode.IsDir() {
+				return memError("mkdir", p, syscall.ENOTDIR)
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := m.mkdir(missing[i], perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, node, err := m.lookup("rename", oldpath, false)
+	if err != nil {
+		return err
+	}
+	to, err := m.resolve("rename", newpath, false)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if from == "/" || strings.HasPrefix(to, from+"/") {
+		return memError("rename", oldpath, syscall.EINVAL)
+	}
+	if err := m.parentDir("rename", oldpath, from); err != nil {
+		return err
+	}
+	if err := m.parentDir("rename", newpath, to); err != nil {
+		return err
+	}
+
+	// Like rename(2), replace a file with a file or an empty directory with a directory
+	if existing, ok := m.nodes[to]; ok {
+		switch {
+		case node.mode.IsDir() && !existing.mode.IsDir():
+			return memError("rename", newpath, syscall.ENOTDIR)
+		case !node.mode.IsDir() && existing.mode.IsDir():
+			return memError("rename", newpath, syscall.EISDIR)
+		case existing.mode.IsDir() && m.hasChildren(to):
+			return memError("rename", newpath, syscall.ENOTEMPTY)
+		}
+	}
+
+	prefix := from + "/"
+	for p, n := range m.nodes {
+		if strings.HasPrefix(p, prefix) {
+			delete(m.nodes, p)
+			m.nodes[to+"/"+strings.TrimPrefix(p, prefix)] = n
+		}
+	}
+	delete(m.nodes, from)
+	m.nodes[to] = node
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, node, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if path == "/" {
+		return memError("remove", name, syscall.EBUSY)
+	}
+	if err := m.parentDir("remove", name, path); err != nil {
+		return err
+	}
+	if node.mode.IsDir() && m.hasChildren(path) {
+		return memError("remove", name, syscall.ENOTEMPTY)
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.resolve("unlinkat", name, false)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if _, ok := m.nodes[path]; !ok {
+		return nil
+	}
+	if path == "/" {
+		return memError("unlinkat", name, syscall.EBUSY)
+	}
+	if err := m.parentDir("unlinkat", name, path); err != nil {
+		return err
+	}
+	prefix := path + "/"
+	for p := range m.nodes {
+		if strings.HasPrefix(p, prefix) {
+			delete(m.nodes, p)
+		}
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+// Chtimes sets the modification time; MemFS does not track access times
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node, err := m.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	node.modTime = mtime
+	return nil
+}
+
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[path]; ok {
+		return memError("symlink", newname, fs.ErrExist)
+	}
+	if err := m.parentDir("symlink", newname, path); err != nil {
+		return err
+	}
+	m.nodes[path] = &memNode{mode: fs.ModeSymlink | 0777, modTime: m.now(), target: oldname}
+	return nil
+}
+
+func (m *MemFS) Access(name string, mode uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node, err := m.lookup("access", name, true)
+	if err != nil {
+		return err
+	}
+	// The owner bits of the mode line up with the access bits shifted left by six
+	want := fs.FileMode(mode&(AccessRead|AccessWrite|AccessExecute)) << 6
+	if node.mode.Perm()&want != want {
+		return memError("access", name, fs.ErrPermission)
+	}
+	return nil
+}
+
+// memFile is an open file of a MemFS
+type memFile struct {
+	fs       *MemFS
+	name     string
+	path     string
+	reader   *bytes.Reader // nil for files opened for writing
+	writable bool
+	closed   bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, memError("read", f.name, fs.ErrClosed)
+	case f.reader == nil:
+		return 0, memError("read", f.name, syscall.EBADF)
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return 0, memError("read", f.name, syscall.EISDIR)
+	}
+	return f.reader.Read(p)
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, memError("write", f.name, fs.ErrClosed)
+	case !f.writable:
+		return 0, memError("write", f.name, syscall.EBADF)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	node, ok := f.fs.nodes[f.path]
+	if !ok {
+		// Removed while open; the data goes nowhere, as with an unlinked file
+		return len(p), nil
+	}
+	node.data = append(node.data, p...)
+	node.modTime = f.fs.now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return memError("close", f.name, fs.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	node, ok := f.fs.nodes[f.path]
+	if !ok {
+		return nil, memError("stat", f.name, fs.ErrNotExist)
+	}
+	return memFileInfo{name: filepath.Base(f.path), node: *node}, nil
+}
+
+// Seek and ReadAt work on files opened for reading, as with *os.File
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, memError("seek", f.name, syscall.EBADF)
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.reader == nil {
+		return 0, memError("read", f.name, syscall.EBADF)
+	}
+	return f.reader.ReadAt(p, off)
+}
+
+var (
+	_ FS          = OSFS{}
+	_ FS          = (*MemFS)(nil)
+	_ io.ReaderAt = (*memFile)(nil)
+)
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testFSContract checks the behavior every FS shares below root, which must exist and be empty
+func testFSContract(t *testing.T, fsys FS, root string) {
+	t.Helper()
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	if err := fsys.MkdirAll(p("a/b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, p("a/b/f.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, p("z.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fsys.Stat(p("a/b/f.txt"))
+	if err != nil || info.Size() != 5 || info.Mode().Perm() != 0644 || info.IsDir() || info.Name() != "f.txt" {
+		t.Errorf("unexpected stat %v, %v", info, err)
+	}
+	if err := fsys.Mkdir(p("a"), 0755); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected ErrExist making an existing directory, got %v", err)
+	}
+	if _, err := fsys.Open(p("missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist opening a missing file, got %v", err)
+	}
+	if _, err := fsys.Create(p("missing/f"), 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist creating in a missing directory, got %v", err)
+	}
+
+	entries, err := fsys.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"a", "z.txt"}; !reflect.DeepEqual(names, want) || !entries[0].IsDir() {
+		t.Errorf("got entries %v, want %v", names, want)
+	}
+
+	// Creating an existing file truncates it
+	if err := WriteFile(fsys, p("a/b/f.txt"), []byte("hi"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fsys, p("a/b/f.txt")); err != nil || string(data) != "hi" {
+		t.Errorf("got %q, %v after overwriting", data, err)
+	}
+
+	// Symlinks resolve through Stat and Open but not Lstat
+	if err := fsys.Symlink("b/f.txt", p("a/link")); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := fsys.Readlink(p("a/link")); err != nil || target != "b/f.txt" {
+		t.Errorf("got link target %q, %v", target, err)
+	}
+	if info, err := fsys.Lstat(p("a/link")); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("expected Lstat to describe the link, got %v, %v", info, err)
+	}
+	if data, err := ReadFile(fsys, p("a/link")); err != nil || string(data) != "hi" {
+		t.Errorf("got %q, %v reading through the link", data, err)
+	}
+	if err := fsys.Symlink("nowhere", p("a/broken")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(p("a/broken")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a broken link to stat as missing, got %v", err)
+	}
+
+	if err := fsys.Remove(p("a")); err == nil || !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+		t.Errorf("expected removing a non-empty directory to fail, got %v", err)
+	}
+
+	// Renaming a directory carries its contents
+	if err := fsys.Rename(p("a"), p("c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(p("c/b/f.txt")); err != nil {
+		t.Errorf("expected contents to move with the directory: %v", err)
+	}
+	if _, err := fsys.Lstat(p("a")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the old name to be gone, got %v", err)
+	}
+
+	if err := fsys.Chmod(p("z.txt"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := fsys.Stat(p("z.txt")); info.Mode().Perm() != 0444 {
+		t.Errorf("got mode %v after chmod", info.Mode())
+	}
+	stamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := fsys.Chtimes(p("z.txt"), stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := fsys.Stat(p("z.txt")); !info.ModTime().Equal(stamp) {
+		t.Errorf("got mtime %v after chtimes", info.ModTime())
+	}
+	if err := fsys.Access(p("z.txt"), AccessRead); err != nil {
+		t.Errorf("expected read access: %v", err)
+	}
+	// root passes every access check on a real filesystem
+	if _, ok := fsys.(OSFS); !ok || os.Geteuid() != 0 {
+		if err := fsys.Access(p("z.txt"), AccessWrite); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected write access to be denied, got %v", err)
+		}
+	}
+
+	if err := fsys.RemoveAll(p("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveAll(p("c")); err != nil {
+		t.Errorf("expected RemoveAll of a missing path to succeed, got %v", err)
+	}
+	if err := fsys.Remove(p("z.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := fsys.ReadDir(root); len(entries) != 0 {
+		t.Errorf("expected an empty directory, got %d entries", len(entries))
+	}
+}
+
+func TestOSFSContract(t *testing.T) {
+	testFSContract(t, OSFS{}, t.TempDir())
+}
+
+func TestMemFSContract(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/home/user", 0755); err != nil {
+		t.Fatal(err)
+	}
+	testFSContract(t, fsys, "/home/user")
+}
+
+func TestMemFSSymlinkedDirectories(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.MkdirAll("/real/sub", 0755)
+	WriteFile(fsys, "/real/sub/f", []byte("x"), 0644)
+	fsys.Symlink("/real", "/alias")
+	fsys.Symlink("loop2", "/loop1")
+	fsys.Symlink("loop1", "/loop2")
+
+	if data, err := ReadFile(fsys, "/alias/sub/f"); err != nil || string(data) != "x" {
+		t.Errorf("got %q, %v reading through a linked directory", data, err)
+	}
+	if err := fsys.MkdirAll("/alias/sub/new/deeper", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fsys.Stat("/real/sub/new/deeper"); err != nil || !info.IsDir() {
+		t.Errorf("expected MkdirAll through a link to create below its target: %v", err)
+	}
+	if _, err := fsys.Stat("/loop1"); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("expected ELOOP, got %v", err)
+	}
+	if _, err := fsys.Open("/real/sub/f/x"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("expected ENOTDIR below a file, got %v", err)
+	}
+}
+
+func TestMemFSReadOnlyDirectory(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.MkdirAll("/ro", 0755)
+	WriteFile(fsys, "/ro/f", nil, 0644)
+	fsys.Chmod("/ro", 0555)
+
+	if err := WriteFile(fsys, "/ro/new", nil, 0644); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected creating in a read-only directory to fail, got %v", err)
+	}
+	if err := fsys.Remove("/ro/f"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected removing from a read-only directory to fail, got %v", err)
+	}
+	if err := fsys.Rename("/ro/f", "/f"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected renaming out of a read-only directory to fail, got %v", err)
+	}
+}
+
+func TestFileTreeOnMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.MkdirAll("/project/src", 0755)
+	WriteFile(fsys, "/project/src/main.go", []byte("package main\n"), 0644)
+	WriteFile(fsys, "/project/README.md", []byte("# hi\n"), 0644)
+	fsys.Symlink("missing", "/project/dangling")
+
+	tree := NewFileTree("/project")
+	tree.fs = fsys
+	tree.expanded["/project/src"] = true
+	items := tree.LoadDirectory("/project")().(loadedDirectoryMsg).items
+
+	var paths []string
+	for _, item := range items {
+		paths = append(paths, item.path)
+	}
+	want := []string{"/", "/project/src", "/project/src/main.go", "/project/README.md", "/project/dangling"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+	if !items[4].broken {
+		t.Error("expected the dangling link to be marked broken")
+	}
+	if items[2].mime != "text/x-go" {
+		t.Errorf("expected the type from the name, got %q", items[2].mime)
+	}
+}
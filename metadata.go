@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// Extended attributes that hold POSIX ACLs
+const (
+	xattrACLAccess  = "system.posix_acl_access"
+	xattrACLDefault = "system.posix_acl_default"
+)
+
+// PreserveOptions selects the metadata a copy keeps, like cp --preserve. The
+// defaults keep everything, like cp -a.
+type PreserveOptions struct {
+	Mode       bool // permission bits, with setuid, setgid and sticky
+	Timestamps bool // access and modification times
+	Ownership  bool // owner and group; only root can give files to other users
+	Xattrs     bool // extended attributes other than ACLs
+	ACLs       bool // POSIX access and default ACLs
+}
+
+// DefaultPreserveOptions keeps all metadata
+func DefaultPreserveOptions() PreserveOptions {
+	return PreserveOptions{Mode: true, Timestamps: true, Ownership: true, Xattrs: true, ACLs: true}
+}
+
+// MetadataError is an attribute a copy could not carry over
+type MetadataError struct {
+	Path string // the copy
+	Attr string // "mode", "timestamps", "ownership", "ACL", "default ACL" or "xattr <name>"
+	Err  error
+}
+
+func (e MetadataError) Error() string {
+	return fmt.Sprintf("could not preserve %s of %s: %v", e.Attr, e.Path, e.Err)
+}
+
+func (e MetadataError) Unwrap() error { return e.Err }
+
+// PreserveMetadata carries the metadata of src, described by info, over to its
+// copy dst as opts selects. Data must be written first, since writing updates
+// the modification time. It returns the attributes that could not be kept.
+func PreserveMetadata(srcFs FS, src string, info fs.FileInfo, dstFs FS, dst string, opts PreserveOptions) []MetadataError {
+	var failed []MetadataError
+	fail := func(attr string, err error) {
+		if err == nil {
+			return
+		}
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		failed = append(failed, MetadataError{Path: dst, Attr: attr, Err: err})
+	}
+
+	// Changing the owner clears setuid and setgid, so it goes before the mode
+	if opts.Ownership {
+		if uid, gid, ok := fileOwner(info); ok {
+			if owner, ok := dstFs.(OwnerFS); ok {
+				fail("ownership", owner.Lchown(dst, uid, gid))
+			} else {
+				fail("ownership", errors.ErrUnsupported)
+			}
+		}
+	}
+	if opts.Xattrs || opts.ACLs {
+		copyXattrs(srcFs, src, dstFs, dst, opts, fail)
+	}
+	// After the ACLs, whose mask the group bits of the mode would otherwise override
+	if opts.Mode {
+		fail("mode", dstFs.Chmod(dst, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)))
+	}
+	if opts.Timestamps {
+		fail("timestamps", dstFs.Chtimes(dst, fileAtime(info), info.ModTime()))
+	}
+	return failed
+}
+
+// copyXattrs copies the extended attributes of src that opts selects to dst
+func copyXattrs(srcFs FS, src string, dstFs FS, dst string, opts PreserveOptions, fail func(string, error)) {
+	srcX, ok := srcFs.(XattrFS)
+	if !ok {
+		return
+	}
+	names, err := srcX.Listxattr(src)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return
+	} else if err != nil {
+		fail("xattrs", err)
+		return
+	}
+
+	dstX, _ := dstFs.(XattrFS)
+	for _, name := range names {
+		attr := "xattr " + name
+		switch name {
+		case xattrACLAccess:
+			attr = "ACL"
+		case xattrACLDefault:
+			attr = "default ACL"
+		}
+		if acl := name == xattrACLAccess || name == xattrACLDefault; acl && !opts.ACLs || !acl && !opts.Xattrs {
+			continue
+		}
+
+		if dstX == nil {
+			fail(attr, errors.ErrUnsupported)
+			continue
+		}
+		value, err := srcX.Getxattr(src, name)
+		if err != nil {
+			fail(attr, err)
+			continue
+		}
+		fail(attr, dstX.Setxattr(dst, name, value))
+	}
+}
+
+// fileOwner returns the owner and group of the file info describes, when its FS has them
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	switch sys := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return int(sys.Uid), int(sys.Gid), true
+	case *sftp.FileStat:
+		return int(sys.UID), int(sys.GID), true
+	}
+	return 0, 0, false
+}
+
+// fileAtime returns the access time of the file info describes, or its
+// modification time when its FS does not track access times
+func fileAtime(info fs.FileInfo) time.Time {
+	switch sys := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return statAtime(sys)
+	case *sftp.FileStat:
+		return time.Unix(int64(sys.Atime), 0)
+	}
+	return info.ModTime()
+}
+
+// describeUnpreserved summarizes the attributes copies could not keep for the status bar
+func describeUnpreserved(failed []MetadataError) string {
+	var attrs []string
+	seenAttrs, paths := map[string]bool{}, map[string]bool{}
+	for _, e := range failed {
+		attr := e.Attr
+		if strings.HasPrefix(attr, "xattr ") {
+			attr = "xattrs"
+		}
+		if !seenAttrs[attr] {
+			seenAttrs[attr] = true
+			attrs = append(attrs, attr)
+		}
+		paths[e.Path] = true
+	}
+
+	items := "1 item"
+	if len(paths) != 1 {
+		items = fmt.Sprintf("%d items", len(paths))
+	}
+	return fmt.Sprintf("could not preserve %s of %s (%s: %v)",
+		strings.Join(attrs, ", "), items, failed[0].Path, failed[0].Err)
+}
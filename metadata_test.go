@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testACL encodes a POSIX ACL that also grants rwx to user 1234, in the
+// format the kernel uses for system.posix_acl_access
+func testACL() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(2))
+	for _, entry := range []struct {
+		tag, perm uint16
+		id        uint32
+	}{
+		{0x01, 6, 0xffffffff}, // owner rw-
+		{0x02, 7, 1234},       // user 1234 rwx
+		{0x04, 4, 0xffffffff}, // group r--
+		{0x10, 7, 0xffffffff}, // mask rwx
+		{0x20, 4, 0xffffffff}, // other r--
+	} {
+		binary.Write(&buf, binary.LittleEndian, entry)
+	}
+	return buf.Bytes()
+}
+
+// osXattrs returns the extended attributes of the OS, skipping the test on systems without them
+func osXattrs(t *testing.T) XattrFS {
+	t.Helper()
+	xattrs, ok := FS(OSFS{}).(XattrFS)
+	if !ok {
+		t.Skip("no extended attributes on this system")
+	}
+	return xattrs
+}
+
+// setTestXattr sets an attribute, skipping the test where the filesystem has none
+func setTestXattr(t *testing.T, name, attr string, value []byte) {
+	t.Helper()
+	if err := osXattrs(t).Setxattr(name, attr, value); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skipf("no %s on the temporary directory: %v", attr, err)
+		}
+		t.Fatal(err)
+	}
+}
+
+func TestCopyPreservesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(src, "bin/tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setTestXattr(t, tool, "user.origin", []byte("build01"))
+	setTestXattr(t, tool, xattrACLAccess, testACL())
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(tool, 1234, 5678); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Sets the mask of the ACL too
+	if err := os.Chmod(tool, 0750|fs.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+	acl, _ := osXattrs(t).Getxattr(tool, xattrACLAccess)
+	atime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(tool, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	// A read-only directory only gets its mode once its contents are copied
+	if err := os.Chmod(filepath.Join(src, "bin"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "bin"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(src, "bin"), 0755) })
+
+	dst := filepath.Join(dir, "dst")
+	op := memOperation(t, OSFS{}, OpCopy, src, dst)
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(dst, "bin"), 0755) })
+	if failed := op.state.Snapshot().Unpreserved; len(failed) > 0 {
+		t.Errorf("expected everything to be preserved, got %v", failed)
+	}
+
+	copied := filepath.Join(dst, "bin/tool")
+	info, err := os.Stat(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 0750 | fs.ModeSetgid; info.Mode() != want {
+		t.Errorf("got mode %v, want %v", info.Mode(), want)
+	}
+	if !info.ModTime().Equal(mtime) || !fileAtime(info).Equal(atime) {
+		t.Errorf("got times %v, %v, want %v, %v", fileAtime(info), info.ModTime(), atime, mtime)
+	}
+	if uid, gid, _ := fileOwner(info); os.Geteuid() == 0 && (uid != 1234 || gid != 5678) {
+		t.Errorf("got owner %d:%d, want 1234:5678", uid, gid)
+	}
+	if value, err := osXattrs(t).Getxattr(copied, "user.origin"); err != nil || string(value) != "build01" {
+		t.Errorf("got xattr %q, %v", value, err)
+	}
+	if value, err := osXattrs(t).Getxattr(copied, xattrACLAccess); err != nil || !bytes.Equal(value, acl) {
+		t.Errorf("expected the ACL to be copied, got %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dst, "bin")); err != nil || info.Mode() != fs.ModeDir|0555 || !info.ModTime().Equal(mtime) {
+		t.Errorf("got directory %v, %v", info.Mode(), info.ModTime())
+	}
+}
+
+func TestCopyPreservePolicy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(src, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setTestXattr(t, src, "user.origin", []byte("build01"))
+	setTestXattr(t, src, xattrACLAccess, testACL())
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(src, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the ACL, so the copy gets a fresh time and no other xattrs
+	dst := filepath.Join(dir, "copy.txt")
+	op := memOperation(t, OSFS{}, OpCopy, src, dst)
+	op.preserve = PreserveOptions{ACLs: true}
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := os.Stat(dst)
+	if info.ModTime().Equal(old) {
+		t.Error("expected the modification time not to be preserved")
+	}
+	if value, err := osXattrs(t).Getxattr(dst, "user.origin"); err == nil {
+		t.Errorf("expected the xattr not to be copied, got %q", value)
+	}
+	if _, err := osXattrs(t).Getxattr(dst, xattrACLAccess); err != nil {
+		t.Errorf("expected the ACL to be copied: %v", err)
+	}
+}
+
+func TestCopyReportsUnpreservedMetadata(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(src, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An in-memory tree has no owners
+	dest := NewMemFS()
+	op := memOperation(t, OSFS{}, OpCopy, src, "/notes.txt")
+	op.destFs = dest
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := op.state.Snapshot()
+	if len(snapshot.Unpreserved) != 1 || snapshot.Unpreserved[0].Attr != "ownership" || !errors.Is(snapshot.Unpreserved[0], errors.ErrUnsupported) {
+		t.Fatalf("expected ownership to be reported, got %v", snapshot.Unpreserved)
+	}
+	if data, err := ReadFile(dest, "/notes.txt"); err != nil || string(data) != "x" {
+		t.Errorf("expected the copy to succeed anyway, got %q, %v", data, err)
+	}
+
+	statusBar := NewStatusBar()
+	statusBar.UpdateOperation(snapshot)
+	if !strings.Contains(statusBar.message, "could not preserve ownership of 1 item") {
+		t.Errorf("got status %q", statusBar.message)
+	}
+}
+
+func TestDescribeUnpreserved(t *testing.T) {
+	failed := []MetadataError{
+		{Path: "/a", Attr: "ownership", Err: syscall.EPERM},
+		{Path: "/a", Attr: "xattr security.selinux", Err: syscall.EPERM},
+		{Path: "/b", Attr: "ownership", Err: syscall.EPERM},
+		{Path: "/b", Attr: "xattr trusted.x", Err: syscall.EPERM},
+	}
+	want := "could not preserve ownership, xattrs of 2 items (/a: operation not permitted)"
+	if got := describeUnpreserved(failed); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	// mimeSniffBytes is how much of a file is read to detect its type, matching http.DetectContentType
+	mimeSniffBytes = 512
+	// mimeCacheLimit bounds the detection cache; it is cleared when full
+	mimeCacheLimit = 50000
+)
+
+// magicSignature identifies a file type by bytes at a fixed offset
+type magicSignature struct {
+	offset   int
+	magic    string
+	mimeType string
+}
+
+// magicSignatures cover formats that http.DetectContentType does not know
+var magicSignatures = []magicSignature{
+	{0, "\x7fELF", "application/x-executable"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{257, "ustar", "application/x-tar"},
+}
+
+// interpreterTypes maps shebang interpreters, without version suffixes, to MIME types
+var interpreterTypes = map[string]string{
+	"sh":      "application/x-shellscript",
+	"bash":    "application/x-shellscript",
+	"dash":    "application/x-shellscript",
+	"ksh":     "application/x-shellscript",
+	"zsh":     "application/x-shellscript",
+	"fish":    "application/x-fishscript",
+	"python":  "text/x-python",
+	"perl":    "application/x-perl",
+	"ruby":    "application/x-ruby",
+	"node":    "application/javascript",
+	"deno":    "application/javascript",
+	"php":     "application/x-php",
+	"lua":     "text/x-lua",
+	"awk":     "application/x-awk",
+	"gawk":    "application/x-awk",
+	"tclsh":   "text/x-tcl",
+	"Rscript": "text/x-r",
+}
+
+// extensionTypes is used when the shared MIME database is not installed, for
+// common source files the standard library does not know
+var extensionTypes = map[string]string{
+	".go":   "text/x-go",
+	".rs":   "text/rust",
+	".py":   "text/x-python",
+	".rb":   "application/x-ruby",
+	".sh":   "application/x-shellscript",
+	".c":    "text/x-csrc",
+	".h":    "text/x-chdr",
+	".cpp":  "text/x-c++src",
+	".java": "text/x-java",
+	".md":   "text/markdown",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".toml": "application/toml",
+	".ts":   "application/x-typescript",
+}
+
+// genericTypes say little more than "binary" or "text", so a file name match is preferred over them
+var genericTypes = map[string]bool{
+	"application/octet-stream": true,
+	"text/plain":               true,
+	"text/xml":                 true,
+	"application/zip":          true,
+	"application/gzip":         true,
+	"application/x-xz":         true,
+	"application/zstd":         true,
+	"application/x-bzip2":      true,
+}
+
+// mimeGlob is a file name pattern from the shared MIME database
+type mimeGlob struct {
+	weight        int
+	mimeType      string
+	pattern       string
+	caseSensitive bool
+}
+
+// mimeKey identifies a version of a file's content, by inode where the
+// filesystem has them and by path otherwise
+type mimeKey struct {
+	dev, ino uint64
+	path     string
+	mtime    int64
+	size     int64
+}
+
+// MIMEDetector detects MIME types from file contents and names, caching
+// results per inode and modification time
+type MIMEDetector struct {
+	dirs []string // shared MIME database directories, e.g. /usr/share/mime
+
+	globsOnce  sync.Once
+	literals   map[string]mimeGlob // patterns without wildcards, e.g. "makefile"
+	extensions map[string]mimeGlob // "*.ext" patterns keyed by ".ext"
+	globs      []mimeGlob          // every other pattern
+
+	mu    sync.Mutex
+	cache map[mimeKey]string
+}
+
+// mimeTypes is the detector shared by the tree, preview and openers
+var mimeTypes = NewMIMEDetector(sharedMIMEDirs())
+
+// NewMIMEDetector returns a detector reading globs from the given shared MIME database directories
+func NewMIMEDetector(dirs []string) *MIMEDetector {
+	return &MIMEDetector{dirs: dirs, cache: make(map[mimeKey]string)}
+}
+
+// sharedMIMEDirs lists the shared MIME database directories from the XDG base directories
+func sharedMIMEDirs() []string {
+	var dirs []string
+	if home := os.Getenv("XDG_DATA_HOME"); home != "" {
+		dirs = append(dirs, filepath.Join(home, "mime"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local/share/mime"))
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range filepath.SplitList(dataDirs) {
+		dirs = append(dirs, filepath.Join(dir, "mime"))
+	}
+	return dirs
+}
+
+// Detect returns the MIME type of path. info may be nil, or the result of os.Stat
+// or os.Lstat on path; special files get the inode/* types of the shared MIME database.
+func (d *MIMEDetector) Detect(path string, info fs.FileInfo) string {
+	return d.DetectFS(OSFS{}, path, info)
+}
+
+// DetectFS is Detect for a file of fsys
+func (d *MIMEDetector) DetectFS(fsys FS, path string, info fs.FileInfo) string {
+	if info == nil || info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if info, err = fsys.Stat(path); err != nil {
+			// Missing files and broken links can still be typed by name
+			return d.byName(filepath.Base(path))
+		}
+	}
+
+	if mimeType, ok := specialType(info.Mode()); ok {
+		return mimeType
+	}
+
+	key, cacheable := mimeKeyOf(fsys, path, info)
+	if mimeType, ok := d.cached(key, cacheable); ok {
+		return mimeType
+	}
+
+	head, err := readHead(fsys, path)
+	if err != nil {
+		// Unreadable files can still be typed by name
+		return d.byName(filepath.Base(path))
+	}
+	mimeType := d.DetectContent(filepath.Base(path), head)
+
+	if cacheable {
+		d.mu.Lock()
+		if len(d.cache) >= mimeCacheLimit {
+			d.cache = make(map[mimeKey]string)
+		}
+		d.cache[key] = mimeType
+		d.mu.Unlock()
+	}
+	return mimeType
+}
+
+// Guess is DetectFS without reading the file: special files and files detected
+// before get their type, others a guess from the name. It reports whether the
+// type was guessed, so the contents can be detected once they are needed.
+func (d *MIMEDetector) Guess(fsys FS, path string, info fs.FileInfo) (string, bool) {
+	// The type of a link is that of its target, which would take another stat
+	if info.Mode()&fs.ModeSymlink == 0 {
+		if mimeType, ok := specialType(info.Mode()); ok {
+			return mimeType, false
+		}
+		key, cacheable := mimeKeyOf(fsys, path, info)
+		if mimeType, ok := d.cached(key, cacheable); ok {
+			return mimeType, false
+		}
+	}
+	return d.byName(filepath.Base(path)), true
+}
+
+// cached returns the detected type of key, if it has one
+func (d *MIMEDetector) cached(key mimeKey, cacheable bool) (string, bool) {
+	if !cacheable {
+		return "", false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	mimeType, ok := d.cache[key]
+	return mimeType, ok
+}
+
+// specialType returns the type of a file that has no contents to detect
+func specialType(mode fs.FileMode) (string, bool) {
+	switch {
+	case mode.IsDir():
+		return "inode/directory", true
+	case mode&fs.ModeNamedPipe != 0:
+		return "inode/fifo", true
+	case mode&fs.ModeSocket != 0:
+		return "inode/socket", true
+	case mode&fs.ModeCharDevice != 0:
+		return "inode/chardevice", true
+	case mode&fs.ModeDevice != 0:
+		return "inode/blockdevice", true
+	case !mode.IsRegular():
+		return "application/octet-stream", true
+	}
+	return "", false
+}
+
+// DetectContent returns the MIME type of a file named name starting with head.
+// Magic bytes and shebang lines win; a name match refines generic content types.
+func (d *MIMEDetector) DetectContent(name string, head []byte) string {
+	if len(head) == 0 {
+		return "application/x-zerosize"
+	}
+	for _, sig := range magicSignatures {
+		if bytes.HasPrefix(head[min(sig.offset, len(head)):], []byte(sig.magic)) {
+			return sig.mimeType
+		}
+	}
+	if mimeType := shebangType(head); mimeType != "" {
+		return mimeType
+	}
+
+	sniffed := http.DetectContentType(head)
+	if i := strings.IndexByte(sniffed, ';'); i >= 0 {
+		sniffed = sniffed[:i]
+	}
+	if sniffed == "application/x-gzip" {
+		sniffed = "application/gzip"
+	}
+	if !genericTypes[sniffed] {
+		return sniffed
+	}
+
+	byName := d.byName(name)
+	if byName == "" {
+		return sniffed
+	}
+	// A text type from the name does not describe binary content
+	binary := !strings.HasPrefix(sniffed, "text/")
+	if binary && isTextMIME(byName) {
+		return sniffed
+	}
+	return byName
+}
+
+// byName returns the MIME type for a file name from the shared MIME database,
+// falling back to the built-in extension tables. Of the matching patterns the
+// one with the highest weight wins, then the longest.
+func (d *MIMEDetector) byName(name string) string {
+	d.globsOnce.Do(d.loadGlobs)
+
+	lower := strings.ToLower(name)
+	best := mimeGlob{weight: -1}
+	consider := func(glob mimeGlob, ok bool) {
+		if ok && (glob.weight > best.weight || glob.weight == best.weight && len(glob.pattern) > len(best.pattern)) {
+			best = glob
+		}
+	}
+
+	consider(d.literals[lower], d.literals[lower].mimeType != "")
+	for i := 0; i < len(lower); i++ {
+		if lower[i] == '.' {
+			glob, ok := d.extensions[lower[i:]]
+			consider(glob, ok)
+		}
+	}
+	for _, glob := range d.globs {
+		candidate := lower
+		if glob.caseSensitive {
+			candidate = name
+		}
+		matched, _ := filepath.Match(glob.pattern, candidate)
+		consider(glob, matched)
+	}
+	if best.mimeType != "" {
+		return best.mimeType
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if mimeType, ok := extensionTypes[ext]; ok {
+		return mimeType
+	}
+	mimeType := mime.TypeByExtension(ext)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
+
+// loadGlobs reads globs2 (or the older globs) from every database directory,
+// indexing plain names and extensions so lookups need not try every pattern
+func (d *MIMEDetector) loadGlobs() {
+	d.literals = make(map[string]mimeGlob)
+	d.extensions = make(map[string]mimeGlob)
+
+	for _, dir := range d.dirs {
+		globs, err := readGlobs2(filepath.Join(dir, "globs2"))
+		if err != nil {
+			if globs, err = readGlobs(filepath.Join(dir, "globs")); err != nil {
+				continue
+			}
+		}
+		for _, glob := range globs {
+			d.addGlob(glob)
+		}
+	}
+}
+
+// addGlob indexes a pattern; the first definition of a pattern wins, so user
+// databases listed first override the system ones
+func (d *MIMEDetector) addGlob(glob mimeGlob) {
+	switch {
+	case glob.caseSensitive:
+		d.globs = append(d.globs, glob)
+	case !strings.ContainsAny(glob.pattern, "*?["):
+		if _, ok := d.literals[glob.pattern]; !ok {
+			d.literals[glob.pattern] = glob
+		}
+	case strings.HasPrefix(glob.pattern, "*.") && !strings.ContainsAny(glob.pattern[1:], "*?["):
+		ext := glob.pattern[1:]
+		if existing, ok := d.extensions[ext]; !ok || glob.weight > existing.weight {
+			d.extensions[ext] = glob
+		}
+	default:
+		d.globs = append(d.globs, glob)
+	}
+}
+
+// readGlobs2 parses "weight:type:pattern[:flags]" lines
+func readGlobs2(path string) ([]mimeGlob, error) {
+	var globs []mimeGlob
+	err := readMIMELines(path, func(line string) {
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			return
+		}
+		weight, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return
+		}
+		glob := mimeGlob{weight: weight, mimeType: fields[1], pattern: fields[2]}
+		if len(fields) > 3 && strings.Contains(fields[3], "cs") {
+			glob.caseSensitive = true
+		} else {
+			glob.pattern = strings.ToLower(glob.pattern)
+		}
+		globs = append(globs, glob)
+	})
+	return globs, err
+}
+
+// readGlobs parses "type:pattern" lines, which all have the default weight
+func readGlobs(path string) ([]mimeGlob, error) {
+	var globs []mimeGlob
+	err := readMIMELines(path, func(line string) {
+		mimeType, pattern, ok := strings.Cut(line, ":")
+		if ok {
+			globs = append(globs, mimeGlob{weight: 50, mimeType: mimeType, pattern: strings.ToLower(pattern)})
+		}
+	})
+	return globs, err
+}
+
+// readMIMELines calls fn with every non-comment line of a shared MIME database file
+func readMIMELines(path string, fn func(string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && line[0] != '#' {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// shebangType returns the MIME type of a script from its "#!" line
+func shebangType(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return ""
+	}
+	line, _, _ := bytes.Cut(head[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env options such as -S to reach the interpreter
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+	// python3.12 -> python
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+
+	if mimeType, ok := interpreterTypes[interpreter]; ok {
+		return mimeType
+	}
+	return "text/x-script"
+}
+
+// isTextMIME reports whether a MIME type describes human-readable text
+func isTextMIME(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"),
+		strings.HasSuffix(mimeType, "+xml"),
+		strings.HasSuffix(mimeType, "+json"),
+		strings.HasSuffix(mimeType, "script"):
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/yaml", "application/toml",
+		"application/javascript", "application/x-perl", "application/x-ruby", "application/x-php",
+		"application/x-awk", "application/x-typescript", "application/sql":
+		return true
+	}
+	return false
+}
+
+// isArchiveMIME reports whether a MIME type describes an archive or compressed file
+func isArchiveMIME(mimeType string) bool {
+	switch mimeType {
+	case "application/zip", "application/gzip", "application/x-tar", "application/x-compressed-tar",
+		"application/x-xz", "application/x-xz-compressed-tar", "application/zstd",
+		"application/x-zstd-compressed-tar", "application/x-bzip2", "application/x-bzip2-compressed-tar",
+		"application/x-7z-compressed", "application/vnd.rar", "application/x-rar":
+		return true
+	}
+	return false
+}
+
+// mimeKeyOf returns the cache key of path on fsys. Local files are keyed by
+// inode; remote files and archive entries, which have none, by where they are.
+func mimeKeyOf(fsys FS, path string, info fs.FileInfo) (mimeKey, bool) {
+	key := mimeKey{mtime: info.ModTime().UnixNano(), size: info.Size()}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		key.dev, key.ino = uint64(st.Dev), uint64(st.Ino)
+		return key, true
+	}
+	if _, ok := info.Sys().(*sftp.FileStat); ok {
+		key.path = location(fsys, path)
+		return key, true
+	}
+	if _, ok := info.(*archiveEntry); ok {
+		key.path = path
+		return key, true
+	}
+	return mimeKey{}, false
+}
+
+// readHead reads up to mimeSniffBytes from the start of path
+func readHead(fsys FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, mimeSniffBytes)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
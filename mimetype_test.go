@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// testMIMEDetector uses a private shared MIME database so results do not depend on the host
+func testMIMEDetector(t *testing.T) *MIMEDetector {
+	t.Helper()
+	dir := t.TempDir()
+	globs := "# comment\n" +
+		"50:text/x-go:*.go\n" +
+		"50:application/gzip:*.gz\n" +
+		"50:application/x-compressed-tar:*.tar.gz\n" +
+		"50:image/svg+xml:*.svg\n" +
+		"50:text/x-makefile:makefile\n" +
+		"10:text/x-readme:readme*\n" +
+		"50:text/x-c++src:*.C:cs\n"
+	if err := os.WriteFile(filepath.Join(dir, "globs2"), []byte(globs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewMIMEDetector([]string{dir})
+}
+
+func TestDetectContent(t *testing.T) {
+	d := testMIMEDetector(t)
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"empty", "", "application/x-zerosize"},
+		{"deploy", "#!/usr/bin/env bash\necho hi\n", "application/x-shellscript"},
+		{"tool", "#!/usr/bin/env -S python3.12 -u\n", "text/x-python"},
+		{"run", "#!/opt/bin/weird\n", "text/x-script"},
+		{"photo.txt", "\x89PNG\r\n\x1a\n\x00\x00", "image/png"},
+		{"program", "\x7fELF\x02\x01\x01", "application/x-executable"},
+		{"main.go", "package main\n", "text/x-go"},
+		{"Makefile", "all:\n", "text/x-makefile"},
+		{"README.md", "hello\n", "text/x-readme"},
+		{"icon.svg", "<?xml version=\"1.0\"?><svg/>", "image/svg+xml"},
+		{"backup.tar.gz", "\x1f\x8b\x08\x00", "application/x-compressed-tar"},
+		{"data.gz", "\x1f\x8b\x08\x00", "application/gzip"},
+		{"fake.go", "\x00\x01\x02\x03", "application/octet-stream"},
+		{"x.C", "int main() {}\n", "text/x-c++src"},
+		{"notes", "just some text\n", "text/plain"},
+	}
+	for _, tt := range tests {
+		if got := d.DetectContent(tt.name, []byte(tt.head)); got != tt.want {
+			t.Errorf("DetectContent(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectCachesByInodeAndMtime(t *testing.T) {
+	d := testMIMEDetector(t)
+	path := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.Detect(path, nil); got != "application/x-shellscript" {
+		t.Fatalf("got %q, want application/x-shellscript", got)
+	}
+	if len(d.cache) != 1 {
+		t.Fatalf("expected one cached entry, got %d", len(d.cache))
+	}
+
+	// Rewriting the file changes its mtime, so it is detected again
+	if err := os.WriteFile(path, []byte("#!/usr/bin/python3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Detect(path, nil); got != "text/x-python" {
+		t.Errorf("got %q after rewrite, want text/x-python", got)
+	}
+}
+
+func TestDetectSpecialFiles(t *testing.T) {
+	d := testMIMEDetector(t)
+	dir := t.TempDir()
+	if got := d.Detect(dir, nil); got != "inode/directory" {
+		t.Errorf("got %q for a directory", got)
+	}
+	if got := d.Detect(filepath.Join(dir, "missing.go"), nil); got != "text/x-go" {
+		t.Errorf("got %q for a missing file, want the type from its name", got)
+	}
+}
+
+func TestMIMEIconFallback(t *testing.T) {
+	icons := NerdFontIconSet()
+	script := FileItem{name: "deploy", mode: 0755, mime: "application/x-shellscript"}
+	if got := icons.GetFileIcon(script, false); got != icons.MIMEIcons["application/x-shellscript"] {
+		t.Errorf("extensionless script: got %q", got)
+	}
+	photo := FileItem{name: "IMG_0001", mime: "image/heic"}
+	if got := icons.GetFileIcon(photo, false); got != icons.MIMEIcons["image/*"] {
+		t.Errorf("image without extension: got %q", got)
+	}
+	// Extensions still take precedence over content
+	goFile := FileItem{name: "main.go", mime: "text/plain"}
+	if got := icons.GetFileIcon(goFile, false); got != icons.FileTypeIcons[".go"] {
+		t.Errorf("go file: got %q", got)
+	}
+}
+
+// sftpInfo describes a remote file the way the SFTP client does, without an inode
+type sftpInfo struct{ os.FileInfo }
+
+func (sftpInfo) Sys() any { return &sftp.FileStat{} }
+
+func TestDetectCachesArchiveAndRemoteFiles(t *testing.T) {
+	d := testMIMEDetector(t)
+	path := filepath.Join(t.TempDir(), "tools.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("#!/bin/sh\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mount := NewMountFS(OSFS{})
+	entry := filepath.Join(path, "deploy")
+	if got := d.DetectFS(mount, entry, nil); got != "application/x-shellscript" {
+		t.Fatalf("got %q, want application/x-shellscript", got)
+	}
+	info, err := mount.Lstat(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, guessed := d.Guess(mount, entry, info); guessed || got != "application/x-shellscript" {
+		t.Errorf("expected the archive entry to be cached, got %q (guessed %v)", got, guessed)
+	}
+
+	local, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mimeKeyOf(NewMemFS(), "/srv/tools.zip", sftpInfo{local}); !ok {
+		t.Error("expected remote files to have a cache key")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// doubleClickInterval is the longest gap between two clicks on the same row that counts as a double-click
+	doubleClickInterval = 400 * time.Millisecond
+	// wheelScrollLines is how many items one wheel notch scrolls
+	wheelScrollLines = 3
+)
+
+// handleMouse maps mouse events in the tree view to tree rows and the status bar
+func (m Model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.activeView != TreeView {
+		return m, nil
+	}
+
+	footer := m.renderFooter()
+	rows := m.treeRows(footer)
+
+	// In dual-pane mode the column decides which tree the event belongs to
+	pane := m.paneAt(msg.X)
+	tree := m.tree
+	if m.dualPane && pane >= 0 {
+		tree = m.panes[pane]
+	}
+
+	switch msg.Button {
+	case tea.MouseButtonWheelUp, tea.MouseButtonWheelDown:
+		// The preview pane does not scroll
+		if pane >= 0 {
+			delta := wheelScrollLines
+			if msg.Button == tea.MouseButtonWheelUp {
+				delta = -delta
+			}
+			tree.Scroll(delta, rows)
+		}
+		return m, nil
+	case tea.MouseButtonLeft:
+		if msg.Action != tea.MouseActionPress {
+			return m, nil
+		}
+	default:
+		return m, nil
+	}
+
+	// Clicking anywhere on the status bar cancels the running operation
+	if m.height > 0 && msg.Y >= m.height-lipgloss.Height(m.statusBar.View()) {
+		m.cancelOperation()
+		return m, nil
+	}
+
+	// Clicking a tab in the tab bar activates it
+	if msg.Y < m.tabBarLines() {
+		if i := m.tabAt(msg.X); i >= 0 {
+			return m.switchTab(i)
+		}
+		return m, nil
+	}
+
+	row := msg.Y - m.tabBarLines() - treeHeaderLines
+	if row >= rows || pane < 0 {
+		return m, nil
+	}
+	index := tree.ItemAt(row)
+	if index < 0 {
+		return m, nil
+	}
+	if m.dualPane && pane != m.activePane {
+		m = m.focusPane(pane)
+	}
+
+	now := time.Now()
+	doubleClick := index == m.lastClickIndex && pane == m.lastClickPane &&
+		now.Sub(m.lastClickTime) <= doubleClickInterval
+	m.tree.cursor = index
+	if doubleClick {
+		// A third click starts a new double-click rather than extending this one
+		m.lastClickTime = time.Time{}
+		return m.openSelected()
+	}
+
+	m.lastClickIndex = index
+	m.lastClickPane = pane
+	m.lastClickTime = now
+	return m, nil
+}
+
+// openSelected expands or collapses the selected directory or archive, or opens the selected file in the editor
+func (m Model) openSelected() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil {
+		return m, nil
+	}
+
+	if item.isDir {
+		if item.name == ".." {
+			m.config.CurrentDir = item.path
+			return m, m.tree.SetRoot(m.config.CurrentDir)
+		}
+		return m, m.tree.ToggleExpand()
+	}
+
+	if m.pick != nil {
+		return m.pickSelected()
+	}
+	if item.archive {
+		return m, m.tree.ToggleExpand()
+	}
+	return m.openFile(item.path)
+}
+
+// cancelOperation asks the running file operation, if any, to stop
+func (m Model) cancelOperation() {
+	if !m.statusBar.isActive {
+		return
+	}
+	m.statusBar.SetCanceling(true)
+	if m.cleanup != nil {
+		m.cleanup()
+	}
+}
+
+// toggleMouse turns mouse tracking on or off at runtime, e.g. to allow terminal text selection
+func (m Model) toggleMouse() (tea.Model, tea.Cmd) {
+	m.config.Mouse = !m.config.Mouse
+	if m.config.Mouse {
+		m.statusBar.setMessage("Mouse enabled", MessageNormal)
+		return m, tea.EnableMouseCellMotion
+	}
+	m.statusBar.setMessage("Mouse disabled", MessageNormal)
+	return m, tea.DisableMouse
+}
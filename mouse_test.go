@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mouseTestModel builds a model with a fixed window and n items under /root
+func mouseTestModel(n int) Model {
+	tree := NewFileTree("/root")
+	for i := 0; i < n; i++ {
+		tree.items = append(tree.items, FileItem{
+			path:  fmt.Sprintf("/root/dir%02d", i),
+			name:  fmt.Sprintf("dir%02d", i),
+			isDir: true,
+		})
+	}
+	return Model{
+		config:     Config{CurrentDir: "/root"},
+		tree:       tree,
+		activeView: TreeView,
+		statusBar:  NewStatusBar(),
+		width:      80,
+		height:     20,
+	}
+}
+
+func click(m Model, y int) Model {
+	newModel, _ := m.handleMouse(tea.MouseMsg{X: 5, Y: y, Button: tea.MouseButtonLeft, Action: tea.MouseActionPress})
+	return newModel.(Model)
+}
+
+func TestMouseClickSelectsRowWithOffset(t *testing.T) {
+	m := mouseTestModel(50)
+	m.tree.offset = 10
+
+	m = click(m, treeHeaderLines+3)
+	if m.tree.cursor != 13 {
+		t.Errorf("got cursor %d, want 13", m.tree.cursor)
+	}
+
+	// Clicks on the header are ignored
+	m = click(m, 0)
+	if m.tree.cursor != 13 {
+		t.Errorf("expected header click to leave cursor at 13, got %d", m.tree.cursor)
+	}
+}
+
+func TestMouseDoubleClickExpands(t *testing.T) {
+	m := mouseTestModel(5)
+
+	m = click(m, treeHeaderLines+1)
+	if m.tree.expanded["/root/dir01"] {
+		t.Fatal("expected a single click not to expand")
+	}
+	m = click(m, treeHeaderLines+1)
+	if !m.tree.expanded["/root/dir01"] {
+		t.Error("expected a double-click to expand the directory")
+	}
+}
+
+func TestMouseWheelScrolls(t *testing.T) {
+	m := mouseTestModel(50)
+	rows := m.treeRows(m.renderFooter())
+
+	newModel, _ := m.handleMouse(tea.MouseMsg{Button: tea.MouseButtonWheelDown, Action: tea.MouseActionPress})
+	m = newModel.(Model)
+	if m.tree.offset != wheelScrollLines {
+		t.Errorf("got offset %d, want %d", m.tree.offset, wheelScrollLines)
+	}
+	if m.tree.cursor < m.tree.offset || m.tree.cursor >= m.tree.offset+rows {
+		t.Errorf("expected cursor %d to stay visible in rows %d-%d", m.tree.cursor, m.tree.offset, m.tree.offset+rows)
+	}
+
+	newModel, _ = m.handleMouse(tea.MouseMsg{Button: tea.MouseButtonWheelUp, Action: tea.MouseActionPress})
+	m = newModel.(Model)
+	if m.tree.offset != 0 {
+		t.Errorf("got offset %d, want 0", m.tree.offset)
+	}
+}
+
+func TestMouseStatusBarClickCancels(t *testing.T) {
+	m := mouseTestModel(5)
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/root/dir00", 0755); err != nil {
+		t.Fatal(err)
+	}
+	op := NewFileOperation(OpCopy, "/root/dir00", "/root/copy", &FileItem{path: "/root/dir00", name: "dir00", isDir: true})
+	op.fs = fsys
+	m, cmd := m.startOperation(op)
+
+	m = click(m, m.height-1)
+	if !m.statusBar.isCanceling {
+		t.Error("expected a status bar click to cancel the running operation")
+	}
+	done := cmd().(tea.BatchMsg)[0]().(operationDoneMsg)
+	if !errors.Is(done.err, context.Canceled) {
+		t.Errorf("expected the operation to stop, got %v", done.err)
+	}
+}
+
+func TestUpdateScrollsCursorIntoView(t *testing.T) {
+	m := mouseTestModel(50)
+	m.tree.cursor = 40
+
+	m.View()
+	if m.tree.offset != 0 {
+		t.Errorf("expected rendering to leave the offset alone, got %d", m.tree.offset)
+	}
+	newModel, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+	m = newModel.(Model)
+	rows := m.treeRows(m.renderFooter())
+	if m.tree.cursor < m.tree.offset || m.tree.cursor >= m.tree.offset+rows {
+		t.Errorf("expected cursor 40 to be visible, got rows %d-%d", m.tree.offset, m.tree.offset+rows)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// commonEditors are tried in order when neither the config nor the environment names an editor
+var commonEditors = []string{"nvim", "vim", "hx", "micro", "nano", "vi", "emacs", "code"}
+
+// OpenerRule maps files to a command that opens them. A rule matches when any
+// of its extensions, MIME types or globs match; MIME types may end in "/*".
+//
+// The command is split into words before the placeholders {path}, {dir} and
+// {name} are replaced, so paths with spaces need no quoting.
+type OpenerRule struct {
+	Name       string   // shown in the "open with" picker, defaults to the command
+	Extensions []string // e.g. ".png", matched case-insensitively
+	MIME       []string // e.g. "image/*" or "application/pdf"
+	Globs      []string // shell patterns matched against the file name, e.g. "Makefile*"
+	Command    string   // e.g. "feh --scale-down {path}"
+	GUI        bool     // run detached; detected automatically for known GUI programs
+}
+
+// Handler is a command that can open a file
+type Handler struct {
+	Name    string
+	Command string
+	GUI     bool
+}
+
+// ResolveEditor picks the editor from the config, then $VISUAL, then $EDITOR,
+// then the first common editor found on $PATH. It returns "" if there is none.
+func ResolveEditor(configured string) string {
+	for _, editor := range []string{configured, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if strings.TrimSpace(editor) != "" {
+			return editor
+		}
+	}
+	for _, editor := range commonEditors {
+		if _, err := exec.LookPath(editor); err == nil {
+			return editor
+		}
+	}
+	return ""
+}
+
+// systemOpener returns the desktop's default file opener, or "" if it is not installed
+func systemOpener() string {
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	if _, err := exec.LookPath(opener); err != nil {
+		return ""
+	}
+	return opener
+}
+
+// Matches reports whether the rule applies to the file at path with the given MIME type
+func (r OpenerRule) Matches(path, mimeType string) bool {
+	name := filepath.Base(path)
+	for _, ext := range r.Extensions {
+		if strings.HasSuffix(strings.ToLower(name), strings.ToLower(ext)) {
+			return true
+		}
+	}
+	for _, pattern := range r.MIME {
+		if matchMIME(pattern, mimeType) {
+			return true
+		}
+	}
+	for _, glob := range r.Globs {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMIME matches a MIME type against a pattern such as "text/plain" or "image/*"
+func matchMIME(pattern, mimeType string) bool {
+	if mimeType == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return pattern == mimeType
+}
+
+// Handlers lists the commands that can open path on fsys, best first: the
+// matching opener rules in config order, then the editor, then the system opener
+func (c Config) Handlers(fsys FS, path string) []Handler {
+	var handlers []Handler
+	mimeType := mimeTypes.DetectFS(fsys, path, nil)
+	for _, rule := range c.Openers {
+		if rule.Command == "" || !rule.Matches(path, mimeType) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = rule.Command
+		}
+		handlers = append(handlers, Handler{Name: name, Command: rule.Command, GUI: rule.GUI || IsGUIEditor(rule.Command)})
+	}
+
+	if editor := ResolveEditor(c.Editor); editor != "" {
+		handlers = append(handlers, Handler{Name: editor, Command: editor + " {path}", GUI: IsGUIEditor(editor)})
+	}
+	if opener := systemOpener(); opener != "" {
+		handlers = append(handlers, Handler{Name: opener, Command: opener + " {path}", GUI: true})
+	}
+	return handlers
+}
+
+// HandlerCommand builds the command that runs handler on path
+func HandlerCommand(handler Handler, path string) (*exec.Cmd, error) {
+	fields := strings.Fields(handler.Command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty command for %s", handler.Name)
+	}
+	replacer := strings.NewReplacer(
+		"{path}", path,
+		"{dir}", filepath.Dir(path),
+		"{name}", filepath.Base(path),
+	)
+	args := make([]string, len(fields))
+	for i, field := range fields {
+		args[i] = replacer.Replace(field)
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// runHandler opens path with handler, taking over the terminal unless it is a GUI program
+func (m Model) runHandler(handler Handler, path string) (tea.Model, tea.Cmd) {
+	if isRemote(m.tree.fs) {
+		m.statusBar.setMessage(fmt.Sprintf("%s is remote; copy it to a local pane to open it", filepath.Base(path)), MessageError)
+		return m, nil
+	}
+	if inArchive(m.tree.fs, path) {
+		m.statusBar.setMessage(fmt.Sprintf("%s is inside an archive; extract it to open it", filepath.Base(path)), MessageError)
+		return m, nil
+	}
+	cmd, err := HandlerCommand(handler, path)
+	if err != nil {
+		m.statusBar.setMessage(fmt.Sprintf("Error opening file: %v", err), MessageError)
+		return m, nil
+	}
+
+	if handler.GUI {
+		if err := StartDetached(cmd); err != nil {
+			m.statusBar.setMessage(fmt.Sprintf("Error opening file: %v", err), MessageError)
+			return m, nil
+		}
+		m.statusBar.setMessage(fmt.Sprintf("Opened %s with %s", filepath.Base(path), handler.Name), MessageNormal)
+		return m, nil
+	}
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return editorFinishedMsg{path: path, err: err}
+	})
+}
+
+// openFile opens path with its best handler
+func (m Model) openFile(path string) (tea.Model, tea.Cmd) {
+	handlers := m.config.Handlers(m.tree.fs, path)
+	if len(handlers) == 0 {
+		m.statusBar.setMessage("No editor or opener found; set editor in the config or $EDITOR", MessageError)
+		return m, nil
+	}
+	return m.runHandler(handlers[0], path)
+}
+
+// openWithPicker lists the handlers for a file so the user can choose one
+type openWithPicker struct {
+	path     string
+	handlers []Handler
+	cursor   int
+}
+
+// openWith shows the "open with" picker for the selected file
+func (m Model) openWith() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.isDir {
+		return m, nil
+	}
+	if item.entry {
+		m.statusBar.setMessage(fmt.Sprintf("%s is inside an archive; extract it to open it", item.name), MessageError)
+		return m, nil
+	}
+	handlers := m.config.Handlers(m.tree.fs, item.path)
+	if len(handlers) == 0 {
+		m.statusBar.setMessage("No editor or opener found; set editor in the config or $EDITOR", MessageError)
+		return m, nil
+	}
+	m.picker = &openWithPicker{path: item.path, handlers: handlers}
+	m.activeView = OpenWithView
+	return m, nil
+}
+
+func (m Model) handleOpenWithViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.picker == nil {
+		m.activeView = TreeView
+		return m, nil
+	}
+
+	switch m.keys.Lookup(OpenWithView, msg.String()) {
+	case ActionPickerUp:
+		m.picker.cursor = max(m.picker.cursor-1, 0)
+	case ActionPickerDown:
+		m.picker.cursor = min(m.picker.cursor+1, len(m.picker.handlers)-1)
+	case ActionPickerSelect:
+		picker := m.picker
+		m.picker = nil
+		m.activeView = TreeView
+		return m.runHandler(picker.handlers[picker.cursor], picker.path)
+	case ActionPickerCancel:
+		m.picker = nil
+		m.activeView = TreeView
+	case ActionHelp:
+		return m.openHelp(), nil
+	}
+	return m, nil
+}
+
+// View renders the picker
+func (p *openWithPicker) View() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(fmt.Sprintf("Open %s with:", filepath.Base(p.path))) + "\n\n")
+	for i, handler := range p.handlers {
+		line := handler.Name
+		if handler.GUI {
+			line += inactiveHeaderStyle.Render(" (window)")
+		}
+		if i == p.cursor {
+			b.WriteString(selectedStyle.Render("> "+handler.Name) + strings.TrimPrefix(line, handler.Name) + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveEditor(t *testing.T) {
+	// An empty PATH with one fake editor makes the fallback deterministic
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "nano"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if got := ResolveEditor(""); got != "nano" {
+		t.Errorf("PATH fallback: got %q, want nano", got)
+	}
+	t.Setenv("EDITOR", "vi")
+	if got := ResolveEditor(""); got != "vi" {
+		t.Errorf("$EDITOR: got %q, want vi", got)
+	}
+	t.Setenv("VISUAL", "hx")
+	if got := ResolveEditor(""); got != "hx" {
+		t.Errorf("$VISUAL: got %q, want hx", got)
+	}
+	if got := ResolveEditor("code"); got != "code" {
+		t.Errorf("config: got %q, want code", got)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if got := ResolveEditor(""); got != "" {
+		t.Errorf("expected no editor, got %q", got)
+	}
+}
+
+func TestOpenerRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule OpenerRule
+		path string
+		mime string
+		want bool
+	}{
+		{OpenerRule{Extensions: []string{".PNG"}}, "/a/photo.png", "", true},
+		{OpenerRule{MIME: []string{"image/*"}}, "/a/photo", "image/jpeg", true},
+		{OpenerRule{MIME: []string{"application/pdf"}}, "/a/doc.pdf", "application/pdf", true},
+		{OpenerRule{MIME: []string{"image/*"}}, "/a/doc.pdf", "application/pdf", false},
+		{OpenerRule{Globs: []string{"Makefile*"}}, "/a/Makefile.am", "", true},
+		{OpenerRule{Globs: []string{"Makefile*"}}, "/a/GNUmakefile", "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Matches(tt.path, tt.mime); got != tt.want {
+			t.Errorf("%+v matching %s: got %v, want %v", tt.rule, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHandlersOrder(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	config := Config{
+		Editor: "vim",
+		Openers: []OpenerRule{
+			{Name: "viewer", Extensions: []string{".png"}, Command: "feh {path}"},
+			{Extensions: []string{".txt"}, Command: "less {path}"},
+			{MIME: []string{"image/*"}, Command: "gimp {path}"},
+		},
+	}
+
+	var names []string
+	for _, h := range config.Handlers(OSFS{}, "/a/photo.png") {
+		names = append(names, h.Name)
+	}
+	if want := []string{"viewer", "gimp {path}", "vim"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got handlers %v, want %v", names, want)
+	}
+}
+
+func TestHandlersSniffTheTreeFS(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	config := Config{Openers: []OpenerRule{{MIME: []string{"image/png"}, Command: "feh {path}"}}}
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/a", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, "/a/photo", []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No such file exists on disk, so only reading fsys finds the image
+	if handlers := config.Handlers(fsys, "/a/photo"); len(handlers) == 0 || handlers[0].Name != "feh {path}" {
+		t.Errorf("got handlers %v, want feh first", handlers)
+	}
+}
+
+func TestHandlerCommandPlaceholders(t *testing.T) {
+	handler := Handler{Name: "vim", Command: "vim {path} --dir={dir} --title={name}"}
+	cmd, err := HandlerCommand(handler, "/my dir/file name.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"vim", "/my dir/file name.go", "--dir=/my dir", "--title=file name.go"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("got args %q, want %q", cmd.Args, want)
+	}
+}
+
+func TestOpenWithPicker(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	m := tabModel(dir)
+	m.keys = DefaultKeyMap()
+	m.config.Editor = "vim"
+	m.config.Openers = []OpenerRule{{Extensions: []string{".txt"}, Command: "less {path}"}}
+	m.tree.cursor = 1
+
+	newModel, _ := m.handleTreeViewKeys(key("w"))
+	m = newModel.(Model)
+	if m.activeView != OpenWithView || len(m.picker.handlers) != 2 {
+		t.Fatalf("expected the picker with two handlers, got view %v", m.activeView)
+	}
+
+	newModel, _ = m.handleOpenWithViewKeys(key("j"))
+	m = newModel.(Model)
+	if m.picker.cursor != 1 {
+		t.Errorf("got cursor %d, want 1", m.picker.cursor)
+	}
+
+	newModel, cmd := m.handleOpenWithViewKeys(key("enter"))
+	m = newModel.(Model)
+	if m.activeView != TreeView || m.picker != nil || cmd == nil {
+		t.Error("expected selecting a handler to close the picker and run it")
+	}
+}
+
+func TestArchiveEntriesAreNotOpened(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "project.zip")
+	writeTestArchive(t, path, "zip")
+	t.Setenv("PATH", t.TempDir())
+
+	m := tabModel(dir)
+	m.keys = DefaultKeyMap()
+	m.config.Editor = "vim"
+	m.tree.expanded[path] = true
+	m.tree.expanded[filepath.Join(path, "src")] = true
+	m.tree.setItems(m.tree.LoadDirectory(dir)().(loadedDirectoryMsg).items)
+	for i, item := range m.tree.items {
+		if item.path == filepath.Join(path, "src/main.go") {
+			m.tree.cursor = i
+		}
+	}
+	if item := m.tree.GetSelectedItem(); item == nil || !item.entry {
+		t.Fatalf("expected an archive entry to be selected, got %+v", item)
+	}
+
+	for _, k := range []string{"enter", "e", "w"} {
+		m.statusBar.setMessage("", MessageNormal)
+		newModel, cmd := m.handleTreeViewKeys(key(k))
+		got := newModel.(Model)
+		if cmd != nil || got.activeView != TreeView || !strings.Contains(got.statusBar.message, "inside an archive") {
+			t.Errorf("%s: expected a refusal, got view %v and message %q", k, got.activeView, got.statusBar.message)
+		}
+	}
+}
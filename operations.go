@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// operationPollInterval is how often the status bar samples a running operation
+const operationPollInterval = 100 * time.Millisecond
+
+// operationDoneMsg reports that a background file operation finished
+type operationDoneMsg struct {
+	state *OperationState
+	err   error
+}
+
+// operationTickMsg asks the model to sample the progress of a running operation
+type operationTickMsg struct {
+	state *OperationState
+}
+
+// confirmPrompt is a destructive operation waiting for the user to confirm it
+type confirmPrompt struct {
+	message string
+	op      FileOperation
+}
+
+// newOperation creates an operation on the filesystem of the active tree
+func (m Model) newOperation(opType OperationType, source, dest string, selected *FileItem) FileOperation {
+	op := NewFileOperation(opType, source, dest, selected)
+	op.fs = m.tree.fs
+	op.preserve = m.config.Preserve
+	op.parallelism = m.config.Parallelism
+	op.conflicts = newConflictResolver(m.config.Conflicts, true)
+	return op
+}
+
+// startOperation runs op in the background and streams its progress to the status bar
+func (m Model) startOperation(op FileOperation) (Model, tea.Cmd) {
+	if m.operation != nil {
+		m.statusBar.setMessage("Another operation is still running", MessageError)
+		return m, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op.ctx = ctx
+	m.cleanup = cancel
+	m.operation = op.state
+
+	m.statusBar.StartProgress()
+	m.statusBar.UpdateOperation(op.state.Snapshot())
+
+	return m, tea.Batch(
+		func() tea.Msg {
+			return operationDoneMsg{state: op.state, err: ExecuteFileOperation(op)}
+		},
+		pollOperation(op.state),
+	)
+}
+
+// pollOperation schedules the next progress sample for state
+func pollOperation(state *OperationState) tea.Cmd {
+	return tea.Tick(operationPollInterval, func(time.Time) tea.Msg {
+		return operationTickMsg{state: state}
+	})
+}
+
+// handleOperationTick refreshes the status bar while the operation is still running
+func (m Model) handleOperationTick(msg operationTickMsg) (tea.Model, tea.Cmd) {
+	if msg.state != m.operation {
+		return m, nil
+	}
+	snapshot := msg.state.Snapshot()
+	m.statusBar.UpdateOperation(snapshot)
+	m.statusBar.UpdateProgress(snapshot.Progress)
+	// A conflict waits for the user to finish what they are doing in another view
+	if snapshot.Conflict != nil && snapshot.Conflict != m.conflict && m.activeView == TreeView {
+		m.conflict = snapshot.Conflict
+		m.activeView = ConflictView
+	}
+	return m, pollOperation(msg.state)
+}
+
+// handleOperationDone reports the outcome of an operation and reloads the trees
+func (m Model) handleOperationDone(msg operationDoneMsg) (tea.Model, tea.Cmd) {
+	if msg.state != m.operation {
+		return m, nil
+	}
+	if m.cleanup != nil {
+		m.cleanup()
+	}
+	m.cleanup = nil
+	m.operation = nil
+	m.conflict = nil
+	if m.activeView == ConflictView {
+		m.activeView = TreeView
+	}
+
+	m.statusBar.StopProgress()
+	m.statusBar.SetCanceling(false)
+	m.statusBar.UpdateOperation(msg.state.Snapshot())
+	if errors.Is(msg.err, context.Canceled) {
+		m.statusBar.setMessage("Operation canceled", MessageError)
+	}
+
+	return m, m.reloadPanes()
+}
+
+// reloadPanes reloads every visible tree so they reflect the result of an operation
+func (m Model) reloadPanes() tea.Cmd {
+	if !m.dualPane {
+		return m.tree.LoadDirectory(m.tree.root)
+	}
+	return tea.Batch(
+		m.panes[0].LoadDirectory(m.panes[0].root),
+		m.panes[1].LoadDirectory(m.panes[1].root),
+	)
+}
+
+// promptOperation asks for the destination of a rename, move or copy of the selected item
+func (m Model) promptOperation(inputType InputType) (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.name == ".." {
+		return m, nil
+	}
+
+	initial := item.name
+	if inputType == InputMove || inputType == InputCopy {
+		initial = location(m.tree.fs, item.path)
+		// Like a two-panel commander, default to the directory shown in the other pane
+		if other := m.otherPane(); other != nil {
+			initial = location(other.fs, other.root) + string(os.PathSeparator)
+		}
+	}
+
+	selected := *item
+	m.inputItem = &selected
+	m.input = NewInput(inputType, initial)
+	m.activeView = InputView
+	return m, nil
+}
+
+// submitInput starts the operation described by a completed input prompt
+func (m Model) submitInput(inputType InputType, value string) (tea.Model, tea.Cmd) {
+	if inputType == InputFilter {
+		return m, m.tree.SetFilter(strings.TrimSpace(value))
+	}
+
+	item := m.inputItem
+	m.inputItem = nil
+	if item == nil || strings.TrimSpace(value) == "" {
+		return m, nil
+	}
+
+	if inputType == InputRename {
+		return m.startOperation(m.newOperation(OpRename, item.path, filepath.Join(filepath.Dir(item.path), value), item))
+	}
+
+	destFs, dest, err := m.locate(value)
+	if err != nil {
+		m.statusBar.setMessage(err.Error(), MessageError)
+		return m, nil
+	}
+	var op FileOperation
+	switch inputType {
+	case InputMove:
+		op = m.newOperation(OpMove, item.path, resolveDestination(destFs, dest, item), item)
+	case InputCopy:
+		op = m.newOperation(OpCopy, item.path, resolveDestination(destFs, dest, item), item)
+	case InputCompress:
+		op = m.newOperation(OpCompress, item.path, freeName(destFs, dest), item)
+		op.Sources = m.inputPaths
+	case InputExtract:
+		op = m.newOperation(OpExtract, item.path, freeName(destFs, dest), item)
+	default:
+		return m, nil
+	}
+	op.destFs = destFs
+
+	return m.startOperation(op)
+}
+
+// locate resolves a path typed at a prompt to the filesystem holding it: an
+// sftp:// URL names a connected host, an absolute path the local disk, and a
+// relative path is taken from the active tree
+func (m Model) locate(value string) (FS, string, error) {
+	if strings.HasPrefix(value, sftpScheme) {
+		target, err := ParseSFTPURL(value)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, fsys := range m.filesystems() {
+			if remote, ok := fsys.(*SFTPFS); ok && remote.Label() == target.Label() {
+				if target.Path == "" {
+					return nil, "", fmt.Errorf("%s: no path given", value)
+				}
+				return remote, path.Clean(target.Path), nil
+			}
+		}
+		return nil, "", fmt.Errorf("not connected to %s; start modaltree on %s%s to browse it", target.Label(), sftpScheme, target.Label())
+	}
+	if filepath.IsAbs(value) {
+		return m.localFS(), filepath.Clean(value), nil
+	}
+	return m.tree.fs, filepath.Join(m.tree.root, value), nil
+}
+
+// filesystems returns the filesystems of every tree, the active one first
+func (m Model) filesystems() []FS {
+	filesystems := []FS{m.tree.fs}
+	for _, tree := range m.panes {
+		if tree != nil {
+			filesystems = append(filesystems, tree.fs)
+		}
+	}
+	for _, tab := range m.tabs {
+		for _, tree := range tab.panes {
+			if tree != nil {
+				filesystems = append(filesystems, tree.fs)
+			}
+		}
+	}
+	return filesystems
+}
+
+// localFS returns the filesystem of the local disk a tree already uses, so
+// operations between local trees stay on one filesystem
+func (m Model) localFS() FS {
+	for _, fsys := range m.filesystems() {
+		if fsys != nil && !isRemote(fsys) {
+			return fsys
+		}
+	}
+	return NewMountFS(OSFS{})
+}
+
+// resolveDestination places the item inside dest when it names an existing directory of fsys
+func resolveDestination(fsys FS, dest string, item *FileItem) string {
+	if info, err := fsys.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, item.name)
+	}
+	return filepath.Clean(dest)
+}
+
+// promptCompress asks for the archive to pack the marked items, or else the
+// selected one, into. It proposes a free .tar.gz name next to them, named after
+// a single item or after the directory holding several; the extension picks the format.
+func (m Model) promptCompress() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.name == ".." {
+		return m, nil
+	}
+
+	sources := m.tree.MarkedPaths()
+	if len(sources) == 0 {
+		sources = []string{item.path}
+	}
+	dir := filepath.Dir(sources[0])
+	name := filepath.Base(sources[0])
+	if len(sources) > 1 {
+		name = filepath.Base(dir)
+	}
+
+	selected := *item
+	m.inputItem = &selected
+	m.inputPaths = sources
+	m.input = NewInput(InputCompress, location(m.tree.fs, freeName(m.tree.fs, filepath.Join(dir, name+".tar.gz"))))
+	m.activeView = InputView
+	return m, nil
+}
+
+// promptExtract asks for the directory to unpack the selected archive into,
+// proposing a free one named after the archive, next to it or in the other pane
+func (m Model) promptExtract() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.name == ".." {
+		return m, nil
+	}
+	if item.isDir || archiveKind(item.name, item.mime) == "" {
+		m.statusBar.setMessage(fmt.Sprintf("%s is not an archive", item.name), MessageError)
+		return m, nil
+	}
+
+	fsys, dir := m.tree.fs, filepath.Dir(item.path)
+	if other := m.otherPane(); other != nil {
+		fsys, dir = other.fs, other.root
+	}
+	stem, _ := splitArchiveExt(item.name)
+
+	selected := *item
+	m.inputItem = &selected
+	m.input = NewInput(InputExtract, location(fsys, freeName(fsys, filepath.Join(dir, stem))))
+	m.activeView = InputView
+	return m, nil
+}
+
+// promptDelete deletes the selected item, asking first when ConfirmActions is set
+func (m Model) promptDelete() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.name == ".." {
+		return m, nil
+	}
+
+	selected := *item
+	op := m.newOperation(OpDelete, selected.path, "", &selected)
+	if !m.config.ConfirmActions {
+		return m.startOperation(op)
+	}
+
+	m.confirm = &confirmPrompt{
+		message: fmt.Sprintf("Delete %s? (y/n)", selected.path),
+		op:      op,
+	}
+	m.activeView = ConfirmView
+	return m, nil
+}
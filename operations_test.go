@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestDeleteAsksFirst(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree := NewFileTree(dir)
+	tree.setItems(tree.LoadDirectory(dir)().(loadedDirectoryMsg).items)
+	tree.cursor = 1 // skip ".."
+	m := Model{
+		config:     Config{CurrentDir: dir, ConfirmActions: true},
+		tree:       tree,
+		activeView: TreeView,
+		statusBar:  NewStatusBar(),
+		keys:       DefaultKeyMap(),
+	}
+
+	newModel, _ := m.handleTreeViewKeys(key("d"))
+	m = newModel.(Model)
+	if m.activeView != ConfirmView || m.operation != nil {
+		t.Fatal("expected delete to ask before starting")
+	}
+	newModel, _ = m.handleConfirmViewKeys(key("n"))
+	m = newModel.(Model)
+	if m.activeView != TreeView || m.operation != nil {
+		t.Fatal("expected n to go back without deleting")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected notes.txt to be kept: %v", err)
+	}
+
+	newModel, _ = m.handleTreeViewKeys(key("d"))
+	m = newModel.(Model)
+	newModel, cmd := m.handleConfirmViewKeys(key("y"))
+	m = newModel.(Model)
+	if m.operation == nil || cmd == nil {
+		t.Fatal("expected y to start the delete")
+	}
+	if done := cmd().(tea.BatchMsg)[0]().(operationDoneMsg); done.err != nil {
+		t.Fatalf("delete failed: %v", done.err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected notes.txt to be deleted, got %v", err)
+	}
+}
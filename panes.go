@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// inactiveHeaderStyle dims the header of the pane that does not have focus
+var inactiveHeaderStyle = lipgloss.NewStyle().Faint(true)
+
+// otherPane returns the tree in the inactive pane, or nil outside dual-pane mode
+func (m Model) otherPane() *FileTree {
+	if !m.dualPane {
+		return nil
+	}
+	return m.panes[1-m.activePane]
+}
+
+// focusPane makes pane i the active one
+func (m Model) focusPane(i int) Model {
+	m.activePane = i
+	m.tree = m.panes[i]
+	m.config.CurrentDir = m.tree.root
+	m.statusBar.UpdatePath(m.tree.root)
+	m.statusBar.UpdateConnection(m.tree.fs)
+	return m
+}
+
+// toggleDualPane switches between the single tree and two side-by-side trees
+func (m Model) toggleDualPane() (tea.Model, tea.Cmd) {
+	m.dualPane = !m.dualPane
+	if !m.dualPane {
+		m = m.focusPane(0)
+		return m, nil
+	}
+
+	// Open the second pane on the current directory the first time it is shown.
+	// Next to a remote tree it shows the local working directory instead, to
+	// copy between the two.
+	other := m.panes[1]
+	if other.root == "" {
+		other.root = m.tree.root
+		other.fs = m.tree.fs
+		if isRemote(m.tree.fs) {
+			other.root, _ = os.Getwd()
+			other.fs = NewMountFS(OSFS{})
+		}
+		other.showHidden = m.tree.showHidden
+		other.sortBy = m.tree.sortBy
+	}
+	if len(other.items) == 0 {
+		return m, other.LoadDirectory(other.root)
+	}
+	return m, nil
+}
+
+// columns returns how many columns the tree view is split into: one or two
+// trees, plus the preview pane when it is shown
+func (m Model) columns() int {
+	n := 1
+	if m.dualPane {
+		n++
+	}
+	if m.config.Preview {
+		n++
+	}
+	return n
+}
+
+// paneAt returns the index of the pane drawn at screen column x, or -1 for the preview pane
+func (m Model) paneAt(x int) int {
+	if m.columns() == 1 {
+		return 0
+	}
+	i := x / m.paneWidth()
+	if m.dualPane && i <= 1 {
+		return i
+	}
+	if i == 0 {
+		return 0
+	}
+	return -1
+}
+
+// paneWidth returns the width of one column when the tree view is split
+func (m Model) paneWidth() int {
+	width := m.width
+	if width <= 0 {
+		width = MinWindowWidth
+	}
+	return width / m.columns()
+}
+
+// renderPane draws a tree's header and its visible rows. A width of zero leaves lines unpadded.
+func (m Model) renderPane(tree *FileTree, rows, width int, active bool) string {
+	var lines []string
+
+	header := fmt.Sprintf("Directory: %s", location(tree.fs, tree.root))
+	if active {
+		lines = append(lines, headerStyle.Render(header), "")
+	} else {
+		lines = append(lines, inactiveHeaderStyle.Render(header), "")
+	}
+
+	prefixes := m.config.treeSymbols.Prefixes(tree.items, m.config.Display.IndentSize)
+	end := min(tree.offset+rows, len(tree.items))
+	for i := tree.offset; i < end; i++ {
+		lines = append(lines, m.renderTreeItem(tree, tree.items[i], i, prefixes[i], active))
+	}
+
+	if width <= 0 {
+		return strings.Join(lines, "\n")
+	}
+
+	// Pad short panes so both columns line up, and clip lines to the pane width
+	for len(lines) < rows+treeHeaderLines {
+		lines = append(lines, "")
+	}
+	column := lipgloss.NewStyle().Width(width)
+	for i, line := range lines {
+		lines[i] = column.Render(ansi.Truncate(line, width-1, "…"))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// dualPaneModel builds a model in dual-pane mode with each pane rooted at its own directory
+func dualPaneModel(left, right string) Model {
+	panes := [2]*FileTree{NewFileTree(left), NewFileTree(right)}
+	for _, pane := range panes {
+		msg := pane.LoadDirectory(pane.root)().(loadedDirectoryMsg)
+		pane.items = msg.items
+	}
+	return Model{
+		config:     Config{CurrentDir: left, ConfirmActions: true},
+		tree:       panes[0],
+		panes:      panes,
+		dualPane:   true,
+		activeView: TreeView,
+		statusBar:  NewStatusBar(),
+	}
+}
+
+func key(s string) tea.KeyMsg {
+	switch s {
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestSwitchPane(t *testing.T) {
+	left, right := t.TempDir(), t.TempDir()
+	m := dualPaneModel(left, right)
+
+	newModel, _ := m.handleTreeViewKeys(key("tab"))
+	m = newModel.(Model)
+	if m.activePane != 1 || m.tree != m.panes[1] {
+		t.Fatal("expected tab to focus the right pane")
+	}
+	if m.config.CurrentDir != right {
+		t.Errorf("got current dir %q, want %q", m.config.CurrentDir, right)
+	}
+}
+
+func TestPanesKeepIndependentState(t *testing.T) {
+	left, right := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(left, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := dualPaneModel(left, right)
+
+	newModel, _ := m.handleTreeViewKeys(key("j"))
+	m = newModel.(Model)
+	newModel, _ = m.handleTreeViewKeys(key("tab"))
+	m = newModel.(Model)
+
+	if m.panes[0].cursor != 1 || m.panes[1].cursor != 0 {
+		t.Errorf("expected independent cursors, got %d and %d", m.panes[0].cursor, m.panes[1].cursor)
+	}
+}
+
+func TestCopyDefaultsToOtherPane(t *testing.T) {
+	left, right := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(left, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := dualPaneModel(left, right)
+	m.tree.cursor = 1 // skip ".."
+
+	newModel, _ := m.handleTreeViewKeys(key("c"))
+	m = newModel.(Model)
+	if m.activeView != InputView {
+		t.Fatal("expected copy to prompt for a destination")
+	}
+	if want := right + string(os.PathSeparator); m.input.value != want {
+		t.Errorf("got default destination %q, want %q", m.input.value, want)
+	}
+
+	newModel, cmd := m.handleInputViewKeys(key("enter"))
+	m = newModel.(Model)
+	if m.operation == nil || cmd == nil {
+		t.Fatal("expected the copy to start")
+	}
+
+	// The first command of the batch runs the operation to completion
+	done := cmd().(tea.BatchMsg)[0]().(operationDoneMsg)
+	if done.err != nil {
+		t.Fatalf("copy failed: %v", done.err)
+	}
+	data, err := os.ReadFile(filepath.Join(right, "notes.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("expected notes.txt to be copied into the other pane, got %q (%v)", data, err)
+	}
+
+	newModel, _ = m.Update(done)
+	m = newModel.(Model)
+	if m.operation != nil || m.statusBar.isActive {
+		t.Error("expected the operation to be cleared once done")
+	}
+}
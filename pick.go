@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Exit codes of picker mode, following fzf: scripts can tell a selection from a cancel
+const (
+	exitPicked   = 0   // paths were written
+	exitError    = 1   // something went wrong
+	exitUsage    = 2   // invalid command line
+	exitCanceled = 130 // the user quit without choosing
+)
+
+// PickMode configures running modaltree as a picker (--pick), where choosing
+// files quits and prints their paths instead of opening them
+type PickMode struct {
+	Multi    bool     // allow choosing the marked set rather than a single file
+	Print0   bool     // separate paths with NUL instead of newline
+	Output   string   // file to write the paths to, stdout when empty
+	Selected []string // chosen paths; empty when the user canceled
+}
+
+// pickSelected chooses the marked set, if marking is allowed and anything is
+// marked, or else the item under the cursor, and quits
+func (m Model) pickSelected() (tea.Model, tea.Cmd) {
+	if m.pick.Multi {
+		if marked := m.tree.MarkedPaths(); len(marked) > 0 {
+			m.pick.Selected = marked
+			return m, tea.Quit
+		}
+	}
+
+	item := m.tree.GetSelectedItem()
+	if item == nil || item.name == ".." {
+		return m, nil
+	}
+	m.pick.Selected = []string{item.path}
+	return m, tea.Quit
+}
+
+// WritePicked writes paths terminated by newlines, or by NULs when print0 is set
+func WritePicked(w io.Writer, paths []string, print0 bool) error {
+	sep := "\n"
+	if print0 {
+		sep = "\x00"
+	}
+	for _, path := range paths {
+		if _, err := io.WriteString(w, path+sep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishPick writes the picked paths and returns the exit code of picker mode
+func finishPick(pick *PickMode) int {
+	if len(pick.Selected) == 0 {
+		return exitCanceled
+	}
+
+	out := io.Writer(os.Stdout)
+	if pick.Output != "" {
+		f, err := os.Create(pick.Output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing picked paths: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := WritePicked(out, pick.Selected, pick.Print0); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing picked paths: %v\n", err)
+		return exitError
+	}
+	return exitPicked
+}
+
+// ttyProgramOptions renders the TUI on the controlling terminal so stdin and
+// stdout stay free for pipes. The terminal stays open until the process exits.
+func ttyProgramOptions() ([]tea.ProgramOption, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("picker mode needs a terminal: %w", err)
+	}
+	// Colors are otherwise chosen for stdout, which is usually a pipe here
+	renderer := lipgloss.NewRenderer(tty)
+	lipgloss.SetColorProfile(renderer.ColorProfile())
+	lipgloss.SetHasDarkBackground(renderer.HasDarkBackground())
+	return []tea.ProgramOption{tea.WithInput(tty), tea.WithOutput(tty)}, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func pickModel(t *testing.T, multi bool) (Model, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := tabModel(dir)
+	m.keys = DefaultKeyMap()
+	m.pick = &PickMode{Multi: multi}
+	return m, dir
+}
+
+func TestPickFileOnEnter(t *testing.T) {
+	m, dir := pickModel(t, false)
+
+	// Enter on a directory still expands it
+	m.tree.cursor = 1
+	if newModel, _ := m.handleTreeViewKeys(key("enter")); len(newModel.(Model).pick.Selected) != 0 {
+		t.Fatal("expected enter on a directory not to pick it")
+	}
+
+	m.tree.cursor = 2
+	newModel, cmd := m.handleTreeViewKeys(key("enter"))
+	m = newModel.(Model)
+	if cmd == nil {
+		t.Error("expected picking to quit")
+	}
+	if want := []string{filepath.Join(dir, "a.txt")}; !reflect.DeepEqual(m.pick.Selected, want) {
+		t.Errorf("got %v, want %v", m.pick.Selected, want)
+	}
+}
+
+func TestPickMarkedSet(t *testing.T) {
+	m, dir := pickModel(t, true)
+
+	// Marking moves down, so marking twice from "sub" marks "sub" and "a.txt"
+	m.tree.cursor = 1
+	newModel, _ := m.handleTreeViewKeys(key(" "))
+	m = newModel.(Model)
+	newModel, _ = m.handleTreeViewKeys(key(" "))
+	m = newModel.(Model)
+
+	newModel, _ = m.handleTreeViewKeys(key("enter"))
+	m = newModel.(Model)
+	want := []string{filepath.Join(dir, "sub"), filepath.Join(dir, "a.txt")}
+	if !reflect.DeepEqual(m.pick.Selected, want) {
+		t.Errorf("got %v, want %v", m.pick.Selected, want)
+	}
+}
+
+func TestWritePicked(t *testing.T) {
+	var b bytes.Buffer
+	WritePicked(&b, []string{"/a", "/b c"}, false)
+	if b.String() != "/a\n/b c\n" {
+		t.Errorf("got %q", b.String())
+	}
+	b.Reset()
+	WritePicked(&b, []string{"/a", "/b c"}, true)
+	if b.String() != "/a\x00/b c\x00" {
+		t.Errorf("got %q with print0", b.String())
+	}
+}
+
+func TestFinishPickExitCodes(t *testing.T) {
+	if code := finishPick(&PickMode{}); code != exitCanceled {
+		t.Errorf("cancel: got exit code %d, want %d", code, exitCanceled)
+	}
+
+	out := filepath.Join(t.TempDir(), "picked")
+	if code := finishPick(&PickMode{Output: out, Selected: []string{"/x"}}); code != exitPicked {
+		t.Errorf("selection: got exit code %d, want %d", code, exitPicked)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "/x\n" {
+		t.Errorf("got output %q", data)
+	}
+}
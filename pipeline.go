@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultParallelism is how many files recursive copies and deletes work on at once
+const DefaultParallelism = 8
+
+// pipelineEntry is an item a tree pipeline walked to, with where its copy goes
+type pipelineEntry struct {
+	src, dst string
+	info     fs.FileInfo
+}
+
+// treePipeline runs the work of a recursive operation. A walker lists the
+// tree in the calling goroutine while a bounded pool of workers handles the
+// files it finds; directories are left to the caller, since they can only be
+// finished once everything below them is. The first error stops the rest.
+type treePipeline struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	entries chan pipelineEntry
+	workers sync.WaitGroup
+	once    sync.Once
+	err     error
+}
+
+// startTreePipeline starts workers that call work on each entry sent to the pipeline
+func startTreePipeline(op FileOperation, work func(ctx context.Context, entry pipelineEntry) error) *treePipeline {
+	ctx, cancel := context.WithCancel(op.context())
+	workers := op.workers()
+	p := &treePipeline{ctx: ctx, cancel: cancel, entries: make(chan pipelineEntry, 4*workers)}
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for entry := range p.entries {
+				if ctx.Err() != nil {
+					continue // drain what the walker already queued
+				}
+				p.fail(work(ctx, entry))
+			}
+		}()
+	}
+	return p
+}
+
+// fail records the first error and stops the pipeline
+func (p *treePipeline) fail(err error) {
+	if err != nil {
+		p.once.Do(func() {
+			p.err = err
+			p.cancel()
+		})
+	}
+}
+
+// send queues entry for a worker, giving up once the pipeline has stopped
+func (p *treePipeline) send(entry pipelineEntry) error {
+	select {
+	case p.entries <- entry:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// wait stops taking entries, waits for the workers to finish and returns the
+// first error, from walkErr or a worker
+func (p *treePipeline) wait(walkErr error) error {
+	close(p.entries)
+	p.workers.Wait()
+	p.cancel()
+	if p.err != nil {
+		return p.err
+	}
+	return walkErr
+}
+
+// copyTree copies the directory op.Source, described by info, to op.Dest. Each
+// directory gets its metadata once all of its contents are written, so
+// read-only directories and their times survive the copy. When merging into
+// an existing op.Dest, the walker resolves the conflicts it meets there.
+func copyTree(op FileOperation, info fs.FileInfo) error {
+	srcFs, dstFs := op.fsys(), op.destFsys()
+	p := startTreePipeline(op, func(ctx context.Context, entry pipelineEntry) error {
+		return op.copyFile(ctx, entry.src, entry.info, entry.dst)
+	})
+
+	// Parents come before their children, so the walker appends them in order
+	var dirs []pipelineEntry
+	var walkDir func(entry pipelineEntry, existing bool) error
+	walkDir = func(entry pipelineEntry, existing bool) error {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		// Owner write access lets the contents be copied in; the mode follows after
+		if err := dstFs.MkdirAll(entry.dst, entry.info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		dirs = append(dirs, entry)
+		op.state.addWork(1, 0)
+
+		children, err := srcFs.ReadDir(entry.src)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			src := filepath.Join(entry.src, child.Name())
+			// Symlinks are recreated as links, like cp -R and mv do, so a
+			// link to a parent cannot send the walk round in circles
+			info, err := srcFs.Lstat(src)
+			if err != nil {
+				return err
+			}
+			next := pipelineEntry{src: src, dst: filepath.Join(entry.dst, child.Name()), info: info}
+			// Only a directory that existed before can hold conflicts
+			merge := false
+			if existing {
+				dstInfo, err := dstFs.Lstat(next.dst)
+				if err == nil {
+					next.dst, merge, err = op.resolveConflict(next.src, info, next.dst, dstInfo)
+					if err != nil {
+						return err
+					}
+					if next.dst == "" {
+						continue
+					}
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+			}
+			if info.IsDir() {
+				err = walkDir(next, merge)
+			} else {
+				var size int64
+				if info.Mode().IsRegular() {
+					size = info.Size()
+				}
+				op.state.addWork(1, size)
+				err = p.send(next)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := p.wait(walkDir(pipelineEntry{src: op.Source, dst: op.Dest, info: info}, op.merge)); err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		op.preserveMetadata(dirs[i].src, dirs[i].info, dirs[i].dst)
+		op.state.addDone(1, 0)
+	}
+	return nil
+}
+
+// removeTree deletes the directory op.Source and everything below it. Workers
+// remove the files while the walker lists the tree; the emptied directories
+// then go deepest first.
+func removeTree(op FileOperation) error {
+	fsys := op.fsys()
+	p := startTreePipeline(op, func(ctx context.Context, entry pipelineEntry) error {
+		if err := fsys.Remove(entry.src); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		op.state.addDone(1, 0)
+		return nil
+	})
+
+	var dirs []string
+	var walkDir func(dir string) error
+	walkDir = func(dir string) error {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		dirs = append(dirs, dir)
+		op.state.addWork(1, 0)
+
+		children, err := fsys.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			path := filepath.Join(dir, child.Name())
+			// Symlinks are removed, not followed
+			if child.IsDir() {
+				err = walkDir(path)
+			} else {
+				op.state.addWork(1, 0)
+				err = p.send(pipelineEntry{src: path})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := p.wait(walkDir(op.Source)); err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := op.canceled(); err != nil {
+			return err
+		}
+		if err := fsys.Remove(dirs[i]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		op.state.addDone(1, 0)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// memTree fills dir of fsys with dirs directories of files files each
+func memTree(t *testing.T, fsys FS, dir string, dirs, files int) (items int, bytes int64) {
+	t.Helper()
+	for d := 0; d < dirs; d++ {
+		sub := filepath.Join(dir, fmt.Sprintf("pkg%02d/lib", d))
+		if err := fsys.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		items += 2
+		for f := 0; f < files; f++ {
+			data := []byte(strings.Repeat("x", d*f))
+			if err := WriteFile(fsys, filepath.Join(sub, fmt.Sprintf("f%d.js", f)), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			items++
+			bytes += int64(len(data))
+		}
+	}
+	return items + 1, bytes // and dir itself
+}
+
+func TestCopyTreeInParallel(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/w/node_modules", 0755); err != nil {
+		t.Fatal(err)
+	}
+	items, bytes := memTree(t, fsys, "/w/node_modules", 20, 30)
+	if err := fsys.Chmod("/w/node_modules/pkg03", 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, parallelism := range []int{1, 4} {
+		t.Run(fmt.Sprint(parallelism), func(t *testing.T) {
+			dst := fmt.Sprintf("/w/copy%d", parallelism)
+			op := memOperation(t, fsys, OpCopy, "/w/node_modules", dst)
+			op.parallelism = parallelism
+			if err := ExecuteFileOperation(op); err != nil {
+				t.Fatal(err)
+			}
+
+			var copied int
+			Walk(fsys, "/w/node_modules", func(path string, info fs.FileInfo, err error) error {
+				target := dst + strings.TrimPrefix(path, "/w/node_modules")
+				copy, err := fsys.Stat(target)
+				if err != nil || copy.Mode() != info.Mode() || copy.Size() != info.Size() {
+					t.Errorf("got %s %v, want %v", target, copy, info.Mode())
+				}
+				copied++
+				return nil
+			})
+			if copied != items {
+				t.Errorf("walked %d items, want %d", copied, items)
+			}
+
+			snapshot := op.state.Snapshot()
+			if snapshot.ItemsDone != items || snapshot.ItemsTotal != items || snapshot.BytesDone != bytes || snapshot.BytesTotal != bytes {
+				t.Errorf("got %d/%d items, %d/%d bytes, want %d items, %d bytes",
+					snapshot.ItemsDone, snapshot.ItemsTotal, snapshot.BytesDone, snapshot.BytesTotal, items, bytes)
+			}
+		})
+	}
+}
+
+func TestCopyTreeStopsAtFirstError(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/w/src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	memTree(t, fsys, "/w/src", 5, 20)
+	if err := fsys.Chmod("/w/src/pkg02/lib/f7.js", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	op := memOperation(t, fsys, OpCopy, "/w/src", "/w/dst")
+	if err := CopyDirWithProgress(op); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected the unreadable file to fail the copy, got %v", err)
+	}
+}
+
+func TestCopyTreeCanceled(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("/w/src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	memTree(t, fsys, "/w/src", 5, 20)
+
+	op := memOperation(t, fsys, OpCopy, "/w/src", "/w/dst")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	op.ctx = ctx
+	if err := CopyDirWithProgress(op); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the copy to be canceled, got %v", err)
+	}
+}
+
+func TestRemoveTreeInParallel(t *testing.T) {
+	dir := t.TempDir()
+	items, _ := memTree(t, OSFS{}, filepath.Join(dir, "node_modules"), 10, 25)
+	// A link to a directory outside the tree goes, but not what it points to
+	outside := filepath.Join(dir, "keep")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "data"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "node_modules/pkg01/shared")); err != nil {
+		t.Fatal(err)
+	}
+	items++
+
+	op := memOperation(t, OSFS{}, OpDelete, filepath.Join(dir, "node_modules"), "")
+	op.parallelism = 4
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "node_modules")); !os.IsNotExist(err) {
+		t.Errorf("expected the tree to be deleted, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "data")); err != nil {
+		t.Errorf("expected the symlink not to be followed: %v", err)
+	}
+	if snapshot := op.state.Snapshot(); snapshot.ItemsDone != items || snapshot.ItemsTotal != items || snapshot.Progress != 100 {
+		t.Errorf("got %d/%d items at %v%%, want %d", snapshot.ItemsDone, snapshot.ItemsTotal, snapshot.Progress, items)
+	}
+}
+
+func TestCopyTreeKeepsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a")
+	if err := os.MkdirAll(filepath.Join(src, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "b/data"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Followed, this link would be copied into itself forever
+	if err := os.Symlink("..", filepath.Join(src, "b/loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "copy")
+	op := NewFileOperation(OpCopy, src, dst, &FileItem{path: src, name: "a", isDir: true})
+	op.fs = OSFS{}
+	if err := ExecuteFileOperation(op); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "b/loop")); err != nil || target != ".." {
+		t.Errorf("expected the link to be copied as a link, got %q, %v", target, err)
+	}
+	if snapshot := op.state.Snapshot(); snapshot.BytesDone != 1 || snapshot.BytesTotal != 1 || snapshot.Progress != 100 {
+		t.Errorf("got %d/%d bytes at %v%%, want only the file counted", snapshot.BytesDone, snapshot.BytesTotal, snapshot.Progress)
+	}
+}
+
+func TestStatusBarShowsWork(t *testing.T) {
+	statusBar := NewStatusBar()
+	statusBar.UpdateOperation(&OperationState{
+		Operation:  FileOperation{Type: OpCopy},
+		Stage:      StageExecuting,
+		RetryCount: 1,
+		ItemsDone:  12,
+		ItemsTotal: 340,
+		BytesDone:  3 << 20,
+		BytesTotal: 10 << 20,
+	})
+	if want := "Executing copy operation (attempt 1/3): 12/340 items, 3.0 MiB of 10.0 MiB"; statusBar.message != want {
+		t.Errorf("got %q, want %q", statusBar.message, want)
+	}
+}
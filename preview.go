@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// previewMaxBytes caps how much of a text file is read and highlighted
+	previewMaxBytes = 64 * 1024
+	// previewHexBytes caps how much of a binary file is shown as a hex dump
+	previewHexBytes = 1024
+	// previewMaxEntries caps how many directory or archive entries are listed
+	previewMaxEntries = 500
+	// previewTabWidth is the number of spaces a tab expands to
+	previewTabWidth = 4
+	// previewSniffBytes is how much of a file is inspected to decide whether it is binary
+	previewSniffBytes = 8 * 1024
+)
+
+// previewStyle is the chroma style used to highlight text files
+var previewStyle = "monokai"
+
+// Preview holds the content shown for the selected item in the preview pane
+type Preview struct {
+	path    string             // item the content belongs to
+	content string             // rendered preview, empty while loading
+	loading bool               // a load for path is in flight
+	cancel  context.CancelFunc // cancels the in-flight load
+}
+
+// previewLoadedMsg carries the rendered preview of path
+type previewLoadedMsg struct {
+	path    string
+	content string
+}
+
+// togglePreview shows or hides the preview pane
+func (m Model) togglePreview() (tea.Model, tea.Cmd) {
+	m.config.Preview = !m.config.Preview
+	if !m.config.Preview {
+		m.preview.stop()
+		m.preview.path = ""
+		return m, nil
+	}
+	return m, m.refreshPreview()
+}
+
+// refreshPreview starts loading the preview of the selected item when it changed,
+// canceling the load of the previously selected item
+func (m Model) refreshPreview() tea.Cmd {
+	if !m.config.Preview || m.preview == nil {
+		return nil
+	}
+	item := m.tree.GetSelectedItem()
+	if item == nil {
+		m.preview.stop()
+		m.preview.path = ""
+		m.preview.content = ""
+		return nil
+	}
+	if item.path == m.preview.path {
+		return nil
+	}
+
+	m.preview.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.preview.path = item.path
+	m.preview.content = ""
+	m.preview.loading = true
+	m.preview.cancel = cancel
+
+	selected, fsys := *item, m.tree.fs
+	return func() tea.Msg {
+		content, err := renderPreview(ctx, fsys, selected)
+		if ctx.Err() != nil {
+			// The cursor moved on; the result is stale and is dropped
+			return nil
+		}
+		if err != nil {
+			content = fmt.Sprintf("Cannot preview: %v", err)
+		}
+		return previewLoadedMsg{path: selected.path, content: content}
+	}
+}
+
+// withPreview refreshes the preview after a handler that may have moved the cursor
+func withPreview(model tea.Model, cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	m, ok := model.(Model)
+	if !ok {
+		return model, cmd
+	}
+	return m, tea.Batch(cmd, m.refreshPreview())
+}
+
+// handlePreviewLoaded stores a finished preview if it is still for the selected item
+func (m Model) handlePreviewLoaded(msg previewLoadedMsg) (tea.Model, tea.Cmd) {
+	if m.preview == nil || msg.path != m.preview.path {
+		return m, nil
+	}
+	m.preview.content = msg.content
+	m.preview.loading = false
+	m.preview.cancel = nil
+	return m, nil
+}
+
+// stop cancels the in-flight load, if any
+func (p *Preview) stop() {
+	if p == nil {
+		return
+	}
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	p.loading = false
+}
+
+// renderPreview renders item according to its type: a listing for directories and
+// archives, metadata for special files, a hex dump for binaries and highlighted text otherwise
+func renderPreview(ctx context.Context, fsys FS, item FileItem) (string, error) {
+	if item.isDir {
+		return previewDirectory(ctx, fsys, item.path)
+	}
+
+	// Stat through symlinks so links preview their target; never open special files,
+	// since reading a pipe or device can block forever
+	info, err := fsys.Stat(item.path)
+	if err != nil {
+		return previewMetadata(fsys, item.path, nil)
+	}
+	if !info.Mode().IsRegular() {
+		return previewMetadata(fsys, item.path, info)
+	}
+
+	mimeType := mimeTypes.DetectFS(fsys, item.path, info)
+	if kind := archiveKind(item.name, mimeType); kind != "" {
+		return previewArchive(ctx, fsys, item.path, kind)
+	}
+	return previewFile(ctx, fsys, item.path, mimeType)
+}
+
+// previewDirectory lists the entries of dir, directories first
+func previewDirectory(ctx context.Context, fsys FS, dir string) (string, error) {
+	items, err := readDirItems(fsys, dir, listOptions{showHidden: true}, 0, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d entries\n\n", len(items))
+	for i, item := range items {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if i == previewMaxEntries {
+			fmt.Fprintf(&b, "… %d more\n", len(items)-i)
+			break
+		}
+		if item.isDir {
+			b.WriteString(directoryStyle.Render(item.name+"/") + "\n")
+		} else {
+			fmt.Fprintf(&b, "%-40s %8s\n", item.name, formatSize(item.size))
+		}
+	}
+	return b.String(), nil
+}
+
+// previewMetadata describes a file that has no previewable content, such as a
+// pipe, socket, device or broken symlink
+func previewMetadata(fsys FS, path string, info fs.FileInfo) (string, error) {
+	var b strings.Builder
+
+	if target, err := fsys.Readlink(path); err == nil {
+		fmt.Fprintf(&b, "Link to:  %s\n", target)
+		if info == nil {
+			b.WriteString("Target does not exist\n")
+			return b.String(), nil
+		}
+	}
+	if info == nil {
+		var err error
+		if info, err = fsys.Lstat(path); err != nil {
+			return "", err
+		}
+	}
+
+	mode := info.Mode()
+	fmt.Fprintf(&b, "Type:     %s\n", fileTypeName(mode))
+	if mimeType := mimeTypes.DetectFS(fsys, path, info); mimeType != "" {
+		fmt.Fprintf(&b, "MIME:     %s\n", mimeType)
+	}
+	fmt.Fprintf(&b, "Mode:     %s\n", mode)
+	fmt.Fprintf(&b, "Size:     %s\n", formatSize(info.Size()))
+	fmt.Fprintf(&b, "Modified: %s\n", info.ModTime().Format("2006-01-02 15:04:05"))
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		fmt.Fprintf(&b, "Owner:    %d:%d\n", st.Uid, st.Gid)
+		fmt.Fprintf(&b, "Inode:    %d\n", st.Ino)
+		if mode&fs.ModeDevice != 0 {
+			rdev := uint64(st.Rdev)
+			fmt.Fprintf(&b, "Device:   %d, %d\n", unix.Major(rdev), unix.Minor(rdev))
+		}
+	}
+	return b.String(), nil
+}
+
+// fileTypeName names the type encoded in mode
+func fileTypeName(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&fs.ModeSymlink != 0:
+		return "symbolic link"
+	case mode&fs.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeCharDevice != 0:
+		return "character device"
+	case mode&fs.ModeDevice != 0:
+		return "block device"
+	case mode.IsRegular():
+		return "regular file"
+	}
+	return "irregular file"
+}
+
+// formatSize renders a byte count in human-readable units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// archiveKind returns the archive format of a file from its MIME type or name,
+// or "" if it is not an archive that can be listed
+func archiveKind(name, mimeType string) string {
+	switch mimeType {
+	case "application/zip":
+		return "zip"
+	case "application/x-tar":
+		return "tar"
+	case "application/x-compressed-tar":
+		return "tar.gz"
+	case "application/x-xz-compressed-tar":
+		return "tar.xz"
+	case "application/x-zstd-compressed-tar":
+		return "tar.zst"
+	}
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar.xz"), strings.HasSuffix(lower, ".txz"):
+		return "tar.xz"
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return "tar.zst"
+	}
+	return ""
+}
+
+// previewArchive lists the entries of a zip or tar archive
+func previewArchive(ctx context.Context, fsys FS, path, kind string) (string, error) {
+	var b strings.Builder
+	count := 0
+	add := func(name string, size int64, mode fs.FileMode) bool {
+		if count == previewMaxEntries {
+			b.WriteString("…\n")
+			return false
+		}
+		count++
+		fmt.Fprintf(&b, "%s %8s  %s\n", mode, formatSize(size), name)
+		return ctx.Err() == nil
+	}
+
+	if kind == "zip" {
+		r, closer, err := openZip(fsys, path)
+		if err != nil {
+			return "", err
+		}
+		defer closer.Close()
+		for _, f := range r.File {
+			if !add(f.Name, int64(f.UncompressedSize64), f.Mode()) {
+				break
+			}
+		}
+		return b.String(), ctx.Err()
+	}
+
+	tr, closer, err := openTar(fsys, path, kind)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !add(hdr.Name, hdr.Size, hdr.FileInfo().Mode()) {
+			break
+		}
+	}
+	return b.String(), ctx.Err()
+}
+
+// previewFile renders the head of a regular file, highlighted if it is text
+func previewFile(ctx context.Context, fsys FS, path, mimeType string) (string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Read in chunks so a cursor move cancels the load of a slow file
+	var buf bytes.Buffer
+	chunk := make([]byte, 16*1024)
+	for buf.Len() < previewMaxBytes {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		n, err := file.Read(chunk[:min(len(chunk), previewMaxBytes-buf.Len())])
+		buf.Write(chunk[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	data := buf.Bytes()
+	if isBinary(data) {
+		return hex.Dump(data[:min(len(data), previewHexBytes)]), nil
+	}
+	return highlight(path, mimeType, data), nil
+}
+
+// isBinary reports whether data looks like binary rather than text: it contains a
+// NUL byte or is not valid UTF-8, ignoring a rune cut off at the end of the sample
+func isBinary(data []byte) bool {
+	sample := data[:min(len(data), previewSniffBytes)]
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size == 1 {
+			return len(sample) >= utf8.UTFMax
+		}
+		sample = sample[size:]
+	}
+	return false
+}
+
+// highlight renders source code with terminal colors, picking the lexer from the
+// file name, then the MIME type, and failing that from the content
+func highlight(path, mimeType string, data []byte) string {
+	source := strings.ReplaceAll(string(data), "\t", strings.Repeat(" ", previewTabWidth))
+
+	lexer := lexers.Match(filepath.Base(path))
+	if lexer == nil && mimeType != "" {
+		lexer = lexers.MatchMimeType(mimeType)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(source)
+	}
+	if lexer == nil {
+		return source
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, source)
+	if err != nil {
+		return source
+	}
+	var b strings.Builder
+	if err := formatters.TTY256.Format(&b, styles.Get(previewStyle), iterator); err != nil {
+		return source
+	}
+	return b.String()
+}
+
+// renderPreviewPane draws the preview of the selected item in a column of the given size
+func (m Model) renderPreviewPane(rows, width int) string {
+	lines := []string{inactiveHeaderStyle.Render("Preview"), ""}
+
+	switch {
+	case m.preview == nil || m.preview.path == "":
+	case m.preview.loading:
+		lines = append(lines, inactiveHeaderStyle.Render("Loading…"))
+	default:
+		content := strings.Split(strings.TrimRight(m.preview.content, "\n"), "\n")
+		lines = append(lines, content[:min(len(content), rows)]...)
+	}
+
+	for len(lines) < rows+treeHeaderLines {
+		lines = append(lines, "")
+	}
+	column := lipgloss.NewStyle().Width(width)
+	for i, line := range lines {
+		lines[i] = column.Render(ansi.Truncate(line, width-1, "…"))
+	}
+	return strings.Join(lines, "\n")
+}
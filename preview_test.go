@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func previewOf(t *testing.T, path string) string {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := FileItem{path: path, name: filepath.Base(path), isDir: info.IsDir(), mode: info.Mode()}
+	content, err := renderPreview(context.Background(), OSFS{}, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestPreviewTextIsHighlighted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := previewOf(t, path)
+	if !strings.Contains(content, "\x1b[") {
+		t.Errorf("expected highlighted output, got %q", content)
+	}
+	if !strings.Contains(content, "func") {
+		t.Errorf("expected the source in the preview, got %q", content)
+	}
+}
+
+func TestPreviewBinaryAsHex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob")
+	if err := os.WriteFile(path, []byte{0x7f, 'E', 'L', 'F', 0, 1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := previewOf(t, path)
+	if !strings.HasPrefix(content, "00000000  7f 45 4c 46 00 01 02") {
+		t.Errorf("expected a hex dump, got %q", content)
+	}
+}
+
+func TestPreviewDirectoryAndArchive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := previewOf(t, dir)
+	if !strings.Contains(content, "2 entries") || !strings.Contains(content, "sub/") || !strings.Contains(content, "file.txt") {
+		t.Errorf("unexpected directory listing %q", content)
+	}
+
+	archive := filepath.Join(dir, "files.tar.gz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "inside.txt", Mode: 0644, Size: 3})
+	tw.Write([]byte("abc"))
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	content = previewOf(t, archive)
+	if !strings.Contains(content, "inside.txt") || !strings.Contains(content, "3 B") {
+		t.Errorf("unexpected archive listing %q", content)
+	}
+}
+
+func TestPreviewSpecialFileShowsMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(path, 0644); err != nil {
+		t.Skip("mkfifo not supported:", err)
+	}
+
+	// Opening the pipe would block, so this also checks it is never read
+	content := previewOf(t, path)
+	if !strings.Contains(content, "named pipe") {
+		t.Errorf("expected pipe metadata, got %q", content)
+	}
+}
+
+func TestPreviewCanceled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := renderPreview(ctx, OSFS{}, FileItem{path: path, name: "file.txt"}); err == nil {
+		t.Error("expected a canceled load to fail")
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte("plain text\n"), false},
+		{[]byte("héllo"), false},
+		{[]byte("cut off \xc3"), false},
+		{[]byte{0xff, 0xfe, 'a', 'b', 'c', 'd'}, true},
+		{[]byte("nul\x00byte"), true},
+	}
+	for _, tt := range tests {
+		if got := isBinary(tt.data); got != tt.want {
+			t.Errorf("isBinary(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewFollowsCursor(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := tabModel(dir)
+	m.config.Preview = true
+	m.preview = &Preview{}
+	m.tree.cursor = 1
+
+	cmd := m.refreshPreview()
+	if cmd == nil || !m.preview.loading {
+		t.Fatal("expected a preview load to start")
+	}
+	stale := cmd()
+
+	// Moving the cursor cancels the first load and drops its result
+	newModel, _ := withPreview(m.handleTreeViewKeys(key("j")))
+	m = newModel.(Model)
+	if stale != nil {
+		newModel, _ = m.Update(stale)
+		m = newModel.(Model)
+	}
+	if m.preview.path != filepath.Join(dir, "b.txt") || m.preview.content != "" {
+		t.Fatalf("stale preview applied: path %q content %q", m.preview.path, m.preview.content)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpScheme prefixes the remote paths modaltree accepts and shows
+const sftpScheme = "sftp://"
+
+// remoteUmask masks the modes of files and directories created remotely, since
+// SFTP creates them with the server's defaults and the FS sets modes explicitly
+const remoteUmask = 022
+
+// sftpDialTimeout bounds connecting and the SSH handshake
+const sftpDialTimeout = 15 * time.Second
+
+// SFTPFS is the FS of a remote host, reached over SFTP. Paths are the
+// absolute paths of the server.
+type SFTPFS struct {
+	client *sftp.Client
+	conn   *ssh.Client   // nil when the client runs over another transport
+	label  string        // user@host[:port], for URLs and the status bar
+	done   chan struct{} // closed once the connection is gone
+	err    error         // why the connection ended, once done is closed
+}
+
+// NewSFTPFS wraps an SFTP client connected to the host label names
+func NewSFTPFS(client *sftp.Client, label string) *SFTPFS {
+	s := &SFTPFS{client: client, label: label, done: make(chan struct{})}
+	go func() {
+		s.err = client.Wait()
+		close(s.done)
+	}()
+	return s
+}
+
+// Close disconnects from the server
+func (s *SFTPFS) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+// Label returns the user@host the FS is connected to
+func (s *SFTPFS) Label() string { return s.label }
+
+// URL returns the sftp:// URL of name on the server
+func (s *SFTPFS) URL(name string) string { return sftpScheme + s.label + name }
+
+// Connected reports whether the connection is still up
+func (s *SFTPFS) Connected() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// connectionLostMsg reports that the connection of a remote tree dropped
+type connectionLostMsg struct {
+	fs  *SFTPFS
+	err error
+}
+
+// watchConnection waits for the connection of fsys to drop
+func watchConnection(fsys FS) tea.Cmd {
+	s, ok := fsys.(*SFTPFS)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		<-s.done
+		return connectionLostMsg{fs: s, err: s.err}
+	}
+}
+
+// isRemote reports whether fsys lives on another host, where local programs cannot open its files
+func isRemote(fsys FS) bool {
+	_, ok := fsys.(*SFTPFS)
+	return ok
+}
+
+// location returns how a path of fsys is shown and typed: a URL for remote
+// filesystems, the plain path otherwise
+func location(fsys FS, name string) string {
+	if s, ok := fsys.(*SFTPFS); ok {
+		return s.URL(name)
+	}
+	return name
+}
+
+// sftpError attaches the operation and path to errors the client returns bare
+func sftpError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	if err == nil || errors.As(err, &pathErr) || errors.As(err, &linkErr) {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (s *SFTPFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.client.Stat(name)
+	return info, sftpError("stat", name, err)
+}
+
+func (s *SFTPFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := s.client.Lstat(name)
+	return info, sftpError("lstat", name, err)
+}
+
+func (s *SFTPFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.client.ReadDir(name)
+	if err != nil {
+		return nil, sftpError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *SFTPFS) Readlink(name string) (string, error) {
+	target, err := s.client.ReadLink(name)
+	return target, sftpError("readlink", name, err)
+}
+
+func (s *SFTPFS) Open(name string) (File, error) {
+	f, err := s.client.Open(name)
+	if err != nil {
+		return nil, sftpError("open", name, err)
+	}
+	return f, nil
+}
+
+func (s *SFTPFS) Create(name string, perm fs.FileMode) (File, error) {
+	_, statErr := s.client.Lstat(name)
+	f, err := s.client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, sftpError("open", name, err)
+	}
+	// Like open(2), perm only applies to a new file
+	if errors.Is(statErr, fs.ErrNotExist) {
+		if err := f.Chmod(perm &^ remoteUmask); err != nil {
+			f.Close()
+			return nil, sftpError("chmod", name, err)
+		}
+	}
+	return f, nil
+}
+
+func (s *SFTPFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := s.client.Mkdir(name); err != nil {
+		// Servers report most failures as a generic one, so tell an existing name apart
+		if _, statErr := s.client.Lstat(name); statErr == nil {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		return sftpError("mkdir", name, err)
+	}
+	return sftpError("chmod", name, s.client.Chmod(name, perm&^remoteUmask))
+}
+
+func (s *SFTPFS) MkdirAll(name string, perm fs.FileMode) error {
+	if info, err := s.Stat(name); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	if parent := path.Dir(name); parent != name {
+		if err := s.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := s.Mkdir(name, perm); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *SFTPFS) Rename(oldpath, newpath string) error {
+	// Plain SFTP rename refuses to replace newpath, unlike rename(2)
+	var err error
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		err = s.client.PosixRename(oldpath, newpath)
+	} else {
+		err = s.client.Rename(oldpath, newpath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: unwrapSFTP(err)}
+	}
+	return nil
+}
+
+func (s *SFTPFS) Remove(name string) error {
+	err := s.client.Remove(name)
+	if err == nil {
+		return nil
+	}
+	if info, statErr := s.client.Lstat(name); statErr == nil && info.IsDir() {
+		if entries, _ := s.client.ReadDir(name); len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	return sftpError("remove", name, err)
+}
+
+func (s *SFTPFS) RemoveAll(name string) error {
+	info, err := s.client.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return sftpError("lstat", name, err)
+	}
+	if info.IsDir() {
+		entries, err := s.client.ReadDir(name)
+		if err != nil {
+			return sftpError("readdir", name, err)
+		}
+		for _, entry := range entries {
+			if err := s.RemoveAll(path.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return s.Remove(name)
+}
+
+func (s *SFTPFS) Chmod(name string, mode fs.FileMode) error {
+	return sftpError("chmod", name, s.client.Chmod(name, mode))
+}
+
+func (s *SFTPFS) Chtimes(name string, atime, mtime time.Time) error {
+	return sftpError("chtimes", name, s.client.Chtimes(name, atime, mtime))
+}
+
+func (s *SFTPFS) Symlink(oldname, newname string) error {
+	if err := s.client.Symlink(oldname, newname); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: unwrapSFTP(err)}
+	}
+	return nil
+}
+
+// Lchown sets the owner SFTP reports. Servers follow symlinks, but copies are
+// never symlinks.
+func (s *SFTPFS) Lchown(name string, uid, gid int) error {
+	return sftpError("chown", name, s.client.Chown(name, uid, gid))
+}
+
+// Access checks the owner bits of the mode, since SFTP cannot ask the server
+// what the connected user may do. The server still enforces the real permissions.
+func (s *SFTPFS) Access(name string, mode uint32) error {
+	info, err := s.Stat(name)
+	if err != nil {
+		return err
+	}
+	perm := uint32(info.Mode().Perm() >> 6)
+	if mode&^perm != 0 {
+		return &fs.PathError{Op: "access", Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// unwrapSFTP returns the cause of a client error, which may carry its own path
+func unwrapSFTP(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// SFTPOptions configures how DialSFTP authenticates the server and the user.
+// Empty fields take the OpenSSH defaults.
+type SFTPOptions struct {
+	KnownHosts  string   // known_hosts file; ~/.ssh/known_hosts by default
+	KeyFiles    []string // private keys to try after the agent; ~/.ssh/id_* by default
+	AgentSocket string   // ssh-agent socket; $SSH_AUTH_SOCK by default
+}
+
+// withDefaults fills in the empty fields of o
+func (o SFTPOptions) withDefaults() SFTPOptions {
+	home, _ := os.UserHomeDir()
+	if o.KnownHosts == "" {
+		o.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	if o.KeyFiles == nil {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			o.KeyFiles = append(o.KeyFiles, filepath.Join(home, ".ssh", name))
+		}
+	}
+	if o.AgentSocket == "" {
+		o.AgentSocket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	return o
+}
+
+// SFTPTarget is what an sftp:// URL names
+type SFTPTarget struct {
+	User string
+	Host string // host:port
+	Path string // empty for the login directory
+}
+
+// Label returns user@host, with the port only when it is not the default
+func (t SFTPTarget) Label() string {
+	host := t.Host
+	if h, port, err := net.SplitHostPort(host); err == nil && port == "22" {
+		host = h
+		if strings.Contains(h, ":") {
+			host = "[" + h + "]"
+		}
+	}
+	return t.User + "@" + host
+}
+
+// ParseSFTPURL parses sftp://[user@]host[:port][/path]. The user defaults
+// to the local one and the port to 22.
+func ParseSFTPURL(raw string) (SFTPTarget, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return SFTPTarget{}, err
+	}
+	if u.Scheme != "sftp" || u.Hostname() == "" {
+		return SFTPTarget{}, fmt.Errorf("%s: expected sftp://[user@]host[:port]/path", raw)
+	}
+	if _, set := u.User.Password(); set {
+		return SFTPTarget{}, fmt.Errorf("%s: passwords are not supported; use ssh-agent or a key", raw)
+	}
+
+	t := SFTPTarget{User: u.User.Username(), Path: u.Path}
+	if t.User == "" {
+		current, err := user.Current()
+		if err != nil {
+			return SFTPTarget{}, fmt.Errorf("%s: no user given: %w", raw, err)
+		}
+		t.User = current.Username
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	t.Host = net.JoinHostPort(u.Hostname(), port)
+	return t, nil
+}
+
+// DialSFTP connects to the server raw names, authenticating it against
+// known_hosts and the user with ssh-agent or a private key. It returns the
+// FS and the absolute path the URL names, the login directory when it has none.
+func DialSFTP(raw string, opts SFTPOptions) (*SFTPFS, string, error) {
+	target, err := ParseSFTPURL(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	opts = opts.withDefaults()
+
+	config, err := sshClientConfig(target, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	conn, err := ssh.Dial("tcp", target.Host, config)
+	if err != nil {
+		return nil, "", fmt.Errorf("connecting to %s: %w", target.Label(), err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("starting SFTP on %s: %w", target.Label(), err)
+	}
+
+	s := NewSFTPFS(client, target.Label())
+	s.conn = conn
+	dir, err := s.resolve(target.Path)
+	if err != nil {
+		s.Close()
+		return nil, "", err
+	}
+	return s, dir, nil
+}
+
+// resolve makes name absolute on the server, relative to the login directory
+func (s *SFTPFS) resolve(name string) (string, error) {
+	if path.IsAbs(name) {
+		return path.Clean(name), nil
+	}
+	home, err := s.client.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("finding the login directory on %s: %w", s.label, err)
+	}
+	return path.Join(home, name), nil
+}
+
+// sshClientConfig authenticates target with the agent and keys of opts,
+// accepting only host keys listed in the known_hosts file
+func sshClientConfig(target SFTPTarget, opts SFTPOptions) (*ssh.ClientConfig, error) {
+	hostKeys, err := knownhosts.New(opts.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if opts.AgentSocket != "" {
+		if conn, err := net.Dial("unix", opts.AgentSocket); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range opts.KeyFiles {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		// Keys with a passphrase are only used through the agent
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no SSH credentials for %s: start ssh-agent or create a key without a passphrase", target.Label())
+	}
+
+	return &ssh.ClientConfig{
+		User:              target.User,
+		Auth:              auth,
+		HostKeyCallback:   verifyHostKey(hostKeys, opts.KnownHosts),
+		HostKeyAlgorithms: knownHostAlgorithms(hostKeys, target.Host),
+		Timeout:           sftpDialTimeout,
+	}, nil
+}
+
+// verifyHostKey explains why known_hosts rejected a host key
+func verifyHostKey(hostKeys ssh.HostKeyCallback, file string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeys(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) == 0 {
+			return fmt.Errorf("%s is not in %s (key %s); connect once with ssh to verify and add it", hostname, file, fingerprint)
+		}
+		return fmt.Errorf("host key of %s does not match %s:%d (got %s); it may have been replaced or the connection intercepted",
+			hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line, fingerprint)
+	}
+}
+
+// knownHostAlgorithms returns the key types known_hosts lists for host, so the
+// server is asked for a key that can be verified rather than its preferred one
+func knownHostAlgorithms(hostKeys ssh.HostKeyCallback, host string) []string {
+	_, probe, _ := ed25519.GenerateKey(nil)
+	signer, err := ssh.NewSignerFromKey(probe)
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if err := hostKeys(host, &net.TCPAddr{}, signer.PublicKey()); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch keyType := known.Key.Type(); keyType {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, keyType)
+		default:
+			algorithms = append(algorithms, keyType)
+		}
+	}
+	return algorithms
+}
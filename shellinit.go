@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// lastDirEnv names the environment variable that can carry the per-session lastdir file
+const lastDirEnv = "MODALTREE_LASTDIR"
+
+// shellWrappers define a function that runs modaltree with a fresh temp file and
+// changes to the directory written there on quit-and-cd. Each session gets its own
+// file, so concurrent sessions and users never share one.
+var shellWrappers = map[string]string{
+	"bash": posixWrapper,
+	"zsh":  posixWrapper,
+	"fish": `function {{.Name}} --description 'modaltree, changing directory on quit-and-cd'
+    set -l tmp (mktemp -t modaltree.XXXXXX); or return
+    command modaltree --lastdir-file $tmp $argv
+    set -l ret $status
+    set -l dir (cat -- $tmp)
+    rm -f -- $tmp
+    if test -n "$dir" -a -d "$dir" -a "$dir" != "$PWD"
+        cd -- $dir
+    end
+    return $ret
+end
+`,
+	"nushell": `def --env --wrapped {{.Name}} [...args] {
+    let tmp = (mktemp -t modaltree.XXXXXX)
+    ^modaltree --lastdir-file $tmp ...$args
+    let dir = (open --raw $tmp | str trim)
+    rm -f $tmp
+    if ($dir != "" and ($dir | path exists) and $dir != $env.PWD) {
+        cd $dir
+    }
+}
+`,
+	"powershell": `function {{.Name}} {
+    $tmp = [System.IO.Path]::GetTempFileName()
+    & modaltree --lastdir-file $tmp @args
+    $ret = $LASTEXITCODE
+    $dir = Get-Content -Raw -LiteralPath $tmp -ErrorAction SilentlyContinue
+    Remove-Item -Force -LiteralPath $tmp -ErrorAction SilentlyContinue
+    if ($dir -and (Test-Path -LiteralPath $dir -PathType Container) -and $dir -ne $PWD.Path) {
+        Set-Location -LiteralPath $dir
+    }
+    $global:LASTEXITCODE = $ret
+}
+`,
+}
+
+// posixWrapper is shared by bash and zsh; zsh reserves $status, hence $ret
+const posixWrapper = `{{.Name}}() {
+    local tmp dir ret
+    tmp="$(mktemp -t modaltree.XXXXXX)" || return
+    command modaltree --lastdir-file "$tmp" "$@"
+    ret=$?
+    dir="$(cat -- "$tmp")"
+    rm -f -- "$tmp"
+    if [ -n "$dir" ] && [ -d "$dir" ] && [ "$dir" != "$PWD" ]; then
+        cd -- "$dir" || return
+    fi
+    return $ret
+}
+`
+
+// shellNames lists the supported shells in a stable order
+func shellNames() []string {
+	names := make([]string, 0, len(shellWrappers))
+	for name := range shellWrappers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// functionName matches the names the wrapper can be given. The name is pasted
+// into shell source, so anything else could run as code.
+var functionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// ShellWrapper returns the wrapper function for shell, named name
+func ShellWrapper(shell, name string) (string, error) {
+	wrapper, ok := shellWrappers[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q: must be one of %s", shell, strings.Join(shellNames(), ", "))
+	}
+	if !functionName.MatchString(name) {
+		return "", fmt.Errorf("invalid function name %q: use letters, digits, _ and -, not starting with a digit or -", name)
+	}
+	var b strings.Builder
+	tmpl := template.Must(template.New(shell).Parse(wrapper))
+	if err := tmpl.Execute(&b, struct{ Name string }{name}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// newInitFlagSet defines the flags of "modaltree init", storing the function name in name
+func newInitFlagSet(name *string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(name, "cmd", "mt", "Name of the shell function to define")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: modaltree init [--cmd name] <%s>\n\n", strings.Join(shellNames(), "|"))
+		fmt.Fprintf(stderr, "Prints a shell function that runs modaltree and changes to its current\n")
+		fmt.Fprintf(stderr, "directory when you quit with the quit-and-cd key. For example, in ~/.bashrc:\n\n")
+		fmt.Fprintf(stderr, "    eval \"$(modaltree init bash)\"\n\n")
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// runInit implements "modaltree init <shell>", printing the shell wrapper, and returns the exit code
+func runInit(args []string, stdout, stderr io.Writer) int {
+	var name string
+	flags := newInitFlagSet(&name, stderr)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	wrapper, err := ShellWrapper(flags.Arg(0), name)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	fmt.Fprint(stdout, wrapper)
+	return 0
+}
+
+// quitAndChangeDirectory writes the current directory for the shell wrapper and quits
+func (m Model) quitAndChangeDirectory() (tea.Model, tea.Cmd) {
+	if isRemote(m.tree.fs) {
+		m.statusBar.setMessage("Cannot cd on quit: the directory is on a remote host", MessageError)
+		return m, nil
+	}
+	m.config.CurrentDir = m.tree.root
+	if err := ChangeShellDirectory(m.config.LastDirFile, m.config.CurrentDir); err != nil {
+		m.statusBar.setMessage(fmt.Sprintf("Cannot cd on quit: %v", err), MessageError)
+		return m, nil
+	}
+	return m, tea.Quit
+}
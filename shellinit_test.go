@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellWrappers(t *testing.T) {
+	for _, shell := range shellNames() {
+		wrapper, err := ShellWrapper(shell, "ft")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(wrapper, "ft") || !strings.Contains(wrapper, "--lastdir-file") {
+			t.Errorf("%s wrapper does not define ft or pass the lastdir file:\n%s", shell, wrapper)
+		}
+	}
+	if _, err := ShellWrapper("tcsh", "mt"); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
+
+func TestBashWrapperChangesDirectory(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	target := t.TempDir()
+
+	// A fake modaltree writes the target to the lastdir file like quit-and-cd would
+	bin := t.TempDir()
+	fake := "#!/bin/sh\n[ \"$1\" = --lastdir-file ] && printf %s '" + target + "' > \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "modaltree"), []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	wrapper, _ := ShellWrapper("bash", "mt")
+	cmd := exec.Command("bash", "-c", wrapper+"\nmt && pwd")
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != target {
+		t.Errorf("got directory %q, want %q", got, target)
+	}
+}
+
+func TestRunInit(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runInit([]string{"--cmd", "tree", "zsh"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "tree() {") {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runInit(nil, &stdout, &stderr); code != 2 || stdout.Len() != 0 {
+		t.Errorf("expected usage error without a shell, got code %d", code)
+	}
+
+	// The name ends up in shell source
+	for _, name := range []string{"x; rm -rf ~", "$(id)", "1mt", "-mt", ""} {
+		stdout.Reset()
+		if code := runInit([]string{"--cmd", name, "bash"}, &stdout, &stderr); code != 2 || stdout.Len() != 0 {
+			t.Errorf("--cmd %q: got code %d and %q, want a usage error", name, code, stdout.String())
+		}
+	}
+}
+
+func TestQuitAndChangeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	lastDir := filepath.Join(t.TempDir(), "lastdir")
+	m := tabModel(dir)
+	m.keys = DefaultKeyMap()
+
+	// Without the wrapper the key reports the missing setup instead of quitting
+	if _, cmd := m.handleTreeViewKeys(key("Q")); cmd != nil {
+		t.Error("expected no quit without a lastdir file")
+	}
+
+	m.config.LastDirFile = lastDir
+	if _, cmd := m.handleTreeViewKeys(key("Q")); cmd == nil {
+		t.Fatal("expected quit-and-cd to quit")
+	}
+	data, err := os.ReadFile(lastDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != dir {
+		t.Errorf("got %q, want %q", data, dir)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build unix && !darwin && !freebsd && !netbsd
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// statAtime returns the access time of st
+func statAtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+}
@@ -19,6 +19,7 @@ type StatusBar struct {
 	isActive    bool
 	spinner     spinner.Model
 	isCanceling bool
+	remote      *SFTPFS // host the active tree is on, nil for a local tree
 }
 
 // MessageType defines the type of message being displayed in the status bar
@@ -29,6 +30,7 @@ const (
 	MessageNormal MessageType = iota
 	MessageError
 	MessageSuccess
+	MessageWarning
 )
 
 // Style definitions for the status bar and its elements
@@ -51,6 +53,10 @@ var (
 	// successMessageStyle defines the style for success messages
 	successMessageStyle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("2"))
+
+	// warningMessageStyle defines the style for warnings
+	warningMessageStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("3"))
 )
 
 // stage descriptions for different operation stages
@@ -75,6 +81,10 @@ func (s *StatusBar) SetCanceling(canceling bool) {
 // View renders the status bar component
 func (s StatusBar) View() string {
 	var content string
+	path := s.currentPath
+	if s.remote != nil {
+		path = s.connectionStatus() + " " + path
+	}
 	if s.isActive && s.operation != nil {
 		stageText := stageDescriptions[s.operation.Stage]
 		if s.isCanceling {
@@ -88,7 +98,7 @@ func (s StatusBar) View() string {
 	
 		content = lipgloss.JoinHorizontal(
 			lipgloss.Left,
-			s.currentPath,
+			path,
 			" | ",
 			progressBar,
 			" | ",
@@ -97,7 +107,7 @@ func (s StatusBar) View() string {
 	} else {
 		content = lipgloss.JoinHorizontal(
 			lipgloss.Left,
-			s.currentPath,
+			path,
 			" | ",
 			s.getMessageWithStyle(),
 		)
@@ -141,9 +151,24 @@ func (s *StatusBar) UpdateOperation(op *OperationState) {
 			getOperationName(op.Operation.Type), 
 			op.RetryCount, 
 			MaxRetries)
+		if op.ItemsTotal > 0 {
+			msg += ": " + describeWork(op)
+		}
+		if op.Conflict != nil {
+			msg = fmt.Sprintf("Waiting: %s already exists", op.Conflict.Dest)
+		}
 		s.setMessage(msg, MessageNormal)
 	case StageCompleted:
-		s.setMessage("Operation completed successfully", MessageSuccess)
+		switch {
+		case len(op.Unpreserved) > 0:
+			s.setMessage("Operation completed, but "+describeUnpreserved(op.Unpreserved), MessageError)
+		case op.Skipped == 1:
+			s.setMessage("Operation completed, skipped 1 item that already existed", MessageSuccess)
+		case op.Skipped > 1:
+			s.setMessage(fmt.Sprintf("Operation completed, skipped %d items that already existed", op.Skipped), MessageSuccess)
+		default:
+			s.setMessage("Operation completed successfully", MessageSuccess)
+		}
 	case StageFailed:
 		s.setMessage(fmt.Sprintf("Operation failed: %v", op.LastError), MessageError)
 	case StageRestored:
@@ -169,6 +194,28 @@ func (s *StatusBar) UpdatePath(path string) {
 	s.currentPath = path
 }
 
+// UpdateConnection shows the connection of fsys when it is remote
+func (s *StatusBar) UpdateConnection(fsys FS) {
+	s.remote, _ = fsys.(*SFTPFS)
+}
+
+// connectionStatus renders the host of the active tree and whether it is still connected
+func (s StatusBar) connectionStatus() string {
+	if s.remote.Connected() {
+		return successMessageStyle.Render("● " + s.remote.Label())
+	}
+	return errorMessageStyle.Render("○ " + s.remote.Label() + " disconnected")
+}
+
+// describeWork summarizes the items and data a running operation has handled
+func describeWork(op *OperationState) string {
+	work := fmt.Sprintf("%d/%d items", op.ItemsDone, op.ItemsTotal)
+	if op.BytesTotal > 0 {
+		work += fmt.Sprintf(", %s of %s", formatSize(op.BytesDone), formatSize(op.BytesTotal))
+	}
+	return work
+}
+
 // getOperationName returns a human-readable operation name
 func getOperationName(opType OperationType) string {
 	switch opType {
@@ -180,6 +227,10 @@ func getOperationName(opType OperationType) string {
 		return "delete"
 	case OpRename:
 		return "rename"
+	case OpCompress:
+		return "compress"
+	case OpExtract:
+		return "extract"
 	default:
 		return "unknown"
 	}
@@ -192,6 +243,8 @@ func (s StatusBar) getMessageWithStyle() string {
         return errorMessageStyle.Render(s.message)
     case MessageSuccess:
         return successMessageStyle.Render(s.message)
+    case MessageWarning:
+        return warningMessageStyle.Render(s.message)
     default:
         return normalMessageStyle.Render(s.message)
     }
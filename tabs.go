@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Styles for the tab bar
+var (
+	tabStyle       = lipgloss.NewStyle().Padding(0, 1).Faint(true)
+	activeTabStyle = lipgloss.NewStyle().Padding(0, 1).Reverse(true)
+)
+
+// Tab is an independent tree session. Each tab keeps its own panes, and each
+// pane its own root, expansion, filter, sort and cursor state.
+type Tab struct {
+	panes      [2]*FileTree
+	activePane int
+	dualPane   bool
+}
+
+// saveTab copies the session state of the model into the active tab
+func (m Model) saveTab() Model {
+	if len(m.tabs) == 0 {
+		m.tabs = []*Tab{{}}
+		m.activeTab = 0
+	}
+	tab := m.tabs[m.activeTab]
+	tab.panes = m.panes
+	tab.activePane = m.activePane
+	tab.dualPane = m.dualPane
+	return m
+}
+
+// loadTab makes tab i the active session
+func (m Model) loadTab(i int) Model {
+	tab := m.tabs[i]
+	m.activeTab = i
+	m.panes = tab.panes
+	m.activePane = tab.activePane
+	m.dualPane = tab.dualPane
+	m.tree = m.panes[m.activePane]
+	m.config.CurrentDir = m.tree.root
+	m.statusBar.UpdatePath(m.tree.root)
+	m.statusBar.UpdateConnection(m.tree.fs)
+	return m
+}
+
+// switchTab saves the active tab and activates tab i
+func (m Model) switchTab(i int) (tea.Model, tea.Cmd) {
+	m = m.saveTab()
+	if i < 0 || i >= len(m.tabs) || i == m.activeTab {
+		return m, nil
+	}
+	return m.loadTab(i), nil
+}
+
+// openTab opens a new tab rooted at dir right after the active one
+func (m Model) openTab(dir string) (tea.Model, tea.Cmd) {
+	m = m.saveTab()
+
+	tree := NewFileTree(dir)
+	tree.fs = m.tree.fs
+	tree.showHidden = m.tree.showHidden
+	tree.sortBy = m.tree.sortBy
+	tab := &Tab{panes: [2]*FileTree{tree, NewFileTree("")}}
+
+	i := m.activeTab + 1
+	m.tabs = append(m.tabs[:i], append([]*Tab{tab}, m.tabs[i:]...)...)
+	m = m.loadTab(i)
+	return m, tree.LoadDirectory(dir)
+}
+
+// openSelectedInTab opens the directory under the cursor in a new tab
+func (m Model) openSelectedInTab() (tea.Model, tea.Cmd) {
+	item := m.tree.GetSelectedItem()
+	if item == nil || !item.isDir {
+		m.statusBar.setMessage("Select a directory to open in a new tab", MessageError)
+		return m, nil
+	}
+	return m.openTab(item.path)
+}
+
+// closeTab closes the active tab; the last tab cannot be closed
+func (m Model) closeTab() (tea.Model, tea.Cmd) {
+	if len(m.tabs) <= 1 {
+		m.statusBar.setMessage("Cannot close the last tab", MessageError)
+		return m, nil
+	}
+
+	i := m.activeTab
+	m.tabs = append(m.tabs[:i:i], m.tabs[i+1:]...)
+	return m.loadTab(min(i, len(m.tabs)-1)), nil
+}
+
+// moveTab moves the active tab delta positions, keeping it active
+func (m Model) moveTab(delta int) (tea.Model, tea.Cmd) {
+	m = m.saveTab()
+	j := m.activeTab + delta
+	if j < 0 || j >= len(m.tabs) {
+		return m, nil
+	}
+	m.tabs[m.activeTab], m.tabs[j] = m.tabs[j], m.tabs[m.activeTab]
+	m.activeTab = j
+	return m, nil
+}
+
+// cycleTab activates the next (delta 1) or previous (delta -1) tab, wrapping around
+func (m Model) cycleTab(delta int) (tea.Model, tea.Cmd) {
+	if len(m.tabs) <= 1 {
+		return m, nil
+	}
+	return m.switchTab((m.activeTab + delta + len(m.tabs)) % len(m.tabs))
+}
+
+// jumpToTab activates the tab matching the position of key among the jump bindings,
+// so that the first bound key selects tab 1, the second tab 2 and so on
+func (m Model) jumpToTab(key string) (tea.Model, tea.Cmd) {
+	for _, binding := range m.keys.Bindings(TreeView) {
+		if binding.Action != ActionJumpTab {
+			continue
+		}
+		for i, k := range binding.Keys {
+			if k == key {
+				return m.switchTab(i)
+			}
+		}
+	}
+	return m, nil
+}
+
+// tabBarLines is the height of the tab bar, which is only shown with more than one tab
+func (m Model) tabBarLines() int {
+	if len(m.tabs) > 1 {
+		return 1
+	}
+	return 0
+}
+
+// tabLabels returns the rendered label of each tab, named after its active directory
+func (m Model) tabLabels() []string {
+	labels := make([]string, len(m.tabs))
+	for i, tab := range m.tabs {
+		root := tab.panes[tab.activePane].root
+		if i == m.activeTab {
+			// The active tab is only saved on switch, so read the live tree
+			root = m.tree.root
+		}
+
+		name := filepath.Base(root)
+		label := fmt.Sprintf("%d:%s", i+1, name)
+		if i == m.activeTab {
+			labels[i] = activeTabStyle.Render(label)
+		} else {
+			labels[i] = tabStyle.Render(label)
+		}
+	}
+	return labels
+}
+
+// renderTabBar draws the tab bar
+func (m Model) renderTabBar() string {
+	return strings.Join(m.tabLabels(), "")
+}
+
+// tabAt returns the index of the tab drawn at column x of the tab bar, or -1
+func (m Model) tabAt(x int) int {
+	start := 0
+	for i, label := range m.tabLabels() {
+		width := lipgloss.Width(label)
+		if x >= start && x < start+width {
+			return i
+		}
+		start += width
+	}
+	return -1
+}
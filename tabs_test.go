@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tabModel builds a single-tab model rooted at dir with its items loaded
+func tabModel(dir string) Model {
+	tree := NewFileTree(dir)
+	tree.items = tree.LoadDirectory(dir)().(loadedDirectoryMsg).items
+	panes := [2]*FileTree{tree, NewFileTree("")}
+	return Model{
+		config:     Config{CurrentDir: dir},
+		tree:       tree,
+		panes:      panes,
+		tabs:       []*Tab{{panes: panes}},
+		activeView: TreeView,
+		statusBar:  NewStatusBar(),
+	}
+}
+
+func TestOpenSelectedInTab(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := tabModel(root)
+	m.tree.cursor = 1 // skip ".."
+
+	newModel, cmd := m.handleTreeViewKeys(key("O"))
+	m = newModel.(Model)
+	if len(m.tabs) != 2 || m.activeTab != 1 {
+		t.Fatalf("got %d tabs with tab %d active, want 2 with tab 1 active", len(m.tabs), m.activeTab)
+	}
+	if m.tree.root != sub || m.config.CurrentDir != sub {
+		t.Errorf("got root %q, want %q", m.tree.root, sub)
+	}
+	if cmd == nil {
+		t.Error("expected a command to load the new tab")
+	}
+}
+
+func TestTabsKeepIndependentState(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := tabModel(root)
+	m.tree.cursor = 2
+	first := m.tree
+
+	newModel, _ := m.openTab(root)
+	m = newModel.(Model)
+	if m.tree == first {
+		t.Fatal("expected the new tab to have its own tree")
+	}
+	m.tree.sortBy = SortSize
+
+	newModel, _ = m.cycleTab(1)
+	m = newModel.(Model)
+	if m.activeTab != 0 || m.tree != first {
+		t.Fatal("expected cycling to wrap back to the first tab")
+	}
+	if m.tree.cursor != 2 || m.tree.sortBy != SortName {
+		t.Errorf("first tab lost its state: cursor %d, sort %v", m.tree.cursor, m.tree.sortBy)
+	}
+}
+
+func TestMoveJumpAndCloseTab(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	m := tabModel(a)
+	newModel, _ := m.openTab(b)
+	m = newModel.(Model)
+
+	newModel, _ = m.handleTreeViewKeys(key("{"))
+	m = newModel.(Model)
+	if m.activeTab != 0 || m.tabs[0].panes[0].root != b {
+		t.Fatalf("expected tab %q to move to the front", b)
+	}
+
+	newModel, _ = m.handleTreeViewKeys(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("2"), Alt: true})
+	m = newModel.(Model)
+	if m.activeTab != 1 || m.tree.root != a {
+		t.Fatalf("expected alt+2 to activate %q, got tab %d at %q", a, m.activeTab, m.tree.root)
+	}
+
+	newModel, _ = m.closeTab()
+	m = newModel.(Model)
+	if len(m.tabs) != 1 || m.tree.root != b {
+		t.Fatalf("expected closing to leave only %q", b)
+	}
+	newModel, _ = m.closeTab()
+	if len(newModel.(Model).tabs) != 1 {
+		t.Error("expected the last tab to stay open")
+	}
+}
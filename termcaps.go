@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
+)
+
+// Icon modes accepted by --icons and DisplayConfig.Icons
+const (
+	IconsAuto    = "auto"
+	IconsNerd    = "nerd"
+	IconsUnicode = "unicode"
+	IconsASCII   = "ascii"
+)
+
+const (
+	nerdProbeGlyph    = "\uf74a" // folder icon from the Nerd Font private use area
+	unicodeProbeGlyph = "▸"
+	probeTimeout      = 250 * time.Millisecond
+	cacheDir          = "modaltree"
+	termCapsFile      = "termcaps.yaml"
+)
+
+var errProbeTimeout = errors.New("terminal did not answer cursor position request")
+
+// TermCaps records which kinds of glyphs a terminal was measured to render at single width
+type TermCaps struct {
+	NerdFont bool `yaml:"nerdfont"`
+	Unicode  bool `yaml:"unicode"`
+}
+
+// validIconMode reports whether mode is one of the accepted icon modes
+func validIconMode(mode string) bool {
+	switch mode {
+	case IconsAuto, IconsNerd, IconsUnicode, IconsASCII:
+		return true
+	}
+	return false
+}
+
+// resolveIconMode turns a requested icon mode into a concrete one using the
+// fallback chain nerd -> unicode -> ascii when the request is auto
+func resolveIconMode(requested string, caps TermCaps) string {
+	switch requested {
+	case IconsNerd, IconsUnicode, IconsASCII:
+		return requested
+	}
+
+	switch {
+	case caps.NerdFont:
+		return IconsNerd
+	case caps.Unicode:
+		return IconsUnicode
+	default:
+		return IconsASCII
+	}
+}
+
+// DetectTermCaps returns the capabilities of the controlling terminal. The
+// terminal is probed on first use and the result is cached per terminal type.
+func DetectTermCaps() TermCaps {
+	if caps, ok := CachedTermCaps(); ok {
+		return caps
+	}
+
+	caps, err := probeTermCaps()
+	if err != nil {
+		// Without a measurement, only trust the locale
+		return TermCaps{Unicode: isUTF8Locale()}
+	}
+
+	cache := loadTermCapsCache()
+	cache[terminalKey()] = caps
+	_ = saveTermCapsCache(cache) // a failed cache write only costs a re-probe next time
+
+	return caps
+}
+
+// CachedTermCaps returns the previously measured capabilities of this terminal type, if any
+func CachedTermCaps() (TermCaps, bool) {
+	caps, ok := loadTermCapsCache()[terminalKey()]
+	return caps, ok
+}
+
+// terminalKey identifies the terminal for caching purposes
+func terminalKey() string {
+	parts := []string{os.Getenv("TERM")}
+	for _, name := range []string{"TERM_PROGRAM", "TERM_PROGRAM_VERSION"} {
+		if value := os.Getenv(name); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// isUTF8Locale reports whether the effective locale uses UTF-8 encoding
+func isUTF8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			value = strings.ToLower(value)
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	return false
+}
+
+// probeTermCaps writes test glyphs to the terminal and asks it where the cursor
+// ended up (DSR, ESC[6n) to measure how wide each glyph was actually rendered
+func probeTermCaps() (TermCaps, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return TermCaps{}, err
+	}
+	defer tty.Close()
+
+	state, err := term.MakeRaw(tty.Fd())
+	if err != nil {
+		return TermCaps{}, err
+	}
+	defer term.Restore(tty.Fd(), state)
+	// Erase the probe glyphs from the line
+	defer tty.WriteString("\r\x1b[K")
+
+	unicodeWidth, err := measureGlyph(tty, unicodeProbeGlyph)
+	if err != nil {
+		return TermCaps{}, err
+	}
+	nerdWidth, err := measureGlyph(tty, nerdProbeGlyph)
+	if err != nil {
+		return TermCaps{}, err
+	}
+
+	// Rows are laid out by computed width, so a glyph only works where the
+	// terminal draws it that wide too
+	utf8 := isUTF8Locale()
+	return TermCaps{
+		Unicode:  utf8 && unicodeWidth == runewidth.StringWidth(unicodeProbeGlyph),
+		NerdFont: utf8 && nerdWidth == runewidth.StringWidth(nerdProbeGlyph),
+	}, nil
+}
+
+// measureGlyph prints glyph at the start of the line and returns the number of columns it took
+func measureGlyph(tty *os.File, glyph string) (int, error) {
+	if _, err := tty.WriteString("\r\x1b[K" + glyph + "\x1b[6n"); err != nil {
+		return 0, err
+	}
+	col, err := readCursorColumn(tty)
+	if err != nil {
+		return 0, err
+	}
+	return col - 1, nil
+}
+
+// readCursorColumn waits for the terminal's cursor position report
+func readCursorColumn(tty *os.File) (int, error) {
+	var reply []byte
+	buf := make([]byte, 32)
+	deadline := time.Now().Add(probeTimeout)
+
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, errProbeTimeout
+		}
+
+		fds := []unix.PollFd{{Fd: int32(tty.Fd()), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(remaining.Milliseconds())+1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, errProbeTimeout
+		}
+
+		n, err = tty.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply = append(reply, buf[:n]...)
+
+		if col, ok := parseCursorReport(reply); ok {
+			return col, nil
+		}
+	}
+}
+
+// parseCursorReport extracts the column from a reply of the form ESC [ row ; col R.
+// Any input typed before the reply is ignored.
+func parseCursorReport(reply []byte) (int, bool) {
+	start := bytes.LastIndex(reply, []byte("\x1b["))
+	if start < 0 {
+		return 0, false
+	}
+	end := bytes.IndexByte(reply[start:], 'R')
+	if end < 0 {
+		return 0, false
+	}
+
+	_, col, ok := strings.Cut(string(reply[start+2:start+end]), ";")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(col)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// getTermCapsPath returns the full path to the terminal capability cache
+func getTermCapsPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cacheDir, termCapsFile), nil
+}
+
+func loadTermCapsCache() map[string]TermCaps {
+	cache := make(map[string]TermCaps)
+
+	path, err := getTermCapsPath()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := yaml.Unmarshal(data, &cache); err != nil || cache == nil {
+		return make(map[string]TermCaps)
+	}
+	return cache
+}
+
+func saveTermCapsCache(cache map[string]TermCaps) error {
+	path, err := getTermCapsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("failed to encode terminal capabilities: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestParseCursorReport(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  string
+		want   int
+		wantOK bool
+	}{
+		{"Simple reply", "\x1b[12;2R", 2, true},
+		{"Wide glyph", "\x1b[1;3R", 3, true},
+		{"Typed input before reply", "jk\x1b[5;10R", 10, true},
+		{"Incomplete reply", "\x1b[5;1", 0, false},
+		{"Missing column", "\x1b[5R", 0, false},
+		{"No escape", "5;1R", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCursorReport([]byte(tt.reply))
+			if ok != tt.wantOK {
+				t.Fatalf("got ok=%v, want ok=%v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("got column %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveIconMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		caps      TermCaps
+		want      string
+	}{
+		{"Auto with nerd font", IconsAuto, TermCaps{NerdFont: true, Unicode: true}, IconsNerd},
+		{"Auto with unicode", IconsAuto, TermCaps{Unicode: true}, IconsUnicode},
+		{"Auto with nothing", IconsAuto, TermCaps{}, IconsASCII},
+		{"Explicit nerd is honored", IconsNerd, TermCaps{}, IconsNerd},
+		{"Explicit ascii is honored", IconsASCII, TermCaps{NerdFont: true, Unicode: true}, IconsASCII},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveIconMode(tt.requested, tt.caps); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUTF8Locale(t *testing.T) {
+	tests := []struct {
+		name                 string
+		lcAll, lcCtype, lang string
+		want                 bool
+	}{
+		{"LANG UTF-8", "", "", "en_US.UTF-8", true},
+		{"LANG utf8", "", "", "de_DE.utf8", true},
+		{"LC_ALL overrides LANG", "C", "", "en_US.UTF-8", false},
+		{"LC_CTYPE overrides LANG", "", "en_US.UTF-8", "C", true},
+		{"Unset", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", tt.lcAll)
+			t.Setenv("LC_CTYPE", tt.lcCtype)
+			t.Setenv("LANG", tt.lang)
+			if got := isUTF8Locale(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplicitNerdFontCountsAsVerified(t *testing.T) {
+	// No cached measurement for this terminal
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LANG", "en_US.UTF-8")
+
+	display := DefaultDisplayConfig()
+	display.Icons = IconsNerd
+	display.ResolveIcons()
+	if display.iconMode != IconsNerd {
+		t.Fatalf("got icon mode %q", display.iconMode)
+	}
+
+	// Toggling off and back on again needs no probe
+	display.ToggleNerdFont()
+	if !display.ToggleNerdFont() {
+		t.Error("expected Nerd Font icons asked for by name to count as verified")
+	}
+}
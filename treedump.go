@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TreeDumpOptions controls a non-interactive tree listing
+type TreeDumpOptions struct {
+	Root       string
+	Depth      int // levels below the root to list; 0 for unlimited
+	DirsOnly   bool
+	Pattern    string // files must match, as with the TUI filter
+	ShowHidden bool
+	SortBy     SortMode
+	Format     string // "text", "json" or "ndjson"
+	Icons      *IconSet
+	Symbols    TreeSymbols
+	Indent     int
+}
+
+// treeEntry is the JSON form of a listed item
+type treeEntry struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Type     string       `json:"type"`
+	Size     int64        `json:"size"`
+	Mode     string       `json:"mode"`
+	ModTime  time.Time    `json:"modTime"`
+	MIME     string       `json:"mime,omitempty"`
+	Target   string       `json:"target,omitempty"`
+	Depth    int          `json:"depth"` // 0 for the root, 1 for its children
+	Children []*treeEntry `json:"children,omitempty"`
+}
+
+// ListTree loads the tree below opts.Root through the same LoadDirectory path as the TUI,
+// without the ".." entry. Item depths start at 0 for the root's children.
+func ListTree(opts TreeDumpOptions) ([]FileItem, error) {
+	tree := NewFileTree(opts.Root)
+	tree.showHidden = opts.ShowHidden
+	tree.sortBy = opts.SortBy
+	tree.filter = opts.Pattern
+	tree.dirsOnly = opts.DirsOnly
+	tree.expandDepth = opts.Depth - 1
+	if opts.Depth <= 0 {
+		tree.expandDepth = -1
+	}
+
+	switch msg := tree.LoadDirectory(opts.Root)().(type) {
+	case errMsg:
+		return nil, msg.error
+	case loadedDirectoryMsg:
+		items := msg.items
+		if len(items) > 0 && items[0].name == ".." {
+			items = items[1:]
+		}
+		// Every item is printed, so every item is detected
+		for i := range items {
+			if items[i].guessed {
+				items[i].mime = mimeTypes.DetectFS(tree.fs, items[i].path, nil)
+				items[i].guessed = false
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected result loading %s", opts.Root)
+}
+
+// DumpTree writes the tree below opts.Root in the requested format
+func DumpTree(w io.Writer, opts TreeDumpOptions) error {
+	items, err := ListTree(opts)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		rootItem := FileItem{path: opts.Root, name: filepath.Base(opts.Root), isDir: true, depth: -1}
+		if info, err := os.Stat(opts.Root); err == nil {
+			rootItem.mode, rootItem.size, rootItem.modTime = info.Mode(), info.Size(), info.ModTime()
+		}
+		root := newTreeEntry(rootItem)
+		root.Children = nestEntries(items)
+		return enc.Encode(root)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, item := range items {
+			if err := enc.Encode(newTreeEntry(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return writeTextTree(w, opts, items)
+	}
+}
+
+// writeTextTree prints a tree(1)-style listing using the TUI's connectors and icons
+func writeTextTree(w io.Writer, opts TreeDumpOptions, items []FileItem) error {
+	// Put the root at depth 0 so its children get connectors, as in tree(1)
+	all := make([]FileItem, 0, len(items)+1)
+	all = append(all, FileItem{path: opts.Root, name: opts.Root, isDir: true})
+	dirs, files := 0, 0
+	for _, item := range items {
+		item.depth++
+		all = append(all, item)
+		if item.isDir {
+			dirs++
+		} else {
+			files++
+		}
+	}
+
+	prefixes := opts.Symbols.Prefixes(all, opts.Indent)
+	for i, item := range all {
+		line := item.name
+		if opts.Icons != nil {
+			// Directories look open when their children are listed below them
+			expanded := i+1 < len(all) && all[i+1].depth > item.depth
+			line = opts.Icons.GetFileIcon(item, expanded) + " " + line
+		}
+		if prefixes[i] != "" {
+			line = prefixes[i] + " " + line
+		}
+		if item.mode&fs.ModeSymlink != 0 {
+			if target, err := os.Readlink(item.path); err == nil {
+				line += " -> " + target
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	summary := fmt.Sprintf("\n%d %s", dirs, plural(dirs, "directory", "directories"))
+	if !opts.DirsOnly {
+		summary += fmt.Sprintf(", %d %s", files, plural(files, "file", "files"))
+	}
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+// plural picks the singular or plural form for n
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
+
+// newTreeEntry converts an item to its JSON form
+func newTreeEntry(item FileItem) *treeEntry {
+	entry := &treeEntry{
+		Name:    item.name,
+		Path:    item.path,
+		Type:    fileTypeName(item.mode),
+		Size:    item.size,
+		Mode:    item.mode.String(),
+		ModTime: item.modTime,
+		MIME:    item.mime,
+		Depth:   item.depth + 1,
+	}
+	if item.isDir {
+		entry.Type = fileTypeName(fs.ModeDir)
+	}
+	if item.mode&fs.ModeSymlink != 0 {
+		entry.Target, _ = os.Readlink(item.path)
+	}
+	return entry
+}
+
+// nestEntries rebuilds the hierarchy of a flat, depth-annotated listing
+func nestEntries(items []FileItem) []*treeEntry {
+	var roots []*treeEntry
+	var stack []*treeEntry // stack[d] is the latest entry at depth d
+	for _, item := range items {
+		entry := newTreeEntry(item)
+		stack = append(stack[:item.depth], entry)
+		if item.depth == 0 {
+			roots = append(roots, entry)
+		} else {
+			parent := stack[item.depth-1]
+			parent.Children = append(parent.Children, entry)
+		}
+	}
+	return roots
+}
+
+// treeFlags holds the command line of "modaltree tree"
+type treeFlags struct {
+	depth    int
+	dirsOnly bool
+	pattern  string
+	all      bool
+	sortBy   string
+	icons    string
+	style    string
+	json     bool
+	ndjson   bool
+}
+
+// newTreeFlagSet defines the flags of "modaltree tree", storing them in opts
+func newTreeFlagSet(opts *treeFlags, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("tree", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	opts.sortBy, opts.icons = "name", "none"
+	flags.IntVar(&opts.depth, "depth", 0, "Descend at most this many levels (0 for unlimited)")
+	flags.BoolVar(&opts.dirsOnly, "dirs-only", false, "List directories only")
+	flags.StringVar(&opts.pattern, "pattern", "", "List only files matching this substring or shell pattern")
+	flags.BoolVar(&opts.all, "all", false, "Include hidden files")
+	choiceVar(flags, &opts.sortBy, "sort", "Sort order: name, size, modified or extension", sortNames())
+	choiceVar(flags, &opts.icons, "icons", "Icon set: none, auto, nerd, unicode or ascii", []string{"none", IconsAuto, IconsNerd, IconsUnicode, IconsASCII})
+	choiceVar(flags, &opts.style, "style", "Tree style: unicode, rounded, heavy, double, ascii or none", TreeStyles)
+	flags.BoolVar(&opts.json, "json", false, "Print a nested JSON document with metadata")
+	flags.BoolVar(&opts.ndjson, "ndjson", false, "Print one JSON object per line")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: modaltree tree [flags] [path]\n\nPrints the directory tree without starting the TUI.\n\n")
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// runTreeCommand implements "modaltree tree [path]" and returns the exit code
+func runTreeCommand(args []string, stdout, stderr io.Writer) int {
+	var opts treeFlags
+	flags := newTreeFlagSet(&opts, stderr)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return exitUsage
+	}
+
+	fail := func(format string, a ...any) int {
+		fmt.Fprintf(stderr, format+"\n", a...)
+		return exitUsage
+	}
+	if flags.NArg() > 1 {
+		return fail("tree takes at most one path")
+	}
+	if opts.json && opts.ndjson {
+		return fail("--json and --ndjson cannot be combined")
+	}
+	mode, _ := parseSortMode(opts.sortBy)
+
+	root := "."
+	if flags.NArg() == 1 {
+		root = flags.Arg(0)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	// A broken config is not fatal for a listing; the defaults are used instead
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading config: %v\n", err)
+	}
+	if opts.style != "" {
+		config.Display.TreeStyle = opts.style
+	}
+
+	dump := TreeDumpOptions{
+		Root:       root,
+		Depth:      opts.depth,
+		DirsOnly:   opts.dirsOnly,
+		Pattern:    opts.pattern,
+		ShowHidden: opts.all,
+		SortBy:     mode,
+		Format:     "text",
+		Symbols:    config.Display.ResolveTreeSymbols(),
+		Indent:     config.Display.IndentSize,
+	}
+	if opts.json {
+		dump.Format = "json"
+	} else if opts.ndjson {
+		dump.Format = "ndjson"
+	}
+	if opts.icons != "none" {
+		config.Display.Icons = opts.icons
+		config.Display.ResolveIcons()
+		config.loadIcons()
+		dump.Icons = &config.icons
+	}
+
+	if err := DumpTree(stdout, dump); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return 0
+}
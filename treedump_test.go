@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dumpFixture creates a/b/x.go, a/notes.txt, y.txt and .hidden below a temp dir
+func dumpFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a/b/x.go", "a/notes.txt", "y.txt", ".hidden"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func dumpText(t *testing.T, opts TreeDumpOptions) string {
+	t.Helper()
+	opts.Format = "text"
+	opts.Symbols = AsciiTreeSymbols()
+	opts.Indent = 2
+	var out bytes.Buffer
+	if err := DumpTree(&out, opts); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestDumpTreeText(t *testing.T) {
+	dir := dumpFixture(t)
+	got := dumpText(t, TreeDumpOptions{Root: dir})
+	want := dir + `
+|- a
+| |- b
+| | ` + "`" + `- x.go
+| ` + "`" + `- notes.txt
+` + "`" + `- y.txt
+
+2 directories, 3 files
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDumpTreeOptions(t *testing.T) {
+	dir := dumpFixture(t)
+
+	tests := []struct {
+		name    string
+		opts    TreeDumpOptions
+		want    []string
+		notWant []string
+		summary string
+	}{
+		{"depth", TreeDumpOptions{Depth: 1}, []string{"a", "y.txt"}, []string{"b", "notes.txt"}, "1 directory, 1 file"},
+		{"dirs only", TreeDumpOptions{DirsOnly: true}, []string{"a", "b"}, []string{"x.go", "y.txt"}, "2 directories"},
+		{"pattern", TreeDumpOptions{Pattern: "*.go"}, []string{"x.go"}, []string{"notes.txt", "y.txt"}, "2 directories, 1 file"},
+		{"hidden", TreeDumpOptions{ShowHidden: true}, []string{".hidden"}, nil, "2 directories, 4 files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Root = dir
+			out := dumpText(t, tt.opts)
+			names := make(map[string]bool)
+			for _, line := range strings.Split(out, "\n") {
+				fields := strings.Fields(line)
+				if len(fields) > 0 {
+					names[fields[len(fields)-1]] = true
+				}
+			}
+			for _, name := range tt.want {
+				if !names[name] {
+					t.Errorf("expected %s in:\n%s", name, out)
+				}
+			}
+			for _, name := range tt.notWant {
+				if names[name] {
+					t.Errorf("did not expect %s in:\n%s", name, out)
+				}
+			}
+			if !strings.HasSuffix(out, "\n"+tt.summary+"\n") {
+				t.Errorf("expected summary %q in:\n%s", tt.summary, out)
+			}
+		})
+	}
+}
+
+func TestDumpTreeJSON(t *testing.T) {
+	dir := dumpFixture(t)
+	var out bytes.Buffer
+	if err := DumpTree(&out, TreeDumpOptions{Root: dir, Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var root treeEntry
+	if err := json.Unmarshal(out.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Path != dir || root.Type != "directory" || root.Depth != 0 {
+		t.Errorf("unexpected root entry %+v", root)
+	}
+	if len(root.Children) != 2 || root.Children[0].Name != "a" || root.Children[1].Name != "y.txt" {
+		t.Fatalf("unexpected children %+v", root.Children)
+	}
+	a := root.Children[0]
+	if len(a.Children) != 2 || a.Children[0].Name != "b" || a.Children[0].Children[0].Name != "x.go" {
+		t.Errorf("unexpected nesting below a: %+v", a.Children)
+	}
+	if x := a.Children[0].Children[0]; x.Depth != 3 || x.Size != 1 || x.Type != "regular file" {
+		t.Errorf("unexpected metadata for x.go: %+v", x)
+	}
+}
+
+func TestDumpTreeNDJSON(t *testing.T) {
+	dir := dumpFixture(t)
+	var out bytes.Buffer
+	if err := DumpTree(&out, TreeDumpOptions{Root: dir, Format: "ndjson"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var entry treeEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		if len(entry.Children) != 0 {
+			t.Errorf("expected flat entries, got children on %s", entry.Name)
+		}
+		rel, _ := filepath.Rel(dir, entry.Path)
+		paths = append(paths, rel)
+	}
+	want := []string{"a", "a/b", "a/b/x.go", "a/notes.txt", "y.txt"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+}
+
+func TestRunTreeCommandUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"--json", "--ndjson"},
+		{"--sort", "bogus"},
+		{"--icons", "bogus"},
+		{"a", "b"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runTreeCommand(args, &stdout, &stderr); code != exitUsage {
+			t.Errorf("%v: expected exit code %d, got %d", args, exitUsage, code)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("%v: expected an error message", args)
+		}
+	}
+}